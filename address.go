@@ -0,0 +1,216 @@
+package enmime
+
+import (
+	"io"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// addressParser is a net/mail parser that understands every charset enmime does
+var addressParser = &mail.AddressParser{
+	WordDecoder: &mime.WordDecoder{
+		CharsetReader: func(label string, input io.Reader) (io.Reader, error) {
+			// The charsets of encoded-words in other headers, see decodeHeader
+			decoder, err := charsetDecoder(label)
+			if err != nil {
+				return nil, err
+			}
+			return decoder.NewReader(input), nil
+		},
+	},
+}
+
+// AddressList parses every occurrence of the named address header (From, To, Cc, etc)
+// into a list of decoded addresses.  See ParseAddressList for details.
+func (m *MIMEBody) AddressList(name string) ([]*mail.Address, []string) {
+	addrs := make([]*mail.Address, 0, 4)
+	var bad []string
+	for _, value := range m.header[textproto.CanonicalMIMEHeaderKey(name)] {
+		a, b := ParseAddressList(value)
+		addrs = append(addrs, a...)
+		bad = append(bad, b...)
+	}
+	return addrs, bad
+}
+
+// ParseAddressList parses an address list header value into decoded addresses.  Values are
+// first given to net/mail; if it rejects them, each address is parsed on its own, and a
+// lenient parser handles the common mistakes of real-world mailers: unquoted commas in
+// display names, missing angle brackets, RFC 2047 encoded-words inside quoted strings and
+// stray semicolons.  Fragments that do not contain a usable address are returned as the
+// second value.
+func ParseAddressList(value string) ([]*mail.Address, []string) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	if addrs, err := addressParser.ParseList(value); err == nil {
+		for _, a := range addrs {
+			a.Name = decodeAddressName(a.Name)
+		}
+		return addrs, nil
+	}
+
+	addrs := make([]*mail.Address, 0, 4)
+	var bad []string
+	pending := ""
+	for _, frag := range splitAddressList(value) {
+		if !strings.Contains(frag, "@") {
+			// Likely the first half of an unquoted "Last, First <addr>" display name
+			if pending != "" {
+				bad = append(bad, strings.TrimSpace(pending))
+			}
+			pending = frag
+			continue
+		}
+		if pending != "" {
+			if a := parseAddressLenient(pending + "," + frag); a != nil {
+				addrs = append(addrs, a)
+				pending = ""
+				continue
+			}
+			bad = append(bad, strings.TrimSpace(pending))
+			pending = ""
+		}
+		if a := parseAddressLenient(frag); a != nil {
+			addrs = append(addrs, a)
+		} else {
+			bad = append(bad, strings.TrimSpace(frag))
+		}
+	}
+	if pending != "" {
+		bad = append(bad, strings.TrimSpace(pending))
+	}
+
+	return addrs, bad
+}
+
+// splitAddressList splits an address list on commas and semicolons that are not inside
+// quoted strings, angle brackets or comments.  Group names ("group:") are dropped and
+// blank fragments are skipped; others are returned untrimmed.
+func splitAddressList(value string) []string {
+	frags := make([]string, 0, 4)
+	start := 0
+	quoted, angle, comment := false, false, 0
+	add := func(end int) {
+		if frag := value[start:end]; strings.TrimSpace(frag) != "" {
+			frags = append(frags, frag)
+		}
+		start = end + 1
+	}
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && (quoted || comment > 0):
+			i++
+		case quoted:
+			quoted = c != '"'
+		case comment > 0:
+			switch c {
+			case '(':
+				comment++
+			case ')':
+				comment--
+			}
+		case c == '"':
+			quoted = true
+		case c == '(':
+			comment++
+		case angle:
+			angle = c != '>'
+		case c == '<':
+			angle = true
+		case c == ':' && !strings.Contains(value[start:i], "@"):
+			// Start of a group, the display name of the group is not an address
+			start = i + 1
+		case c == ',' || c == ';':
+			add(i)
+		}
+	}
+	add(len(value))
+
+	return frags
+}
+
+// parseAddressLenient parses a single address, returning nil if there is no usable
+// address in frag
+func parseAddressLenient(frag string) *mail.Address {
+	frag = strings.TrimSpace(frag)
+	if a, err := addressParser.Parse(frag); err == nil {
+		a.Name = decodeAddressName(a.Name)
+		return a
+	}
+
+	var name, addr string
+	if open := strings.LastIndex(frag, "<"); open >= 0 && strings.Index(frag[open:], ">") > 0 {
+		// Angle brackets present, everything else is the display name
+		end := open + strings.Index(frag[open:], ">")
+		addr = frag[open+1 : end]
+		name = frag[:open] + " " + frag[end+1:]
+	} else {
+		// Missing angle brackets, the word with an @ is the address
+		words := strings.Fields(frag)
+		for i, w := range words {
+			if strings.Contains(w, "@") {
+				addr = strings.Trim(w, "<>[]\"'")
+				name = strings.Join(append(words[:i:i], words[i+1:]...), " ")
+				break
+			}
+		}
+	}
+
+	addr = strings.TrimSpace(addr)
+	if !isLenientAddrSpec(addr) {
+		return nil
+	}
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, "(") && strings.HasSuffix(name, ")") {
+		name = name[1 : len(name)-1]
+	}
+	return &mail.Address{Name: decodeAddressName(unquoteAddressName(name)), Address: addr}
+}
+
+// unquoteAddressName removes quotes and backslash escapes from a display name
+func unquoteAddressName(name string) string {
+	name = strings.TrimSpace(name)
+	if !strings.ContainsAny(name, "\"\\") {
+		return name
+	}
+	out := make([]byte, 0, len(name))
+	for i := 0; i < len(name); i++ {
+		switch {
+		case name[i] == '\\' && i+1 < len(name):
+			i++
+			out = append(out, name[i])
+		case name[i] == '"':
+		default:
+			out = append(out, name[i])
+		}
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// decodeAddressName decodes encoded-words left in a display name; net/mail does not
+// decode them inside quoted strings
+func decodeAddressName(name string) string {
+	if strings.Contains(name, "=?") {
+		return decodeHeader(name)
+	}
+	return name
+}
+
+// isLenientAddrSpec returns true if addr looks enough like local@domain to be delivered to
+func isLenientAddrSpec(addr string) bool {
+	at := strings.LastIndex(addr, "@")
+	if at <= 0 || at == len(addr)-1 {
+		return false
+	}
+	if strings.ContainsAny(addr, " \t\r\n<>(),;:\"") {
+		return false
+	}
+	domain := addr[at+1:]
+	return !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".") &&
+		!strings.Contains(domain, "..")
+}
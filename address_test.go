@@ -0,0 +1,98 @@
+package enmime
+
+import (
+	"net/mail"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAddressList(t *testing.T) {
+	var testTable = []struct {
+		input  string
+		expect []*mail.Address
+		bad    []string
+	}{
+		{
+			// Valid lists are handled by net/mail
+			input: `"Doe, John" <john@example.com>, jane@example.com`,
+			expect: []*mail.Address{
+				{Name: "Doe, John", Address: "john@example.com"},
+				{Name: "", Address: "jane@example.com"},
+			},
+		},
+		{
+			input:  "Doe, John <john@example.com>",
+			expect: []*mail.Address{{Name: "Doe, John", Address: "john@example.com"}},
+		},
+		{
+			input:  "John Doe john@example.com",
+			expect: []*mail.Address{{Name: "John Doe", Address: "john@example.com"}},
+		},
+		{
+			input:  `"=?iso-8859-1?Q?Ren=E9e?= Doe" <renee@example.com>`,
+			expect: []*mail.Address{{Name: "Renée Doe", Address: "renee@example.com"}},
+		},
+		{
+			input:  "=?utf-8?q?Ren=C3=A9e?= <renee@example.com>",
+			expect: []*mail.Address{{Name: "Renée", Address: "renee@example.com"}},
+		},
+		{
+			// Decoded with the charsets of the other headers
+			input:  "=?koi8-r?B?6dfBzg==?= <ivan@example.com>",
+			expect: []*mail.Address{{Name: "Иван", Address: "ivan@example.com"}},
+		},
+		{
+			input: "a@example.com; b@example.com;",
+			expect: []*mail.Address{
+				{Name: "", Address: "a@example.com"},
+				{Name: "", Address: "b@example.com"},
+			},
+		},
+		{
+			input:  "undisclosed-recipients:;",
+			expect: []*mail.Address{},
+		},
+		{
+			input: "Team: a@example.com, Doe, John <john@example.com>;, nobody, x@",
+			expect: []*mail.Address{
+				{Name: "", Address: "a@example.com"},
+				{Name: "Doe, John", Address: "john@example.com"},
+			},
+			bad: []string{"nobody", "x@"},
+		},
+		{
+			input:  "garbage",
+			expect: []*mail.Address{},
+			bad:    []string{"garbage"},
+		},
+	}
+
+	for _, tt := range testTable {
+		addrs, bad := ParseAddressList(tt.input)
+		if len(tt.expect) == 0 {
+			assert.Equal(t, 0, len(addrs), "Expected no addresses for input %q", tt.input)
+		} else {
+			assert.Equal(t, tt.expect, addrs, "Wrong addresses for input %q", tt.input)
+		}
+		assert.Equal(t, tt.bad, bad, "Wrong fragments for input %q", tt.input)
+	}
+}
+
+func TestMIMEBodyAddressList(t *testing.T) {
+	msg := readMessage("12-latin_1_from.eml")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	from, bad := mime.AddressList("From")
+	assert.Equal(t, 0, len(bad))
+	if assert.Equal(t, 1, len(from)) {
+		assert.Equal(t, mime.GetHeader("From"), from[0].Name+" <"+from[0].Address+">")
+	}
+
+	cc, bad := mime.AddressList("X-Not-Present")
+	assert.Equal(t, 0, len(cc))
+	assert.Equal(t, 0, len(bad))
+}
@@ -0,0 +1,107 @@
+package enmime
+
+import (
+	"strings"
+)
+
+// DefaultAlternatives is the multipart/alternative preference list used when ParseOptions
+// does not provide one: plain text is preferred for Text and HTML for Html, falling back
+// to converted text/enriched and text/richtext.
+var DefaultAlternatives = []string{"text/plain", "text/html", "text/enriched", "text/richtext"}
+
+// rendersText returns true if parts of this media type can populate MIMEBody.Text
+func rendersText(mediatype string) bool {
+	switch mediatype {
+	case "text/plain", "text/enriched", "text/richtext":
+		return true
+	}
+	return false
+}
+
+// rendersHtml returns true if parts of this media type can populate MIMEBody.Html
+func rendersHtml(mediatype string) bool {
+	switch mediatype {
+	case "text/html", "text/enriched", "text/richtext":
+		return true
+	}
+	return false
+}
+
+// renderText returns the plain text rendering of content having the given media type
+func renderText(mediatype string, content []byte) string {
+	switch mediatype {
+	case "text/enriched":
+		return enrichedToText(string(content), false)
+	case "text/richtext":
+		return enrichedToText(string(content), true)
+	}
+	return string(content)
+}
+
+// renderHtml returns the HTML rendering of content having the given media type
+func renderHtml(mediatype string, content []byte) string {
+	switch mediatype {
+	case "text/enriched":
+		return enrichedToHtml(string(content), false)
+	case "text/richtext":
+		return enrichedToHtml(string(content), true)
+	}
+	return string(content)
+}
+
+// alternativeType returns the media type a part represents when it is offered as an
+// alternative.  A multipart alternative is represented by its first child, which is the
+// root of a multipart/related (RFC 2387) and the leading body of a multipart/mixed.
+func alternativeType(p MIMEPart) string {
+	for strings.HasPrefix(p.ContentType(), "multipart/") && p.FirstChild() != nil {
+		p = p.FirstChild()
+	}
+	return p.ContentType()
+}
+
+// alternativeRank returns the position of mediatype in prefs, or -1 if it is not listed
+func alternativeRank(prefs []string, mediatype string) int {
+	for i, pref := range prefs {
+		if strings.EqualFold(pref, mediatype) {
+			return i
+		}
+	}
+	return -1
+}
+
+// selectAlternative returns the child of the multipart/alternative part p which should
+// provide a rendering, where renders reports whether a media type is able to.  The most
+// preferred acceptable child wins; amongst equally preferred children the last one does, as
+// RFC 2046 orders alternatives by increasing faithfulness to the original content.  Returns
+// nil if no child is acceptable.
+func selectAlternative(p MIMEPart, prefs []string, renders func(string) bool) MIMEPart {
+	var best MIMEPart
+	bestRank := -1
+	for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+		mediatype := alternativeType(c)
+		if !renders(mediatype) {
+			continue
+		}
+		rank := alternativeRank(prefs, mediatype)
+		if rank < 0 {
+			continue
+		}
+		if best == nil || rank <= bestRank {
+			best = c
+			bestRank = rank
+		}
+	}
+	return best
+}
+
+// onSelectedBranch returns true if every multipart/alternative ancestor of p selects the
+// branch containing p for the rendering described by renders.
+func onSelectedBranch(p MIMEPart, prefs []string, renders func(string) bool) bool {
+	for child, parent := p, p.Parent(); parent != nil; child, parent = parent, parent.Parent() {
+		if parent.ContentType() == "multipart/alternative" &&
+			selectAlternative(parent, prefs, renders) != child {
+			return false
+		}
+	}
+	return true
+}
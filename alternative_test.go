@@ -0,0 +1,93 @@
+package enmime
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAlternativeDefault(t *testing.T) {
+	msg := readMessage("mime-alternative.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	// The last of the equally preferred text/plain alternatives wins, and alternatives are
+	// not concatenated with the parts outside of them
+	assert.Equal(t, "Flowed plain section\n--\nTrailing section", mime.Text)
+	assert.Contains(t, mime.Html, "<p>HTML section</p>")
+	assert.Equal(t, 1, len(mime.Inlines), "Should have one inline")
+	assert.Equal(t, "logo.gif", mime.Inlines[0].FileName())
+}
+
+func TestParseAlternativePreferences(t *testing.T) {
+	// HTML only, plain text alternatives are not acceptable
+	msg := readMessage("mime-alternative.raw")
+	mime, err := ParseMIMEBodyOptions(msg, &ParseOptions{Alternatives: []string{"text/html"}})
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "Trailing section", mime.Text, "Parts outside alternatives are unaffected")
+	assert.Contains(t, mime.Html, "<p>HTML section</p>")
+
+	// Plain text only
+	msg = readMessage("mime-alternative.raw")
+	mime, err = ParseMIMEBodyOptions(msg, &ParseOptions{Alternatives: []string{"text/plain"}})
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "Flowed plain section\n--\nTrailing section", mime.Text)
+	assert.Equal(t, "", mime.Html)
+}
+
+func TestParseAlternativeTopLevel(t *testing.T) {
+	raw := "Content-Type: multipart/alternative; boundary=\"b\"\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nFirst\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nSecond\r\n" +
+		"--b\r\nContent-Type: text/html\r\n\r\n<p>Third</p>\r\n" +
+		"--b--\r\n"
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "Second", mime.Text, "Alternatives should not be concatenated")
+	assert.Equal(t, "<p>Third</p>", mime.Html)
+}
+
+func TestSelectAlternative(t *testing.T) {
+	// Setup test MIME tree:
+	//    root (multipart/alternative)
+	//    ├── a1 (text/plain)
+	//    ├── a2 (multipart/related)
+	//    │   ├── b1 (text/html)
+	//    │   └── b2 (image/png)
+	//    └── a3 (application/pdf)
+
+	root := &memMIMEPart{contentType: "multipart/alternative"}
+	a1 := &memMIMEPart{contentType: "text/plain", parent: root}
+	a2 := &memMIMEPart{contentType: "multipart/related", parent: root}
+	a3 := &memMIMEPart{contentType: "application/pdf", parent: root}
+	b1 := &memMIMEPart{contentType: "text/html", parent: a2}
+	b2 := &memMIMEPart{contentType: "image/png", parent: a2}
+	root.firstChild = a1
+	a1.nextSibling = a2
+	a2.nextSibling = a3
+	a2.firstChild = b1
+	b1.nextSibling = b2
+
+	prefs := []string{"text/plain", "text/html"}
+	assert.Equal(t, a1, selectAlternative(root, prefs, rendersText))
+	assert.Equal(t, a2, selectAlternative(root, prefs, rendersHtml))
+	assert.Nil(t, selectAlternative(root, []string{"application/pdf"}, rendersText))
+
+	assert.True(t, onSelectedBranch(b1, prefs, rendersHtml))
+	assert.False(t, onSelectedBranch(b1, prefs, rendersText))
+	assert.True(t, onSelectedBranch(a1, prefs, rendersText))
+}
@@ -0,0 +1,275 @@
+package enmime
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// arcMaxInstance is the highest instance number RFC 8617 allows
+const arcMaxInstance = 50
+
+// ARCStatus is the chain validation status of an ARC chain, as recorded in the cv= tag
+type ARCStatus int
+
+const (
+	ARCNone ARCStatus = iota // The message has no ARC sets
+	ARCPass                  // Every set is present and every seal verifies
+	ARCFail                  // The chain is broken or a signature did not verify
+)
+
+// String returns the cv= value of the status
+func (s ARCStatus) String() string {
+	switch s {
+	case ARCPass:
+		return "pass"
+	case ARCFail:
+		return "fail"
+	}
+	return "none"
+}
+
+// ARCSet is the ARC-Seal, ARC-Message-Signature and ARC-Authentication-Results headers
+// added by one intermediary
+type ARCSet struct {
+	Instance int
+	Domain   string       // Signing domain of the seal (d= tag)
+	Selector string       // Key selector of the seal (s= tag)
+	Seal     DKIMStatus   // Result of verifying the ARC-Seal
+	Message  DKIMStatus   // Result of verifying the ARC-Message-Signature
+	Chain    ARCStatus    // Chain status the intermediary recorded (cv= tag)
+	Results  *AuthResults // Parsed ARC-Authentication-Results, nil if malformed
+}
+
+// ARCResult is the outcome of validating the ARC (RFC 8617) chain of a message
+type ARCResult struct {
+	Status     ARCStatus // The cv= value the next ARC set must record
+	Err        error     // Why the chain failed; nil unless Status is ARCFail
+	Instance   int       // Highest instance in the chain; zero if there is none
+	OldestPass int       // Oldest instance whose message signature still verifies; zero if all do
+	Sets       []ARCSet  // Sets ordered by instance, starting with 1
+}
+
+// arcHeaders holds the raw header fields of one ARC set
+type arcHeaders struct {
+	seal, message, results *rawHeaderField
+	messageIndex           int // Position of message in the header
+}
+
+// VerifyARC validates the ARC chain of the message, which must have been read by
+// ReadMIMEBody.  See VerifyARC.
+func (m *MIMEBody) VerifyARC(resolver DKIMKeyResolver) (*ARCResult, error) {
+	if m.raw == nil {
+		return nil, fmt.Errorf("Raw message not available, use ReadMIMEBody")
+	}
+	return VerifyARC(m.raw, resolver)
+}
+
+// VerifyARC validates the ARC chain of the raw message following RFC 8617 section 5.2:
+// the sets must be complete and numbered from 1, the latest message signature and every
+// seal must verify, and the seals must record cv=none for the first set and cv=pass for
+// the others.  Older message signatures are verified to compute OldestPass.  An error is
+// only returned if the message cannot be split into header and body.
+func VerifyARC(raw []byte, resolver DKIMKeyResolver) (*ARCResult, error) {
+	fields, body, err := splitRawMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ARCResult{}
+	fail := func(format string, args ...interface{}) (*ARCResult, error) {
+		result.Status = ARCFail
+		result.Err = fmt.Errorf(format, args...)
+		return result, nil
+	}
+
+	// Group the headers by instance
+	sets := make(map[int]*arcHeaders)
+	for i := range fields {
+		f := &fields[i]
+		var slot **rawHeaderField
+		name := strings.ToLower(f.name)
+		if name != "arc-seal" && name != "arc-message-signature" && name != "arc-authentication-results" {
+			continue
+		}
+		instance, err := arcInstance(f.value())
+		if err != nil {
+			return fail("Malformed %v header: %v", f.name, err)
+		}
+		set := sets[instance]
+		if set == nil {
+			set = &arcHeaders{}
+			sets[instance] = set
+		}
+		switch name {
+		case "arc-seal":
+			slot = &set.seal
+		case "arc-message-signature":
+			slot = &set.message
+			set.messageIndex = i
+		default:
+			slot = &set.results
+		}
+		if *slot != nil {
+			return fail("Duplicate %v header for instance %v", f.name, instance)
+		}
+		*slot = f
+		if instance > result.Instance {
+			result.Instance = instance
+		}
+	}
+	if len(sets) == 0 {
+		return result, nil
+	}
+
+	// Structure
+	n := result.Instance
+	if n > arcMaxInstance {
+		return fail("Too many ARC sets: %v", n)
+	}
+	ordered := make([]*arcHeaders, n)
+	sealTags := make([]map[string]string, n)
+	result.Sets = make([]ARCSet, n)
+	for i := 1; i <= n; i++ {
+		set := sets[i]
+		if set == nil || set.seal == nil || set.message == nil || set.results == nil {
+			return fail("Incomplete ARC set for instance %v", i)
+		}
+		ordered[i-1] = set
+		tags, err := parseTagList(set.seal.value())
+		if err != nil {
+			return fail("Malformed ARC-Seal for instance %v: %v", i, err)
+		}
+		sealTags[i-1] = tags
+		s := &result.Sets[i-1]
+		s.Instance = i
+		s.Domain = strings.ToLower(tags["d"])
+		s.Selector = tags["s"]
+		s.Results, _ = ParseARCAuthResults(set.results.value())
+		switch strings.ToLower(tags["cv"]) {
+		case "none":
+			s.Chain = ARCNone
+		case "pass":
+			s.Chain = ARCPass
+		default:
+			s.Chain = ARCFail
+		}
+	}
+	if result.Sets[n-1].Chain == ARCFail {
+		return fail("Instance %v recorded a failed chain", n)
+	}
+	for i, s := range result.Sets {
+		if (i == 0 && s.Chain != ARCNone) || (i > 0 && s.Chain != ARCPass) {
+			return fail("Unexpected cv=%v for instance %v", s.Chain, s.Instance)
+		}
+	}
+
+	// Message signatures, the latest one must verify
+	for i := n; i >= 1; i-- {
+		set := ordered[i-1]
+		status, err := verifyARCMessage(fields, set.messageIndex, body, resolver)
+		result.Sets[i-1].Message = status
+		if status != DKIMPass {
+			if i == n {
+				return fail("ARC-Message-Signature of instance %v did not verify: %v", i, err)
+			}
+			if result.OldestPass == 0 {
+				result.OldestPass = i + 1
+			}
+		}
+	}
+
+	// Seals, every one must verify
+	for i := n; i >= 1; i-- {
+		status, err := verifyARCSeal(ordered[:i], sealTags[i-1], resolver)
+		result.Sets[i-1].Seal = status
+		if status != DKIMPass {
+			return fail("ARC-Seal of instance %v did not verify: %v", i, err)
+		}
+	}
+
+	result.Status = ARCPass
+	return result, nil
+}
+
+// arcInstance returns the value of the i= tag of an ARC header
+func arcInstance(value string) (int, error) {
+	// ARC-Authentication-Results is not a tag list, but starts with the i= tag
+	first := value
+	if semi := strings.Index(value, ";"); semi >= 0 {
+		first = value[:semi]
+	}
+	tags, err := parseTagList(first)
+	if err != nil || tags["i"] == "" {
+		tags, err = parseTagList(value)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := strconv.Atoi(tags["i"])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("Invalid instance %q", tags["i"])
+	}
+	return n, nil
+}
+
+// verifyARCMessage verifies the ARC-Message-Signature held in fields[index]
+func verifyARCMessage(fields []rawHeaderField, index int, body []byte,
+	resolver DKIMKeyResolver) (DKIMStatus, error) {
+	tags, err := parseTagList(fields[index].value())
+	if err != nil {
+		return DKIMPermError, err
+	}
+	for _, name := range []string{"a", "b", "bh", "d", "h", "s"} {
+		if _, ok := tags[name]; !ok {
+			return DKIMPermError, fmt.Errorf("Missing the %v= tag", name)
+		}
+	}
+	if containsFold(splitHeaderList(tags["h"]), "ARC-Seal") {
+		return DKIMPermError, fmt.Errorf("ARC-Seal must not be signed")
+	}
+	return verifyMessageSignature(tags, fields, index, body, resolver)
+}
+
+// verifyARCSeal verifies the ARC-Seal of the last of sets, which covers the headers of all
+// of them in instance order using relaxed canonicalization
+func verifyARCSeal(sets []*arcHeaders, tags map[string]string, resolver DKIMKeyResolver) (DKIMStatus, error) {
+	for _, name := range []string{"a", "b", "cv", "d", "s"} {
+		if _, ok := tags[name]; !ok {
+			return DKIMPermError, fmt.Errorf("Missing the %v= tag", name)
+		}
+	}
+	algorithm := strings.ToLower(tags["a"])
+	if algorithm != "rsa-sha256" && algorithm != "ed25519-sha256" {
+		return DKIMPermError, fmt.Errorf("Unsupported algorithm %v", algorithm)
+	}
+	if _, ok := tags["h"]; ok {
+		return DKIMPermError, fmt.Errorf("ARC-Seal must not have an h= tag")
+	}
+
+	h := sha256.New()
+	for i, set := range sets {
+		h.Write(canonicalHeader(*set.results, true))
+		h.Write(canonicalHeader(*set.message, true))
+		if i < len(sets)-1 {
+			h.Write(canonicalHeader(*set.seal, true))
+		}
+	}
+	last := sets[len(sets)-1].seal
+	sig := canonicalHeader(rawHeaderField{name: last.name, raw: stripSignatureValue(last.raw)}, true)
+	h.Write(sig[:len(sig)-2])
+
+	pub, status, err := lookupDKIMKey(resolver, tags["s"], strings.ToLower(tags["d"]), algorithm)
+	if err != nil {
+		return status, err
+	}
+	b, err := decodeTagBase64(tags["b"])
+	if err != nil {
+		return DKIMPermError, fmt.Errorf("Malformed signature: %v", err)
+	}
+	if err := verifyDigest(pub, h.Sum(nil), b); err != nil {
+		return DKIMFail, err
+	}
+	return DKIMPass, nil
+}
@@ -0,0 +1,94 @@
+package enmime
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testARCKeys = MapKeyResolver{
+	"arc._domainkey.lists.example.org": testDKIMKeys["rsa._domainkey.example.net"],
+	"arc._domainkey.fwd.example.com":   testDKIMKeys["ed._domainkey.example.net"],
+}
+
+func TestVerifyARC(t *testing.T) {
+	raw := readRawMessage("arc-signed.raw")
+	mime, err := ReadMIMEBody(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+
+	result, err := mime.VerifyARC(testARCKeys)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, ARCPass, result.Status, "%v", result.Err)
+	assert.Equal(t, 2, result.Instance)
+	// The forwarder appended a footer, breaking the message signature of the list
+	assert.Equal(t, 2, result.OldestPass)
+	if assert.Equal(t, 2, len(result.Sets)) {
+		first, second := result.Sets[0], result.Sets[1]
+		assert.Equal(t, "lists.example.org", first.Domain)
+		assert.Equal(t, ARCNone, first.Chain)
+		assert.Equal(t, DKIMPass, first.Seal)
+		assert.Equal(t, DKIMFail, first.Message)
+		assert.Equal(t, "pass", first.Results.Result("spf").Result)
+		assert.Equal(t, "fwd.example.com", second.Domain)
+		assert.Equal(t, ARCPass, second.Chain)
+		assert.Equal(t, DKIMPass, second.Seal)
+		assert.Equal(t, DKIMPass, second.Message)
+	}
+
+	// Removing the footer breaks the latest message signature
+	footer := []byte("-- \r\nForwarded by fwd.example.com\r\n")
+	result, _ = VerifyARC(bytes.Replace(raw, footer, nil, 1), testARCKeys)
+	assert.Equal(t, ARCFail, result.Status)
+
+	// Modified after the last hop
+	result, _ = VerifyARC(bytes.Replace(raw, []byte("Quarterly"), []byte("Annual"), 1), testARCKeys)
+	assert.Equal(t, ARCFail, result.Status)
+	assert.Equal(t, DKIMFail, result.Sets[1].Message)
+
+	// Modified seal results
+	result, _ = VerifyARC(bytes.Replace(raw, []byte("dkim=none"), []byte("dkim=pass"), 1), testARCKeys)
+	assert.Equal(t, ARCFail, result.Status)
+	assert.Equal(t, DKIMFail, result.Sets[1].Seal)
+
+	// Missing key
+	result, _ = VerifyARC(raw, MapKeyResolver{})
+	assert.Equal(t, ARCFail, result.Status)
+	assert.Error(t, result.Err)
+}
+
+func TestVerifyARCStructure(t *testing.T) {
+	raw := readRawMessage("arc-signed.raw")
+
+	result, err := VerifyARC(readRawMessage("dkim-signed.raw"), testARCKeys)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ARCNone, result.Status)
+		assert.Equal(t, "none", result.Status.String())
+		assert.Equal(t, 0, result.Instance)
+	}
+
+	// Incomplete set
+	broken := bytes.Replace(raw, []byte("ARC-Authentication-Results: i=2;"), []byte("X-Removed: i=2;"), 1)
+	result, _ = VerifyARC(broken, testARCKeys)
+	assert.Equal(t, ARCFail, result.Status)
+
+	// Duplicate header
+	broken = append([]byte("ARC-Authentication-Results: i=1; example.com; none\r\n"), raw...)
+	result, _ = VerifyARC(broken, testARCKeys)
+	assert.Equal(t, ARCFail, result.Status)
+
+	// Gap in the instances
+	broken = bytes.Replace(raw, []byte("i=2;"), []byte("i=3;"), -1)
+	result, _ = VerifyARC(broken, testARCKeys)
+	assert.Equal(t, ARCFail, result.Status)
+	assert.Equal(t, 3, result.Instance)
+
+	// Latest seal records a failure
+	broken = bytes.Replace(raw, []byte("cv=pass"), []byte("cv=fail"), 1)
+	result, _ = VerifyARC(broken, testARCKeys)
+	assert.Equal(t, ARCFail, result.Status)
+}
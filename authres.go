@@ -0,0 +1,264 @@
+package enmime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AuthResult is the outcome of a single authentication method, such as spf, dkim, dmarc
+// or arc, recorded in an Authentication-Results header
+type AuthResult struct {
+	Method  string            // Method name, lower case
+	Version int               // Method version, 1 unless specified
+	Result  string            // Result such as pass, fail, softfail or none, lower case
+	Reason  string            // Free form explanation of the result, if any
+	Props   map[string]string // Properties keyed by ptype.property, such as "header.d"
+}
+
+// AuthResults is a parsed Authentication-Results (RFC 8601) or ARC-Authentication-Results
+// (RFC 8617) header
+type AuthResults struct {
+	AuthServID string // Identifier of the host that performed the checks
+	Version    int    // Header version, 1 unless specified
+	Instance   int    // ARC instance (i= tag); zero for Authentication-Results
+	Results    []AuthResult
+}
+
+// Result returns the first result for the named method, or nil
+func (a *AuthResults) Result(method string) *AuthResult {
+	for i := range a.Results {
+		if strings.EqualFold(a.Results[i].Method, method) {
+			return &a.Results[i]
+		}
+	}
+	return nil
+}
+
+// AuthenticationResults parses the Authentication-Results headers of the message, in the
+// order they appear.  Anybody may add such a header, so when trusted authserv-ids are given
+// only the headers added by those hosts are returned.  Unparseable headers are skipped.
+func (m *MIMEBody) AuthenticationResults(trusted ...string) []*AuthResults {
+	return filterAuthResults(m.header["Authentication-Results"], false, trusted)
+}
+
+// ARCAuthenticationResults parses the ARC-Authentication-Results headers of the message;
+// see AuthenticationResults
+func (m *MIMEBody) ARCAuthenticationResults(trusted ...string) []*AuthResults {
+	return filterAuthResults(m.header["Arc-Authentication-Results"], true, trusted)
+}
+
+// filterAuthResults parses values, keeping those from trusted authserv-ids
+func filterAuthResults(values []string, arc bool, trusted []string) []*AuthResults {
+	results := make([]*AuthResults, 0, len(values))
+	for _, value := range values {
+		var a *AuthResults
+		var err error
+		if arc {
+			a, err = ParseARCAuthResults(value)
+		} else {
+			a, err = ParseAuthResults(value)
+		}
+		if err != nil {
+			continue
+		}
+		if len(trusted) > 0 {
+			found := false
+			for _, id := range trusted {
+				found = found || strings.EqualFold(id, a.AuthServID)
+			}
+			if !found {
+				continue
+			}
+		}
+		results = append(results, a)
+	}
+	return results
+}
+
+// ParseAuthResults parses an Authentication-Results header value.  Comments are ignored, as
+// are unknown ptypes.  Results not separated by semicolons, which some filters produce, are
+// accepted as well.
+func ParseAuthResults(value string) (*AuthResults, error) {
+	return parseAuthResults(value, false)
+}
+
+// ParseARCAuthResults parses an ARC-Authentication-Results header value, which starts
+// with the "i=" instance tag
+func ParseARCAuthResults(value string) (*AuthResults, error) {
+	return parseAuthResults(value, true)
+}
+
+func parseAuthResults(value string, arc bool) (*AuthResults, error) {
+	segments := splitQuoted(stripAuthComments(value), ';')
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("Empty authentication results")
+	}
+	a := &AuthResults{Version: 1, Results: make([]AuthResult, 0, len(segments))}
+
+	if arc {
+		tag := strings.Join(strings.Fields(segments[0]), "")
+		if !strings.HasPrefix(strings.ToLower(tag), "i=") {
+			return nil, fmt.Errorf("Missing instance in %q", value)
+		}
+		n, err := strconv.Atoi(tag[2:])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("Invalid instance in %q", value)
+		}
+		a.Instance = n
+		segments = segments[1:]
+		if len(segments) == 0 {
+			return nil, fmt.Errorf("Missing authserv-id in %q", value)
+		}
+	}
+
+	fields := splitQuoted(segments[0], ' ')
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("Missing authserv-id in %q", value)
+	}
+	a.AuthServID = unquoteAuthValue(fields[0])
+	if len(fields) > 1 {
+		if v, err := strconv.Atoi(fields[1]); err == nil {
+			a.Version = v
+		}
+	}
+
+	for _, segment := range segments[1:] {
+		var result *AuthResult
+		for _, field := range splitQuoted(normalizeAuthSpacing(segment), ' ') {
+			eq := strings.Index(field, "=")
+			if eq <= 0 {
+				// "none", or garbage
+				continue
+			}
+			key, val := strings.ToLower(field[:eq]), unquoteAuthValue(field[eq+1:])
+			switch {
+			case key == "reason":
+				if result == nil {
+					return nil, fmt.Errorf("Reason before any method in %q", value)
+				}
+				result.Reason = val
+			case strings.Contains(key, "."):
+				if result != nil && authPTypes[key[:strings.Index(key, ".")]] {
+					result.Props[key] = val
+				}
+			case !strings.Contains(key, "."):
+				// methodspec, starts a new result
+				a.Results = append(a.Results, AuthResult{Version: 1, Props: make(map[string]string)})
+				result = &a.Results[len(a.Results)-1]
+				result.Method = key
+				result.Result = strings.ToLower(val)
+				if slash := strings.Index(key, "/"); slash >= 0 {
+					result.Method = strings.TrimSpace(key[:slash])
+					if v, err := strconv.Atoi(strings.TrimSpace(key[slash+1:])); err == nil {
+						result.Version = v
+					}
+				}
+			}
+		}
+	}
+
+	return a, nil
+}
+
+// authPTypes lists the ptypes of RFC 8601, properties of other ptypes are ignored
+var authPTypes = map[string]bool{"smtp": true, "header": true, "body": true, "policy": true}
+
+// stripAuthComments removes comments outside of quoted strings
+func stripAuthComments(value string) string {
+	out := make([]byte, 0, len(value))
+	quoted, depth := false, 0
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && (quoted || depth > 0):
+			if quoted && i+1 < len(value) {
+				out = append(out, c, value[i+1])
+			}
+			i++
+		case quoted:
+			quoted = c != '"'
+			out = append(out, c)
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+			out = append(out, ' ')
+		case depth > 0:
+		case c == '"':
+			quoted = true
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return string(out)
+}
+
+// normalizeAuthSpacing removes the white space allowed around "=" and "/"
+func normalizeAuthSpacing(segment string) string {
+	fields := splitQuoted(segment, ' ')
+	out := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if n := len(out); n > 0 && (f[0] == '=' || f[0] == '/' || openAuthField(out[n-1])) {
+			out[n-1] += f
+			continue
+		}
+		out = append(out, f)
+	}
+	return strings.Join(out, " ")
+}
+
+// openAuthField returns true if field is a key still waiting for its version or value, as
+// opposed to a value that happens to end in "=" or "/" like base64 does
+func openAuthField(field string) bool {
+	eq := strings.Index(field, "=")
+	return eq == len(field)-1 || (eq < 0 && strings.HasSuffix(field, "/"))
+}
+
+// splitQuoted splits value on sep outside of quoted strings, trimming white space and
+// dropping empty fields.  A space separator splits on any white space.
+func splitQuoted(value string, sep byte) []string {
+	fields := make([]string, 0, 4)
+	isSep := func(c byte) bool {
+		if sep == ' ' {
+			return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+		}
+		return c == sep
+	}
+	add := func(f string) {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	start, quoted := 0, false
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && isSep(c):
+			add(value[start:i])
+			start = i + 1
+		}
+	}
+	add(value[start:])
+	return fields
+}
+
+// unquoteAuthValue removes the quotes and escapes of a quoted-string value
+func unquoteAuthValue(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	value = value[1 : len(value)-1]
+	out := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		out = append(out, value[i])
+	}
+	return string(out)
+}
@@ -0,0 +1,85 @@
+package enmime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAuthResults(t *testing.T) {
+	a, err := ParseAuthResults(`example.com 1; dkim / 1 = pass (good signature) header.i=@example.org` +
+		` header.b="ab\"c=" x-vendor.score=5; spf=softfail smtp.mailfrom=x@example.org reason=relay` +
+		` iprev=pass policy.iprev=192.0.2.200`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "example.com", a.AuthServID)
+	assert.Equal(t, 1, a.Version)
+	assert.Equal(t, 0, a.Instance)
+	if assert.Equal(t, 3, len(a.Results)) {
+		assert.Equal(t, AuthResult{
+			Method:  "dkim",
+			Version: 1,
+			Result:  "pass",
+			Props:   map[string]string{"header.i": "@example.org", "header.b": `ab"c=`},
+		}, a.Results[0])
+		assert.Equal(t, "softfail", a.Results[1].Result)
+		assert.Equal(t, "relay", a.Results[1].Reason)
+		// Missing semicolon between results
+		assert.Equal(t, "iprev", a.Results[2].Method)
+		assert.Equal(t, "192.0.2.200", a.Results[2].Props["policy.iprev"])
+	}
+	assert.Nil(t, a.Result("dmarc"))
+
+	a, err = ParseAuthResults("(comment) example.org; none")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "example.org", a.AuthServID)
+		assert.Equal(t, 0, len(a.Results))
+	}
+
+	a, err = ParseARCAuthResults("i=2; example.org; dmarc=pass header.from=example.com")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, a.Instance)
+		assert.Equal(t, "example.org", a.AuthServID)
+		assert.Equal(t, "example.com", a.Result("DMARC").Props["header.from"])
+	}
+
+	_, err = ParseARCAuthResults("example.org; dmarc=pass")
+	assert.Error(t, err)
+	_, err = ParseAuthResults(" ")
+	assert.Error(t, err)
+
+	// A reason belongs to the result before it, not to a method of its own
+	_, err = ParseAuthResults("example.org; reason=\"forged\" spf=pass")
+	assert.Error(t, err)
+}
+
+func TestMIMEBodyAuthenticationResults(t *testing.T) {
+	msg := readMessage("authentication-results.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Equal(t, 2, len(mime.AuthenticationResults()))
+
+	trusted := mime.AuthenticationResults("MX.example.com")
+	if assert.Equal(t, 1, len(trusted)) {
+		a := trusted[0]
+		assert.Equal(t, "mx.example.com", a.AuthServID)
+		if assert.Equal(t, 4, len(a.Results)) {
+			assert.Equal(t, "bounce@lists.example.org", a.Result("spf").Props["smtp.mailfrom"])
+			assert.Equal(t, "AbC/dE+f", a.Result("dkim").Props["header.b"])
+			assert.Equal(t, "fail", a.Result("dmarc").Result)
+			assert.Equal(t, "From domain misaligned", a.Result("dmarc").Reason)
+			assert.Equal(t, "192.0.2.1", a.Result("arc").Props["smtp.remote-ip"])
+		}
+	}
+
+	arc := mime.ARCAuthenticationResults("lists.example.org")
+	if assert.Equal(t, 1, len(arc)) {
+		assert.Equal(t, 1, arc[0].Instance)
+		assert.Equal(t, "s2020", arc[0].Result("dkim").Props["header.s"])
+	}
+	assert.Equal(t, 0, len(mime.ARCAuthenticationResults("mx.example.com")))
+}
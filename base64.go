@@ -1,6 +1,7 @@
 package enmime
 
 import (
+	"encoding/base64"
 	"io"
 )
 
@@ -41,3 +42,71 @@ func (qp *Base64Cleaner) Read(p []byte) (n int, err error) {
 	//qp.count += int64(n)
 	return n, err
 }
+
+// Base64Encoder writes base64 encoded data in lines of 76 characters ended by CRLF, as
+// required by RFC 2045.  Close must be called to write the final line.
+type Base64Encoder struct {
+	enc  io.WriteCloser
+	line *lineWrapper
+}
+
+// NewBase64Encoder returns a Base64Encoder writing to w.  Base64Encoder implements the
+// io.WriteCloser interface.
+func NewBase64Encoder(w io.Writer) *Base64Encoder {
+	line := &lineWrapper{w: w, width: 76}
+	return &Base64Encoder{enc: base64.NewEncoder(base64.StdEncoding, line), line: line}
+}
+
+// Write method for io.Writer interface.
+func (e *Base64Encoder) Write(p []byte) (int, error) {
+	return e.enc.Write(p)
+}
+
+// Close flushes any partial block and ends the last line; it does not close the
+// underlying writer.
+func (e *Base64Encoder) Close() error {
+	if err := e.enc.Close(); err != nil {
+		return err
+	}
+	return e.line.end()
+}
+
+// lineWrapper breaks what is written to it into lines of width bytes
+type lineWrapper struct {
+	w     io.Writer
+	width int
+	col   int
+}
+
+// Write method for io.Writer interface.
+func (l *lineWrapper) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if l.col == l.width {
+			if err := l.end(); err != nil {
+				return written, err
+			}
+		}
+		n := l.width - l.col
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := l.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		l.col += n
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// end ends the current line, if it is not empty
+func (l *lineWrapper) end() error {
+	if l.col == 0 {
+		return nil
+	}
+	l.col = 0
+	_, err := l.w.Write([]byte("\r\n"))
+	return err
+}
@@ -2,6 +2,8 @@ package enmime
 
 import (
 	"bytes"
+	"encoding/base64"
+	"io/ioutil"
 	"strings"
 	"testing"
 
@@ -16,3 +18,33 @@ func TestBase64Cleaner(t *testing.T) {
 
 	assert.Equal(t, buf.String(), "ABC")
 }
+
+func TestBase64Encoder(t *testing.T) {
+	data := bytes.Repeat([]byte{0, 1, 2, 0xfe, 0xff}, 100)
+	buf := new(bytes.Buffer)
+	enc := NewBase64Encoder(buf)
+	// Odd sized writes
+	for i := 0; i < len(data); i += 7 {
+		end := i + 7
+		if end > len(data) {
+			end = len(data)
+		}
+		enc.Write(data[i:end])
+	}
+	assert.NoError(t, enc.Close())
+
+	lines := strings.Split(buf.String(), "\r\n")
+	assert.Equal(t, "", lines[len(lines)-1], "Output should end with CRLF")
+	for _, line := range lines[:len(lines)-2] {
+		assert.Equal(t, 76, len(line))
+	}
+	decoded, err := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, NewBase64Cleaner(buf)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, data, decoded)
+	}
+
+	// Nothing is written for empty content
+	buf.Reset()
+	NewBase64Encoder(buf).Close()
+	assert.Equal(t, 0, buf.Len())
+}
@@ -0,0 +1,419 @@
+package enmime
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MailBuilder composes MIME messages.  Its methods return the builder so that calls may be
+// chained; errors, such as unreadable files, are reported by Build.  The structure of the
+// message follows from its content: an HTML body with inline parts becomes
+// multipart/related, text and HTML bodies multipart/alternative, and attachments
+// multipart/mixed.
+type MailBuilder struct {
+	from        *mail.Address
+	replyTo     *mail.Address
+	to, cc, bcc []*mail.Address
+	subject     string
+	date        time.Time
+	messageID   string
+	header      textproto.MIMEHeader
+	text, html  *string
+	attachments []builderFile
+	inlines     []builderFile
+	err         error
+}
+
+// builderFile is an attachment or inline part added to a MailBuilder
+type builderFile struct {
+	content                []byte
+	contentType, fileName  string
+	disposition, contentID string
+}
+
+// NewMailBuilder returns an empty MailBuilder
+func NewMailBuilder() *MailBuilder {
+	return &MailBuilder{header: make(textproto.MIMEHeader)}
+}
+
+// From sets the author of the message
+func (b *MailBuilder) From(name, address string) *MailBuilder {
+	b.from = &mail.Address{Name: name, Address: address}
+	return b
+}
+
+// ReplyTo sets the address replies should be sent to
+func (b *MailBuilder) ReplyTo(name, address string) *MailBuilder {
+	b.replyTo = &mail.Address{Name: name, Address: address}
+	return b
+}
+
+// To adds a primary recipient
+func (b *MailBuilder) To(name, address string) *MailBuilder {
+	b.to = append(b.to, &mail.Address{Name: name, Address: address})
+	return b
+}
+
+// Cc adds a carbon copy recipient
+func (b *MailBuilder) Cc(name, address string) *MailBuilder {
+	b.cc = append(b.cc, &mail.Address{Name: name, Address: address})
+	return b
+}
+
+// Bcc adds a blind carbon copy recipient, which is returned by Recipients but does not
+// appear in the message
+func (b *MailBuilder) Bcc(name, address string) *MailBuilder {
+	b.bcc = append(b.bcc, &mail.Address{Name: name, Address: address})
+	return b
+}
+
+// Subject sets the subject, which may contain any Unicode characters
+func (b *MailBuilder) Subject(subject string) *MailBuilder {
+	b.subject = subject
+	return b
+}
+
+// Date sets the origination date; the time Build is called if not set
+func (b *MailBuilder) Date(date time.Time) *MailBuilder {
+	b.date = date
+	return b
+}
+
+// MessageID sets the Message-ID, without angle brackets; one is generated if not set
+func (b *MailBuilder) MessageID(id string) *MailBuilder {
+	if strings.ContainsAny(id, "\r\n") {
+		if b.err == nil {
+			b.err = fmt.Errorf("Invalid Message-ID %q", id)
+		}
+		return b
+	}
+	b.messageID = strings.Trim(id, "<>")
+	return b
+}
+
+// Header adds a header field to the message.  Fields the builder manages, such as From or
+// Content-Type, are ignored.  Values are folded as needed, so they may not contain line
+// breaks.
+func (b *MailBuilder) Header(name, value string) *MailBuilder {
+	var err error
+	switch {
+	case !validHeaderName(name):
+		err = fmt.Errorf("Invalid header name %q", name)
+	case strings.ContainsAny(value, "\r\n"):
+		err = fmt.Errorf("Invalid value %q for header %v", value, name)
+	}
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return b
+	}
+	b.header.Add(name, value)
+	return b
+}
+
+// validHeaderName returns true if name is a valid header field name
+func validHeaderName(name string) bool {
+	return name != "" &&
+		strings.IndexFunc(name, func(r rune) bool { return r <= ' ' || r > '~' || r == ':' }) < 0
+}
+
+// Text sets the plain text body
+func (b *MailBuilder) Text(text string) *MailBuilder {
+	b.text = &text
+	return b
+}
+
+// Html sets the HTML body
+func (b *MailBuilder) Html(html string) *MailBuilder {
+	b.html = &html
+	return b
+}
+
+// AddAttachment adds an attachment with the given content; contentType is guessed from
+// fileName if empty
+func (b *MailBuilder) AddAttachment(content []byte, contentType, fileName string) *MailBuilder {
+	b.attachments = append(b.attachments, builderFile{content, contentType, fileName, "attachment", ""})
+	return b
+}
+
+// AddFileAttachment adds the file at path as an attachment
+func (b *MailBuilder) AddFileAttachment(path string) *MailBuilder {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return b
+	}
+	return b.AddAttachment(content, "", filepath.Base(path))
+}
+
+// AddInline adds a part to be displayed within the HTML body, which refers to it by the
+// URL cid:contentID; contentType is guessed from fileName if empty
+func (b *MailBuilder) AddInline(content []byte, contentType, fileName, contentID string) *MailBuilder {
+	b.inlines = append(b.inlines, builderFile{content, contentType, fileName, "inline",
+		strings.Trim(contentID, "<>")})
+	return b
+}
+
+// AddFileInline adds the file at path as an inline part, see AddInline
+func (b *MailBuilder) AddFileInline(path, contentID string) *MailBuilder {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return b
+	}
+	return b.AddInline(content, "", filepath.Base(path), contentID)
+}
+
+// Recipients returns the addresses of all the recipients, including Bcc
+func (b *MailBuilder) Recipients() []string {
+	var addrs []string
+	for _, list := range [][]*mail.Address{b.to, b.cc, b.bcc} {
+		for _, a := range list {
+			addrs = append(addrs, a.Address)
+		}
+	}
+	return addrs
+}
+
+// Build checks the message and returns it as a tree of MIMEParts, whose root holds the
+// header of the message
+func (b *MailBuilder) Build() (MIMEPart, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.from == nil || b.from.Address == "" {
+		return nil, fmt.Errorf("Message has no From address")
+	}
+	if len(b.to)+len(b.cc)+len(b.bcc) == 0 {
+		return nil, fmt.Errorf("Message has no recipients")
+	}
+
+	// Bodies, the HTML one grouped with its inline parts
+	inlines := make([]*memMIMEPart, len(b.inlines))
+	for i, f := range b.inlines {
+		inlines[i] = f.part()
+	}
+	var body *memMIMEPart
+	var html *memMIMEPart
+	var err error
+	if b.html != nil {
+		html = newTextPart("text/html", *b.html)
+		if len(inlines) > 0 {
+			html, err = newMultipart("multipart/related", map[string]string{"type": "text/html"},
+				append([]*memMIMEPart{html}, inlines...)...)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	switch {
+	case b.text != nil && html != nil:
+		body, err = newMultipart("multipart/alternative", nil, newTextPart("text/plain", *b.text), html)
+		if err != nil {
+			return nil, err
+		}
+	case html != nil:
+		body = html
+	case b.text != nil:
+		body = newTextPart("text/plain", *b.text)
+	}
+
+	var others []*memMIMEPart
+	if b.html == nil {
+		// Without an HTML body to refer to them, inlines are shown after the text
+		others = inlines
+	}
+	for _, f := range b.attachments {
+		others = append(others, f.part())
+	}
+	root := body
+	switch {
+	case len(others) > 0 && body != nil:
+		root, err = newMultipart("multipart/mixed", nil, append([]*memMIMEPart{body}, others...)...)
+	case len(others) > 0:
+		root, err = newMultipart("multipart/mixed", nil, others...)
+	case body == nil:
+		root = newTextPart("text/plain", "")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Message header
+	h := root.header
+	date := b.date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	h.Set("Date", date.Format(time.RFC1123Z))
+	h.Set("From", EncodeAddress(b.from))
+	if b.replyTo != nil {
+		h.Set("Reply-To", EncodeAddress(b.replyTo))
+	}
+	if len(b.to) > 0 {
+		h.Set("To", formatAddressList(b.to))
+	}
+	if len(b.cc) > 0 {
+		h.Set("Cc", formatAddressList(b.cc))
+	}
+	if b.subject != "" {
+		h.Set("Subject", EncodeHeader(b.subject))
+	}
+	id := b.messageID
+	if id == "" {
+		token, err := randomToken()
+		if err != nil {
+			return nil, err
+		}
+		domain := b.from.Address[strings.LastIndex(b.from.Address, "@")+1:]
+		id = token + "@" + domain
+	}
+	h.Set("Message-ID", "<"+id+">")
+	h.Set("MIME-Version", "1.0")
+	for name, values := range b.header {
+		if builderManaged[name] || strings.HasPrefix(name, "Content-") {
+			continue
+		}
+		for _, v := range values {
+			h.Add(name, EncodeHeaderField(name, v))
+		}
+	}
+
+	return root, nil
+}
+
+// WriteTo builds the message and writes it to w with CRLF line breaks
+func (b *MailBuilder) WriteTo(w io.Writer) (int64, error) {
+	root, err := b.Build()
+	if err != nil {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	if err := encodePart(&buf, root, false); err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
+
+// Bytes builds the message and returns it, see WriteTo
+func (b *MailBuilder) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// builderManaged lists the header fields MailBuilder.Header may not set
+var builderManaged = map[string]bool{
+	"Date": true, "From": true, "Reply-To": true, "To": true, "Cc": true, "Bcc": true,
+	"Subject": true, "Message-Id": true, "Mime-Version": true,
+}
+
+// newTextPart returns a UTF-8 text part
+func newTextPart(mediatype, text string) *memMIMEPart {
+	p := NewMIMEPart(nil, mediatype)
+	p.content = []byte(text)
+	p.header = make(textproto.MIMEHeader)
+	p.header.Set("Content-Type", mediatype+"; charset=utf-8")
+	p.header.Set("Content-Transfer-Encoding", SelectTransferEncoding(p.content, true))
+	return p
+}
+
+// part returns a base64 encoded part holding the file
+func (f builderFile) part() *memMIMEPart {
+	content, contentType, fileName := f.content, f.contentType, f.fileName
+	disposition, contentID := f.disposition, f.contentID
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(fileName))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+	mediatype, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediatype, params = "application/octet-stream", nil
+	}
+	p := NewMIMEPart(nil, mediatype)
+	p.content = content
+	p.disposition = disposition
+	p.fileName = fileName
+	p.header = make(textproto.MIMEHeader)
+	if fileName != "" {
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params["name"] = fileName
+		p.header.Set("Content-Disposition", mime.FormatMediaType(disposition,
+			map[string]string{"filename": fileName}))
+	} else {
+		p.header.Set("Content-Disposition", disposition)
+	}
+	p.header.Set("Content-Type", mime.FormatMediaType(mediatype, params))
+	p.header.Set("Content-Transfer-Encoding", "base64")
+	if contentID != "" {
+		p.header.Set("Content-ID", "<"+contentID+">")
+	}
+	return p
+}
+
+// newMultipart returns a multipart part with a random boundary holding children; params
+// are added to its Content-Type
+func newMultipart(mediatype string, params map[string]string, children ...*memMIMEPart) (*memMIMEPart, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	p := NewMIMEPart(nil, mediatype)
+	p.header = make(textproto.MIMEHeader)
+	if params == nil {
+		params = make(map[string]string)
+	}
+	params["boundary"] = "enmime-" + token
+	p.header.Set("Content-Type", mime.FormatMediaType(mediatype, params))
+	var prev *memMIMEPart
+	for _, c := range children {
+		c.parent = p
+		if prev == nil {
+			p.firstChild = c
+		} else {
+			prev.nextSibling = c
+		}
+		prev = c
+	}
+	return p, nil
+}
+
+// formatAddressList formats addresses for an address header, one per line if there are
+// several
+func formatAddressList(addrs []*mail.Address) string {
+	s := make([]string, len(addrs))
+	for i, a := range addrs {
+		s[i] = EncodeAddress(a)
+	}
+	return strings.Join(s, ",\r\n ")
+}
+
+// randomToken returns a random string usable in boundaries and Message-IDs
+func randomToken() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Error generating random token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,176 @@
+package enmime
+
+import (
+	"bytes"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// parseBuilt parses a message written by a MailBuilder
+func parseBuilt(t *testing.T, b *MailBuilder) (*MIMEBody, []byte) {
+	raw, err := b.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read built message: %v\n%s", err, raw)
+	}
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse built message: %v\n%s", err, raw)
+	}
+	return mime, raw
+}
+
+func TestBuilderTextOnly(t *testing.T) {
+	date := time.Date(2026, 10, 18, 18, 0, 0, 0, time.UTC)
+	b := NewMailBuilder().
+		From("Joe Sender", "joe@example.net").
+		To("", "jane@example.org").
+		Subject("Plain hello").
+		Date(date).
+		Text("Hello Jane,\n\nJust text.\n")
+	mime, raw := parseBuilt(t, b)
+
+	assert.True(t, bytes.HasPrefix(raw, []byte("Date: Sun, 18 Oct 2026 18:00:00 +0000\r\n")))
+	assert.NotContains(t, strings.Replace(string(raw), "\r\n", "", -1), "\n")
+	assert.Nil(t, mime.Root)
+	assert.Equal(t, "Hello Jane,\r\n\r\nJust text.\r\n", mime.Text)
+	assert.Equal(t, "Plain hello", mime.GetHeader("Subject"))
+	assert.Equal(t, "Joe Sender <joe@example.net>", mime.GetHeader("From"))
+	assert.Equal(t, "jane@example.org", mime.GetHeader("To"))
+	assert.True(t, strings.HasSuffix(mime.GetHeader("Message-ID"), "@example.net>"))
+	assert.Equal(t, "1.0", mime.GetHeader("MIME-Version"))
+}
+
+func TestBuilderFullMessage(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nnot really an image")
+	b := NewMailBuilder().
+		From("Jöe Sender", "joe@example.net").
+		To("Jane Recipient", "jane@example.org").
+		To("", "jim@example.org").
+		Cc("Carl", "carl@example.org").
+		Bcc("Hidden", "hidden@example.org").
+		ReplyTo("", "replies@example.net").
+		Subject("Café menu – Thursday").
+		Header("X-Campaign", "fall").
+		Header("Subject", "ignored").
+		Text("See the menu below – bon appétit!\n").
+		Html("<p>See the menu: <img src=\"cid:logo@example.net\"></p>").
+		AddInline(png, "image/png", "logo.png", "<logo@example.net>").
+		AddAttachment([]byte("soup,5\nsalad,7\n"), "", "menü.csv")
+	mime, raw := parseBuilt(t, b)
+
+	assert.Equal(t, "multipart/mixed", mime.Root.ContentType())
+	alt := mime.Root.FirstChild()
+	assert.Equal(t, "multipart/alternative", alt.ContentType())
+	assert.Equal(t, "text/plain", alt.FirstChild().ContentType())
+	related := alt.FirstChild().NextSibling()
+	assert.Equal(t, "multipart/related", related.ContentType())
+	assert.Equal(t, "text/html", related.FirstChild().ContentType())
+
+	assert.Equal(t, "See the menu below – bon appétit!\r\n", mime.Text)
+	assert.Equal(t, "<p>See the menu: <img src=\"cid:logo@example.net\"></p>", mime.Html)
+	if assert.Equal(t, 1, len(mime.Inlines)) {
+		p := mime.Inlines[0]
+		assert.Equal(t, "image/png", p.ContentType())
+		assert.Equal(t, "logo.png", p.FileName())
+		assert.Equal(t, "<logo@example.net>", p.Header().Get("Content-ID"))
+		assert.Equal(t, png, p.Content())
+	}
+	if assert.Equal(t, 1, len(mime.Attachments)) {
+		p := mime.Attachments[0]
+		assert.Equal(t, "text/csv", p.ContentType())
+		assert.Equal(t, "menü.csv", p.FileName())
+		assert.Equal(t, "soup,5\nsalad,7\n", string(p.Content()))
+	}
+
+	assert.Equal(t, "Café menu – Thursday", mime.GetHeader("Subject"))
+	from, _ := mime.AddressList("From")
+	if assert.Equal(t, 1, len(from)) {
+		assert.Equal(t, "Jöe Sender", from[0].Name)
+	}
+	to, _ := mime.AddressList("To")
+	assert.Equal(t, 2, len(to))
+	assert.Equal(t, "fall", mime.GetHeader("X-Campaign"))
+	assert.NotContains(t, string(raw), "hidden@example.org")
+	assert.NotContains(t, string(raw), "ignored")
+	assert.Equal(t, []string{"jane@example.org", "jim@example.org", "carl@example.org",
+		"hidden@example.org"}, b.Recipients())
+}
+
+func TestBuilderStructure(t *testing.T) {
+	// HTML only
+	mime, _ := parseBuilt(t, NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		Html("<b>Hi</b>"))
+	assert.Nil(t, mime.Root)
+	assert.Equal(t, "<b>Hi</b>", mime.Html)
+
+	// Inline parts without HTML are shown after the text
+	mime, _ = parseBuilt(t, NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		Text("Hi").AddInline([]byte("GIF89a"), "", "dot.gif", "dot"))
+	if assert.NotNil(t, mime.Root) {
+		assert.Equal(t, "multipart/mixed", mime.Root.ContentType())
+	}
+	assert.Equal(t, "Hi", mime.Text)
+	if assert.Equal(t, 1, len(mime.Inlines)) {
+		assert.Equal(t, "image/gif", mime.Inlines[0].ContentType())
+	}
+
+	// Attachment from a file
+	path := filepath.Join("test-data", "mail", "non-mime.raw")
+	content, _ := os.ReadFile(path)
+	mime, _ = parseBuilt(t, NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		AddFileAttachment(path))
+	if assert.Equal(t, 1, len(mime.Attachments)) {
+		assert.Equal(t, "non-mime.raw", mime.Attachments[0].FileName())
+		assert.Equal(t, content, mime.Attachments[0].Content())
+	}
+
+	// No content at all
+	mime, _ = parseBuilt(t, NewMailBuilder().From("", "a@example.net").To("", "b@example.net"))
+	assert.Equal(t, "", mime.Text)
+
+	// Long lines are quoted-printable
+	long := strings.Repeat("word ", 250)
+	mime, raw := parseBuilt(t, NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		Text(long))
+	assert.Contains(t, string(raw), "Content-Transfer-Encoding: quoted-printable")
+	assert.Equal(t, long, mime.Text)
+}
+
+func TestBuilderErrors(t *testing.T) {
+	_, err := NewMailBuilder().To("", "b@example.net").Build()
+	assert.Error(t, err, "missing From")
+	_, err = NewMailBuilder().From("", "a@example.net").Build()
+	assert.Error(t, err, "missing recipients")
+	_, err = NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		AddFileAttachment(filepath.Join("test-data", "missing")).Build()
+	assert.Error(t, err, "missing file")
+	_, err = NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		Header("X-Bad\r\nBcc", "x").Build()
+	assert.Error(t, err, "invalid header name")
+	_, err = NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		MessageID("<id@x>\r\nX-Evil: 1").Bytes()
+	assert.Error(t, err, "line break in Message-ID")
+	_, err = NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		Header("References", "<x@y>\r\nBcc: evil@example.org").Bytes()
+	assert.Error(t, err, "line break in header value")
+	_, err = NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		Header("X-Note", "one\ntwo").Bytes()
+	assert.Error(t, err, "bare LF in header value")
+
+	// Values cannot inject header fields
+	raw, err := NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		Subject("Hi\r\nBcc: evil@example.com").Bytes()
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(raw), "\r\nBcc:")
+	}
+}
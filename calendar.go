@@ -0,0 +1,280 @@
+package enmime
+
+import (
+	"fmt"
+	"mime"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CalendarAddress is an organizer or attendee of a CalendarEvent
+type CalendarAddress struct {
+	Address  string // Email address, without the mailto: prefix
+	Name     string // Common name (CN parameter)
+	Role     string // Participation role, such as REQ-PARTICIPANT or CHAIR
+	PartStat string // Participation status, such as NEEDS-ACTION or ACCEPTED
+	RSVP     bool   // True if a reply is expected
+}
+
+// CalendarEvent is a VEVENT found in an iCalendar (RFC 5545) object.  Method is taken
+// from the enclosing VCALENDAR and describes the iMIP (RFC 6047) transaction, such as
+// REQUEST, REPLY or CANCEL.
+type CalendarEvent struct {
+	Method      string
+	UID         string
+	Sequence    int
+	Status      string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time // Start of the event, in the time zone it was specified in
+	End         time.Time // End of the event, from DTEND or DURATION; may be zero
+	AllDay      bool      // True if Start and End are dates rather than date-times
+	Floating    bool      // True if Start is a local time without a zone, returned in UTC
+	Organizer   *CalendarAddress
+	Attendees   []CalendarAddress
+}
+
+// isCalendarPart returns true if the part holds an iCalendar object
+func isCalendarPart(p MIMEPart) bool {
+	switch p.ContentType() {
+	case "text/calendar", "application/ics":
+		return true
+	}
+	return strings.HasSuffix(strings.ToLower(p.FileName()), ".ics")
+}
+
+// CalendarEvents locates the text/calendar parts and .ics attachments of the message and
+// returns the events they contain.  Invitations commonly carry the same event both inline
+// and as an attachment, so events with the same UID and sequence are only returned once.
+// Parts that cannot be parsed are skipped and returned as errors.
+func (m *MIMEBody) CalendarEvents() ([]CalendarEvent, []*PartError) {
+	var parts []MIMEPart
+	if m.Root == nil {
+		mediatype, _, _ := mime.ParseMediaType(m.header.Get("Content-Type"))
+		if mediatype == "text/calendar" || mediatype == "application/ics" {
+			parts = append(parts, nil)
+		}
+	} else {
+		parts = BreadthMatchAll(m.Root, isCalendarPart)
+	}
+
+	events := make([]CalendarEvent, 0, len(parts))
+	var errs []*PartError
+	seen := make(map[string]bool)
+	for _, p := range parts {
+		data := []byte(m.Text)
+		if p != nil {
+			var err error
+			if data, err = contentText(p); err != nil {
+				errs = append(errs, &PartError{Part: p, Err: fmt.Errorf("Error decoding calendar: %v", err)})
+				continue
+			}
+		}
+		found, err := ParseCalendar(data)
+		if err != nil {
+			errs = append(errs, &PartError{Part: p, Err: err})
+			continue
+		}
+		for _, e := range found {
+			key := e.UID + "\x00" + strconv.Itoa(e.Sequence) + "\x00" + e.Start.String()
+			if !seen[key] {
+				seen[key] = true
+				events = append(events, e)
+			}
+		}
+	}
+
+	return events, errs
+}
+
+// ParseCalendar parses the VCALENDAR objects in data and returns their events
+func ParseCalendar(data []byte) ([]CalendarEvent, error) {
+	components, err := parseContentComponents(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing calendar: %v", err)
+	}
+
+	events := make([]CalendarEvent, 0, 1)
+	for _, cal := range components {
+		if cal.name != "VCALENDAR" {
+			continue
+		}
+		method := strings.ToUpper(cal.propValue("METHOD"))
+		for _, c := range cal.components {
+			if c.name != "VEVENT" {
+				continue
+			}
+			e, err := parseCalendarEvent(cal, c)
+			if err != nil {
+				return nil, err
+			}
+			e.Method = method
+			events = append(events, *e)
+		}
+	}
+
+	return events, nil
+}
+
+// parseCalendarEvent converts a VEVENT component into a CalendarEvent
+func parseCalendarEvent(cal, c *contentComponent) (*CalendarEvent, error) {
+	e := &CalendarEvent{
+		UID:         c.propValue("UID"),
+		Status:      strings.ToUpper(c.propValue("STATUS")),
+		Summary:     c.propValue("SUMMARY"),
+		Description: c.propValue("DESCRIPTION"),
+		Location:    c.propValue("LOCATION"),
+	}
+	if seq := c.propValue("SEQUENCE"); seq != "" {
+		n, err := strconv.Atoi(strings.TrimSpace(seq))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid SEQUENCE %q in event %v", seq, e.UID)
+		}
+		e.Sequence = n
+	}
+
+	if p := c.prop("DTSTART"); p != nil {
+		start, allDay, floating, err := parseCalendarTime(cal, p)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid DTSTART in event %v: %v", e.UID, err)
+		}
+		e.Start = start
+		e.AllDay = allDay
+		e.Floating = floating
+	}
+	if p := c.prop("DTEND"); p != nil {
+		end, _, _, err := parseCalendarTime(cal, p)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid DTEND in event %v: %v", e.UID, err)
+		}
+		e.End = end
+	} else if p := c.prop("DURATION"); p != nil && !e.Start.IsZero() {
+		d, err := parseCalendarDuration(p.value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid DURATION in event %v: %v", e.UID, err)
+		}
+		e.End = e.Start.Add(d)
+	}
+
+	if p := c.prop("ORGANIZER"); p != nil {
+		org := parseCalendarAddress(p)
+		e.Organizer = &org
+	}
+	for _, p := range c.allProps("ATTENDEE") {
+		e.Attendees = append(e.Attendees, parseCalendarAddress(p))
+	}
+
+	return e, nil
+}
+
+// parseCalendarAddress converts an ORGANIZER or ATTENDEE property
+func parseCalendarAddress(p *contentLine) CalendarAddress {
+	addr := strings.TrimSpace(p.value)
+	if strings.HasPrefix(strings.ToLower(addr), "mailto:") {
+		addr = addr[len("mailto:"):]
+	}
+	return CalendarAddress{
+		Address:  addr,
+		Name:     p.param("CN"),
+		Role:     strings.ToUpper(p.param("ROLE")),
+		PartStat: strings.ToUpper(p.param("PARTSTAT")),
+		RSVP:     strings.EqualFold(p.param("RSVP"), "TRUE"),
+	}
+}
+
+// parseCalendarTime parses a DATE or DATE-TIME property.  UTC times end in Z; otherwise
+// the TZID parameter names the zone, which is looked up in the system zone database and
+// then in the VTIMEZONE components of the calendar.  Floating times, which have neither,
+// are returned in UTC.  The second and third return values are true for dates and floating
+// times.
+func parseCalendarTime(cal *contentComponent, p *contentLine) (time.Time, bool, bool, error) {
+	value := strings.TrimSpace(p.value)
+	if strings.EqualFold(p.param("VALUE"), "DATE") || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, time.UTC)
+		return t, true, false, err
+	}
+
+	loc, floating := time.UTC, false
+	if strings.HasSuffix(value, "Z") {
+		value = value[:len(value)-1]
+	} else if tzid := p.param("TZID"); tzid != "" {
+		loc = calendarLocation(cal, tzid)
+	} else {
+		floating = true
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, floating, err
+}
+
+// calendarLocation resolves a TZID, falling back on the standard time offset declared by a
+// VTIMEZONE when the name is not known to the system (as is the case for the Windows zone
+// names used by Outlook).  Daylight saving rules of such zones are not applied.
+func calendarLocation(cal *contentComponent, tzid string) *time.Location {
+	if loc, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+		return loc
+	}
+	for _, tz := range cal.components {
+		if tz.name != "VTIMEZONE" || tz.propValue("TZID") != tzid {
+			continue
+		}
+		for _, rule := range tz.components {
+			if rule.name != "STANDARD" {
+				continue
+			}
+			if offset, ok := parseUTCOffset(rule.propValue("TZOFFSETTO")); ok {
+				return time.FixedZone(tzid, offset)
+			}
+		}
+	}
+	return time.UTC
+}
+
+// parseUTCOffset parses an iCalendar UTC-OFFSET such as -0500 or +013000 into seconds
+func parseUTCOffset(value string) (int, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) != 5 && len(value) != 7 {
+		return 0, false
+	}
+	sign := 1
+	switch value[0] {
+	case '-':
+		sign = -1
+	case '+':
+	default:
+		return 0, false
+	}
+	digits := value[1:] + "00"
+	h, err1 := strconv.Atoi(digits[0:2])
+	m, err2 := strconv.Atoi(digits[2:4])
+	s, err3 := strconv.Atoi(digits[4:6])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, false
+	}
+	return sign * (h*3600 + m*60 + s), true
+}
+
+var calendarDurationRegexp = regexp.MustCompile(
+	`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseCalendarDuration parses an iCalendar DURATION such as P1DT2H30M or -PT15M
+func parseCalendarDuration(value string) (time.Duration, error) {
+	match := calendarDurationRegexp.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil || value == "P" || value == "PT" {
+		return 0, fmt.Errorf("Malformed duration %q", value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if match[i+2] != "" {
+			n, _ := strconv.Atoi(match[i+2])
+			d += time.Duration(n) * unit
+		}
+	}
+	if match[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
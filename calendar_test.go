@@ -0,0 +1,158 @@
+package enmime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendarEvents(t *testing.T) {
+	msg := readMessage("calendar-invite.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	events, errs := mime.CalendarEvents()
+	if !assert.Nil(t, errs, "Parsing calendar should not have generated an error") {
+		t.FailNow()
+	}
+	// The inline part and .ics attachment carry the same event
+	if !assert.Equal(t, 1, len(events), "Should have a single event") {
+		t.FailNow()
+	}
+
+	e := events[0]
+	assert.Equal(t, "REQUEST", e.Method)
+	assert.Equal(t, "040000008200E00074C5B7101A82E00800000000", e.UID)
+	assert.Equal(t, 1, e.Sequence)
+	assert.Equal(t, "CONFIRMED", e.Status)
+	assert.Equal(t, "Project review, phase 2", e.Summary)
+	assert.Equal(t, "Agenda:\n- Status\n- Next steps", e.Description)
+	assert.Equal(t, "Room 1", e.Location)
+	assert.False(t, e.AllDay)
+
+	// Outlook zone names resolve through the VTIMEZONE
+	assert.True(t, e.Start.Equal(time.Date(2013, 12, 3, 9, 0, 0, 0, time.UTC)), "Start was %v", e.Start)
+	assert.Equal(t, 90*time.Minute, e.End.Sub(e.Start))
+	_, offset := e.Start.Zone()
+	assert.Equal(t, 3600, offset)
+
+	if assert.NotNil(t, e.Organizer) {
+		assert.Equal(t, "jamehi03@jamehi03lx.noa.com", e.Organizer.Address)
+		assert.Equal(t, "Hillyerd, James", e.Organizer.Name)
+	}
+	if assert.Equal(t, 2, len(e.Attendees)) {
+		assert.Equal(t, CalendarAddress{Address: "greg@inbucket.com", Name: "Greg",
+			Role: "REQ-PARTICIPANT", PartStat: "NEEDS-ACTION", RSVP: true}, e.Attendees[0])
+		assert.Equal(t, "room1@inbucket.com", e.Attendees[1].Address)
+		assert.Equal(t, "ACCEPTED", e.Attendees[1].PartStat)
+		assert.False(t, e.Attendees[1].RSVP)
+	}
+}
+
+func TestCalendarEventsNone(t *testing.T) {
+	msg := readMessage("html-mime-inline.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	events, errs := mime.CalendarEvents()
+	assert.Nil(t, errs)
+	assert.Equal(t, 0, len(events))
+}
+
+func TestCalendarEventsPartErrors(t *testing.T) {
+	good := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:a\r\nDTSTART:20130603T080000Z\r\n" +
+		"END:VEVENT\r\nEND:VCALENDAR\r\n"
+	bad := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:tomorrow\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	mime, _ := parseBuilt(t, NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		AddAttachment([]byte(bad), "text/calendar", "bad.ics").
+		AddAttachment([]byte(good), "text/calendar", "good.ics"))
+
+	// The bad part does not hide the events of the others
+	events, errs := mime.CalendarEvents()
+	if assert.Equal(t, 1, len(events)) {
+		assert.Equal(t, "a", events[0].UID)
+	}
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "bad.ics", errs[0].Part.FileName())
+		assert.Contains(t, errs[0].Error(), `"bad.ics"`)
+	}
+}
+
+func TestCalendarEventsCharset(t *testing.T) {
+	// Latin-1 .ics sent as application/octet-stream, like the vCard in vcard-attachments.raw
+	ics := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:a\r\nDTSTART:20130603T080000Z\r\n" +
+		"SUMMARY:R\xe9union\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	mime, _ := parseBuilt(t, NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		AddAttachment([]byte(ics), "application/octet-stream; charset=iso-8859-1", "invite.ics"))
+
+	events, errs := mime.CalendarEvents()
+	assert.Nil(t, errs)
+	if assert.Equal(t, 1, len(events)) {
+		assert.Equal(t, "Réunion", events[0].Summary)
+	}
+}
+
+func TestParseCalendarTimes(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\nMETHOD:CANCEL\r\n" +
+		"BEGIN:VEVENT\r\nUID:a\r\nDTSTART:20130603T080000Z\r\nDURATION:PT1H30M\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:b\r\nDTSTART;TZID=Europe/Paris:20130603T100000\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:c\r\nDTSTART;VALUE=DATE:20130603\r\nDTEND;VALUE=DATE:20130604\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:d\r\nDTSTART:20130603T100000\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	events, err := ParseCalendar([]byte(data))
+	if !assert.Nil(t, err) || !assert.Equal(t, 4, len(events)) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, "CANCEL", events[0].Method)
+	assert.True(t, events[0].Start.Equal(time.Date(2013, 6, 3, 8, 0, 0, 0, time.UTC)))
+	assert.True(t, events[0].End.Equal(time.Date(2013, 6, 3, 9, 30, 0, 0, time.UTC)))
+
+	assert.True(t, events[1].Start.Equal(time.Date(2013, 6, 3, 8, 0, 0, 0, time.UTC)),
+		"Paris is UTC+2 in June, start was %v", events[1].Start)
+
+	assert.True(t, events[2].AllDay)
+	assert.Equal(t, 24*time.Hour, events[2].End.Sub(events[2].Start))
+	assert.False(t, events[2].Floating)
+
+	// Floating times have no zone
+	assert.True(t, events[3].Floating)
+	assert.False(t, events[0].Floating || events[1].Floating)
+	assert.True(t, events[3].Start.Equal(time.Date(2013, 6, 3, 10, 0, 0, 0, time.UTC)))
+}
+
+func TestParseCalendarErrors(t *testing.T) {
+	_, err := ParseCalendar([]byte("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VCALENDAR\r\n"))
+	assert.NotNil(t, err, "Mismatched END should fail")
+
+	_, err = ParseCalendar([]byte("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:tomorrow\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"))
+	assert.NotNil(t, err, "Malformed DTSTART should fail")
+}
+
+func TestParseCalendarDuration(t *testing.T) {
+	var testTable = []struct {
+		input  string
+		expect time.Duration
+	}{
+		{"PT15M", 15 * time.Minute},
+		{"-PT15M", -15 * time.Minute},
+		{"P1DT2H", 26 * time.Hour},
+		{"P2W", 14 * 24 * time.Hour},
+		{"PT1H0M30S", time.Hour + 30*time.Second},
+	}
+
+	for _, tt := range testTable {
+		result, err := parseCalendarDuration(tt.input)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expect, result, "Wrong duration for input %q", tt.input)
+	}
+
+	_, err := parseCalendarDuration("1H")
+	assert.NotNil(t, err)
+}
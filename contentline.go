@@ -0,0 +1,279 @@
+package enmime
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// iCalendar (RFC 5545) and vCard (RFC 6350) share a line oriented "content line" syntax:
+//
+//   [group "."] name *(";" param "=" value *("," value)) ":" value
+//
+// Long lines are folded by inserting a line break followed by a space or tab.  Objects
+// are delimited by BEGIN:<name> and END:<name> lines, and may be nested.
+
+// PartError records a part of the message whose iCalendar or vCard objects could not be
+// parsed
+type PartError struct {
+	Part MIMEPart // nil for the body of a non-multipart message
+	Err  error
+}
+
+func (e *PartError) Error() string {
+	if e.Part == nil {
+		return fmt.Sprintf("Error in the message body: %v", e.Err)
+	}
+	return fmt.Sprintf("Error in %v part %q: %v", e.Part.ContentType(), e.Part.FileName(), e.Err)
+}
+
+// contentText returns the content of an iCalendar or vCard part as UTF-8 text.  Text parts
+// were converted when they were parsed; attachments sent as application/octet-stream are
+// converted here using the charset parameter of the part, if any.
+func contentText(p MIMEPart) ([]byte, error) {
+	if strings.HasPrefix(p.ContentType(), "text/") {
+		return p.Content(), nil
+	}
+	ctype := "text/plain"
+	if _, params, err := mime.ParseMediaType(p.Header().Get("Content-Type")); err == nil &&
+		params["charset"] != "" {
+		ctype += "; charset=" + params["charset"]
+	}
+	return decodeSection("", ctype, "text/plain", bytes.NewReader(p.Content()))
+}
+
+// contentLine is a single property of an iCalendar or vCard object
+type contentLine struct {
+	group  string              // vCard property group, if any
+	name   string              // Property name, upper case
+	params map[string][]string // Parameters keyed by upper case name
+	value  string              // Raw value, still escaped
+}
+
+// param returns the first value of the named parameter, or "" if it is not present
+func (l *contentLine) param(name string) string {
+	if values := l.params[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// hasParamValue returns true if the named parameter contains value, ignoring case
+func (l *contentLine) hasParamValue(name, value string) bool {
+	for _, v := range l.params[name] {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// contentComponent is a BEGIN/END delimited object such as VCALENDAR, VEVENT or VCARD
+type contentComponent struct {
+	name       string
+	props      []*contentLine
+	components []*contentComponent
+}
+
+// prop returns the first property with the given name, or nil
+func (c *contentComponent) prop(name string) *contentLine {
+	for _, p := range c.props {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// propValue returns the unescaped text value of the named property, or ""
+func (c *contentComponent) propValue(name string) string {
+	if p := c.prop(name); p != nil {
+		return unescapeContentText(p.value)
+	}
+	return ""
+}
+
+// allProps returns every property with the given name
+func (c *contentComponent) allProps(name string) []*contentLine {
+	props := make([]*contentLine, 0, 2)
+	for _, p := range c.props {
+		if p.name == name {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+// unfoldContentLines splits data into logical lines, joining folded continuation lines
+func unfoldContentLines(data string) []string {
+	data = strings.Replace(data, "\r\n", "\n", -1)
+	lines := make([]string, 0, strings.Count(data, "\n")+1)
+	var current strings.Builder // Logical line being unfolded
+	open := false
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && open {
+			current.WriteString(line[1:])
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if open {
+			lines = append(lines, current.String())
+			current.Reset()
+		}
+		current.WriteString(line)
+		open = true
+	}
+	if open {
+		lines = append(lines, current.String())
+	}
+	return lines
+}
+
+// parseContentLine parses a single unfolded content line
+func parseContentLine(line string) (*contentLine, error) {
+	l := &contentLine{params: make(map[string][]string)}
+
+	// Name, possibly prefixed with a group
+	end := strings.IndexAny(line, ";:")
+	if end <= 0 {
+		return nil, fmt.Errorf("Missing property name in content line %q", line)
+	}
+	l.name = strings.ToUpper(line[:end])
+	if dot := strings.LastIndex(l.name, "."); dot >= 0 {
+		l.group = line[:dot]
+		l.name = l.name[dot+1:]
+	}
+	pos := end
+
+	// Parameters, values may be quoted to protect ';', ':' and ','
+	for pos < len(line) && line[pos] == ';' {
+		pos++
+		eq := strings.IndexAny(line[pos:], "=;:")
+		if eq < 0 {
+			return nil, fmt.Errorf("Unterminated parameter in content line %q", line)
+		}
+		name := strings.ToUpper(line[pos : pos+eq])
+		pos += eq
+		if line[pos] != '=' {
+			// vCard 2.1 style bare parameter, such as ";WORK"
+			l.params["TYPE"] = append(l.params["TYPE"], name)
+			continue
+		}
+		pos++
+		for {
+			var value string
+			if pos < len(line) && line[pos] == '"' {
+				quote := strings.IndexByte(line[pos+1:], '"')
+				if quote < 0 {
+					return nil, fmt.Errorf("Unterminated quoted parameter in content line %q", line)
+				}
+				value = line[pos+1 : pos+1+quote]
+				pos += quote + 2
+			} else {
+				stop := strings.IndexAny(line[pos:], ",;:")
+				if stop < 0 {
+					return nil, fmt.Errorf("Missing value in content line %q", line)
+				}
+				value = line[pos : pos+stop]
+				pos += stop
+			}
+			l.params[name] = append(l.params[name], value)
+			if pos >= len(line) || line[pos] != ',' {
+				break
+			}
+			pos++
+		}
+	}
+
+	if pos >= len(line) || line[pos] != ':' {
+		return nil, fmt.Errorf("Missing value in content line %q", line)
+	}
+	l.value = line[pos+1:]
+	return l, nil
+}
+
+// parseContentComponents parses all top-level components found in data.  Properties
+// outside of any component are ignored.
+func parseContentComponents(data string) ([]*contentComponent, error) {
+	roots := make([]*contentComponent, 0, 1)
+	stack := make([]*contentComponent, 0, 4)
+
+	for _, line := range unfoldContentLines(data) {
+		l, err := parseContentLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch l.name {
+		case "BEGIN":
+			c := &contentComponent{name: strings.ToUpper(strings.TrimSpace(l.value))}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.components = append(parent.components, c)
+			} else {
+				roots = append(roots, c)
+			}
+			stack = append(stack, c)
+		case "END":
+			name := strings.ToUpper(strings.TrimSpace(l.value))
+			if len(stack) == 0 || stack[len(stack)-1].name != name {
+				return nil, fmt.Errorf("Unexpected END:%v", name)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) > 0 {
+				c := stack[len(stack)-1]
+				c.props = append(c.props, l)
+			}
+		}
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("Missing END:%v", stack[len(stack)-1].name)
+	}
+
+	return roots, nil
+}
+
+// unescapeContentText removes the backslash escaping of a TEXT value
+func unescapeContentText(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	out := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+			switch value[i] {
+			case 'n', 'N':
+				out = append(out, '\n')
+			default:
+				out = append(out, value[i])
+			}
+			continue
+		}
+		out = append(out, value[i])
+	}
+	return string(out)
+}
+
+// splitContentValue splits an escaped value on unescaped occurrences of sep, without
+// unescaping the resulting fields
+func splitContentValue(value string, sep byte) []string {
+	fields := make([]string, 0, 4)
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case sep:
+			fields = append(fields, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, value[start:])
+}
@@ -0,0 +1,48 @@
+package enmime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseContentLine(t *testing.T) {
+	l, err := parseContentLine(`item1.EMAIL;TYPE=work,pref;X-LABEL="a;b:c":john@example.com`)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "item1", l.group)
+	assert.Equal(t, "EMAIL", l.name)
+	assert.Equal(t, []string{"work", "pref"}, l.params["TYPE"])
+	assert.Equal(t, "a;b:c", l.param("X-LABEL"))
+	assert.True(t, l.hasParamValue("TYPE", "WORK"))
+	assert.Equal(t, "john@example.com", l.value)
+
+	l, err = parseContentLine("TEL;WORK;VOICE:+1 555 1234")
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"WORK", "VOICE"}, l.params["TYPE"])
+	}
+
+	_, err = parseContentLine("NOVALUE")
+	assert.NotNil(t, err)
+	_, err = parseContentLine(`X;P="open:value`)
+	assert.NotNil(t, err)
+}
+
+func TestUnfoldContentLines(t *testing.T) {
+	lines := unfoldContentLines("A:one\r\n two\r\nB:three\n\tfour\n\nC:five")
+	assert.Equal(t, []string{"A:onetwo", "B:threefour", "C:five"}, lines)
+
+	// Large folded values, such as a PHOTO, are unfolded in linear time
+	folded := "PHOTO:" + strings.Repeat("\r\n QUJD", 200000) + "\r\nEND:VCARD"
+	lines = unfoldContentLines(folded)
+	if assert.Equal(t, 2, len(lines)) {
+		assert.Equal(t, 6+4*200000, len(lines[0]))
+	}
+}
+
+func TestContentTextEscaping(t *testing.T) {
+	assert.Equal(t, "a,b;c\\d\ne", unescapeContentText(`a\,b\;c\\d\ne`))
+	assert.Equal(t, []string{`Doe`, `John\;Jr`, ``}, splitContentValue(`Doe;John\;Jr;`, ';'))
+}
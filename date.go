@@ -0,0 +1,324 @@
+package enmime
+
+import (
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateSource identifies where the date returned by MIMEBody.Date came from
+type DateSource int
+
+const (
+	DateSourceNone     DateSource = iota // No usable date was found
+	DateSourceHeader                     // The Date header
+	DateSourceReceived                   // The newest Received header timestamp
+)
+
+// String returns a human readable name for the date source
+func (s DateSource) String() string {
+	switch s {
+	case DateSourceHeader:
+		return "Date"
+	case DateSourceReceived:
+		return "Received"
+	}
+	return "none"
+}
+
+// Date returns the date of the message.  The Date header is parsed with ParseDate; if it is
+// missing or unparseable, the newest timestamp of the Received headers is used instead.
+// The source of the date is returned along with it, DateSourceNone and a zero time
+// indicating there was no usable date at all.
+func (m *MIMEBody) Date() (time.Time, DateSource) {
+	if t, err := ParseDate(m.header.Get("Date")); err == nil {
+		return t, DateSourceHeader
+	}
+
+	var newest time.Time
+	for _, hop := range m.ReceivedChain() {
+		if hop.Time.After(newest) {
+			newest = hop.Time
+		}
+	}
+	if !newest.IsZero() {
+		return newest, DateSourceReceived
+	}
+
+	return time.Time{}, DateSourceNone
+}
+
+// dateZones holds the offsets of time zone names found in the wild, in seconds
+var dateZones = map[string]int{
+	"UT": 0, "UTC": 0, "GMT": 0, "Z": 0, "WET": 0,
+	"EST": -5 * 3600, "EDT": -4 * 3600,
+	"CST": -6 * 3600, "CDT": -5 * 3600,
+	"MST": -7 * 3600, "MDT": -6 * 3600,
+	"PST": -8 * 3600, "PDT": -7 * 3600,
+	"AKST": -9 * 3600, "AKDT": -8 * 3600,
+	"HST": -10 * 3600,
+	"BST": 1 * 3600, "WEST": 1 * 3600, "CET": 1 * 3600, "MET": 1 * 3600,
+	"CEST": 2 * 3600, "MEST": 2 * 3600, "EET": 2 * 3600, "SAST": 2 * 3600,
+	"EEST": 3 * 3600, "MSK": 3 * 3600,
+	"IST": 5*3600 + 1800,
+	"SGT": 8 * 3600, "HKT": 8 * 3600, "AWST": 8 * 3600,
+	"JST": 9 * 3600, "KST": 9 * 3600,
+	"ACST": 9*3600 + 1800, "AEST": 10 * 3600, "AEDT": 11 * 3600,
+	"NZST": 12 * 3600, "NZDT": 13 * 3600,
+}
+
+// dateLayouts are ISO 8601 style layouts tried before token based parsing
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 Z0700",
+	"2006-01-02 15:04:05",
+}
+
+// ParseDate parses an RFC 5322 date leniently.  Besides valid dates it accepts the common
+// variants produced by real-world mailers: comments such as "(CEST)", missing or misspelt
+// week days, full month names, two-digit years, missing seconds, named zones, offsets with
+// colons, asctime() ordering and ISO 8601.  Dates without a zone are taken to be UTC.
+func ParseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("Empty date")
+	}
+	if t, err := mail.ParseDate(value); err == nil && !unknownZone(t) {
+		return t, nil
+	}
+	cleaned := strings.TrimSpace(stripComments(value))
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, cleaned); err == nil {
+			return t, nil
+		}
+	}
+
+	t, err := parseDateTokens(cleaned)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Unable to parse date %q: %v", value, err)
+	}
+	return t, nil
+}
+
+// unknownZone returns true if t carries a zone abbreviation the time package could not
+// resolve; it parses those as UTC, so they are looked up in dateZones instead
+func unknownZone(t time.Time) bool {
+	name, offset := t.Zone()
+	if offset != 0 || name == "" {
+		return false
+	}
+	switch name {
+	case "UT", "UTC", "GMT", "Z":
+		return false
+	}
+	return true
+}
+
+// stripComments removes parenthesized comments from a header value
+func stripComments(value string) string {
+	if !strings.Contains(value, "(") {
+		return value
+	}
+	out := make([]byte, 0, len(value))
+	depth := 0
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '\\' && depth > 0:
+			i++
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			out = append(out, c)
+		}
+	}
+	return string(out)
+}
+
+// dateMonth returns the month named by word, or 0
+func dateMonth(word string) time.Month {
+	if len(word) < 3 {
+		return 0
+	}
+	prefix := strings.ToLower(word[:3])
+	for m := time.January; m <= time.December; m++ {
+		if strings.ToLower(m.String()[:3]) == prefix {
+			return m
+		}
+	}
+	return 0
+}
+
+// dateOffset parses a numeric zone offset such as +0200, -05:00, +2 or +0530, returning
+// the offset in seconds
+func dateOffset(word string) (int, bool) {
+	if len(word) < 2 || (word[0] != '+' && word[0] != '-') {
+		return 0, false
+	}
+	digits := strings.Replace(word[1:], ":", "", 1)
+	if _, err := strconv.Atoi(digits); err != nil {
+		return 0, false
+	}
+	var h, m int
+	switch len(digits) {
+	case 1, 2:
+		h, _ = strconv.Atoi(digits)
+	case 3, 4:
+		h, _ = strconv.Atoi(digits[:len(digits)-2])
+		m, _ = strconv.Atoi(digits[len(digits)-2:])
+	default:
+		return 0, false
+	}
+	if h > 14 || m > 59 {
+		return 0, false
+	}
+	offset := h*3600 + m*60
+	if word[0] == '-' {
+		offset = -offset
+	}
+	return offset, true
+}
+
+// dateZone parses a zone name or numeric offset, including combinations like GMT+0200
+func dateZone(word string) (int, bool) {
+	upper := strings.ToUpper(word)
+	if offset, ok := dateZones[upper]; ok {
+		return offset, true
+	}
+	if offset, ok := dateOffset(word); ok {
+		return offset, true
+	}
+	for _, base := range []string{"GMT", "UTC", "UT"} {
+		if strings.HasPrefix(upper, base) {
+			return dateOffset(word[len(base):])
+		}
+	}
+	return 0, false
+}
+
+// parseDateTokens assembles a date from its whitespace separated components in any order
+func parseDateTokens(value string) (time.Time, error) {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\r' || r == '\n' || r == ','
+	})
+
+	var month time.Month
+	numbers := make([]string, 0, 2)
+	clock := ""
+	offset, haveZone := 0, false
+	pm, am := false, false
+
+	for _, f := range fields {
+		// Dates like 3-Jun-2013 or 2013/06/03
+		if parts := strings.FieldsFunc(f, func(r rune) bool { return r == '-' || r == '/' }); len(parts) == 3 &&
+			!strings.HasPrefix(f, "-") && !strings.Contains(f, ":") {
+			if m := dateMonth(parts[1]); m != 0 {
+				month = m
+				numbers = append(numbers, parts[0], parts[2])
+				continue
+			}
+			if len(parts[0]) == 4 {
+				if n, err := strconv.Atoi(parts[1]); err == nil && n >= 1 && n <= 12 {
+					month = time.Month(n)
+					numbers = append(numbers, parts[2], parts[0])
+					continue
+				}
+			}
+		}
+
+		switch {
+		case strings.Contains(f, ":") && clock == "" && f[0] >= '0' && f[0] <= '9':
+			// The time may have a zone glued onto it
+			if i := strings.IndexAny(f, "+-"); i > 0 {
+				if o, ok := dateOffset(f[i:]); ok {
+					offset, haveZone = o, true
+					f = f[:i]
+				}
+			}
+			clock = f
+		case strings.EqualFold(f, "AM") || strings.EqualFold(f, "PM"):
+			am = strings.EqualFold(f, "AM")
+			pm = !am
+		case f[0] >= '0' && f[0] <= '9':
+			if _, err := strconv.Atoi(f); err != nil {
+				return time.Time{}, fmt.Errorf("unexpected %q", f)
+			}
+			numbers = append(numbers, f)
+		case month == 0 && dateMonth(f) != 0 && len(f) <= len("September."):
+			month = dateMonth(f)
+		default:
+			if o, ok := dateZone(f); ok && !haveZone {
+				offset, haveZone = o, true
+			}
+			// Anything else is a week day or noise
+		}
+	}
+
+	if month == 0 || len(numbers) != 2 {
+		return time.Time{}, fmt.Errorf("missing day, month or year")
+	}
+
+	// The year is the 3-4 digit number, or the second one if neither is
+	day, year := numbers[0], numbers[1]
+	if len(day) > 2 && len(year) <= 2 {
+		day, year = year, day
+	}
+	d, _ := strconv.Atoi(day)
+	y, _ := strconv.Atoi(year)
+	switch {
+	case len(year) <= 2 && y < 50:
+		y += 2000
+	case len(year) <= 3:
+		y += 1900
+	}
+	if d < 1 || d > 31 {
+		return time.Time{}, fmt.Errorf("invalid day %v", day)
+	}
+
+	var hour, min, sec, nsec int
+	if clock != "" {
+		parts := strings.Split(clock, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return time.Time{}, fmt.Errorf("invalid time %q", clock)
+		}
+		var err error
+		if hour, err = strconv.Atoi(parts[0]); err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q", clock)
+		}
+		if min, err = strconv.Atoi(parts[1]); err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q", clock)
+		}
+		if len(parts) == 3 {
+			secs, err := strconv.ParseFloat(parts[2], 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid time %q", clock)
+			}
+			sec = int(secs)
+			nsec = int((secs - float64(sec)) * 1e9)
+		}
+		if pm && hour < 12 {
+			hour += 12
+		} else if am && hour == 12 {
+			hour = 0
+		}
+		if hour > 23 || min > 59 || sec > 60 {
+			return time.Time{}, fmt.Errorf("invalid time %q", clock)
+		}
+	}
+
+	loc := time.UTC
+	if offset != 0 {
+		loc = time.FixedZone("", offset)
+	}
+	t := time.Date(y, month, d, hour, min, sec, nsec, loc)
+	if t.Day() != d {
+		return time.Time{}, fmt.Errorf("invalid day %v for %v", d, month)
+	}
+	return t, nil
+}
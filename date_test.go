@@ -0,0 +1,76 @@
+package enmime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDate(t *testing.T) {
+	cest := time.FixedZone("", 2*3600)
+	expect := time.Date(2013, time.June, 3, 10, 0, 0, 0, cest)
+
+	var testTable = []struct {
+		input  string
+		expect time.Time
+	}{
+		{"Mon, 3 Jun 2013 10:00:00 +0200", expect},
+		{"Mon, 3 Jun 2013 10:00:00 +0200 (CEST)", expect},
+		{"Mon, 03 Jun 13 10:00:00 +0200", expect},
+		{"Mon, 3 Jun 2013 10:00 +0200", expect},
+		{"3 Jun 2013 10:00:00 CEST", expect},
+		{"Monday, 3 June 2013 10:00:00 +02:00", expect},
+		{"Tue, 3 Jun 2013 10:00:00 GMT+0200", expect},
+		{"3-Jun-2013 10:00:00 +0200", expect},
+		{"Jun 3, 2013 10:00:00 AM +0200", expect},
+		{"Mon Jun  3 08:00:00 2013", expect},
+		{"2013-06-03T10:00:00+02:00", expect},
+		{"3 Jun 2013 04:00:00 EDT", expect},
+		{"3 Jun 99 10:00:00 +0000", time.Date(1999, time.June, 3, 10, 0, 0, 0, time.UTC)},
+		{"Fri, 29 Feb 2013 10:00:00 +0000", time.Time{}},
+		{"3 Jun 10:00:00 +0200", time.Time{}},
+		{"not a date", time.Time{}},
+		{"", time.Time{}},
+	}
+
+	for _, tt := range testTable {
+		got, err := ParseDate(tt.input)
+		if tt.expect.IsZero() {
+			assert.Error(t, err, "Expected an error for input %q", tt.input)
+			continue
+		}
+		if assert.NoError(t, err, "Unexpected error for input %q", tt.input) {
+			assert.True(t, tt.expect.Equal(got), "Input %q parsed as %v, expected %v", tt.input, got, tt.expect)
+		}
+	}
+}
+
+func TestMIMEBodyDate(t *testing.T) {
+	msg := readMessage("04-monopart_plain_text.eml")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	date, source := mime.Date()
+	assert.Equal(t, DateSourceHeader, source)
+	assert.True(t, date.Equal(time.Date(2013, time.February, 8, 15, 55, 12, 0, time.UTC)))
+
+	// No Date header, the newest Received header is used instead
+	msg = readMessage("06-no_date.eml")
+	mime, err = ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	date, source = mime.Date()
+	assert.Equal(t, DateSourceReceived, source)
+	assert.True(t, date.Equal(time.Date(2014, time.July, 1, 10, 29, 25, 0, time.UTC)), "Got %v", date)
+
+	msg = readMessage("non-mime.raw")
+	mime, err = ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	_, source = mime.Date()
+	assert.Equal(t, DateSourceHeader, source)
+}
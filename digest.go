@@ -0,0 +1,166 @@
+package enmime
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"strings"
+)
+
+// Digests holds hashes of the content of a part as returned by Content(), i.e. after
+// transfer decoding and, for text, conversion to UTF-8.
+type Digests struct {
+	SHA256             []byte
+	MD5                []byte // Set if ParseOptions.MD5 was
+	SHA1               []byte // Set if ParseOptions.SHA1 was
+	ContentMD5Mismatch bool   // The Content-MD5 header of the part does not match its content
+}
+
+// ContentMD5Error records a part whose Content-MD5 header (RFC 1864) does not match its
+// content
+type ContentMD5Error struct {
+	Part   MIMEPart // nil for the body of a non-multipart message
+	Header string   // Value of the Content-MD5 header
+}
+
+func (e *ContentMD5Error) Error() string {
+	if e.Part == nil {
+		return fmt.Sprintf("Content-MD5 %v does not match the message body", e.Header)
+	}
+	return fmt.Sprintf("Content-MD5 %v does not match the content of %v part %q", e.Header,
+		e.Part.ContentType(), e.Part.FileName())
+}
+
+// PartDigests returns the digests of the content of p, computed while the message was
+// parsed.  They are computed again for parts that were built or whose content was set
+// since, and then include all the digests.
+func PartDigests(p MIMEPart) Digests {
+	if mp, ok := p.(*memMIMEPart); ok && mp.digests != nil {
+		return *mp.digests
+	}
+	return contentDigests(p.Content())
+}
+
+// Digests returns the digests of the body of a non-multipart message, see PartDigests.
+func (m *MIMEBody) Digests() Digests {
+	if m.digests != nil {
+		return *m.digests
+	}
+	return contentDigests(m.body)
+}
+
+// contentDigests returns all the digests of content
+func contentDigests(content []byte) Digests {
+	s256, s1, m5 := sha256.Sum256(content), sha1.Sum(content), md5.Sum(content)
+	return Digests{SHA256: s256[:], MD5: m5[:], SHA1: s1[:]}
+}
+
+// digester computes the digests of a section while it is decoded, and checks its
+// Content-MD5 before any charset conversion as RFC 1864 specifies
+type digester struct {
+	contentMD5 string    // Content-MD5 header, if any
+	rawMD5     hash.Hash // MD5 of the decoded bytes, if there is a Content-MD5
+	canonical  hash.Hash // MD5 of text with CRLF line breaks, as RFC 1864 specifies
+	crlf       *crlfWriter
+	w          io.Writer
+	sha256     hash.Hash
+	md5        hash.Hash // nil unless ParseOptions.MD5 is set
+	sha1       hash.Hash // nil unless ParseOptions.SHA1 is set
+	content    io.Writer // Feeds the digests with the section as returned by Content()
+}
+
+// newDigester returns a digester for a section with header h and media type mediatype.
+// opts may be nil.
+func newDigester(opts *ParseOptions, h textproto.MIMEHeader, mediatype string) *digester {
+	d := &digester{contentMD5: strings.TrimSpace(h.Get("Content-MD5")), w: ioutil.Discard,
+		sha256: sha256.New()}
+	digests := []io.Writer{d.sha256}
+	if opts != nil && opts.MD5 {
+		d.md5 = md5.New()
+		digests = append(digests, d.md5)
+	}
+	if opts != nil && opts.SHA1 {
+		d.sha1 = sha1.New()
+		digests = append(digests, d.sha1)
+	}
+	d.content = io.MultiWriter(digests...)
+	if d.contentMD5 == "" {
+		return d
+	}
+	d.rawMD5 = md5.New()
+	writers := []io.Writer{d.rawMD5}
+	if strings.HasPrefix(mediatype, "text/") {
+		d.canonical = md5.New()
+		d.crlf = &crlfWriter{w: d.canonical}
+		writers = append(writers, d.crlf)
+	}
+	d.w = io.MultiWriter(writers...)
+	return d
+}
+
+// Write adds transfer decoded bytes, before charset conversion, to the Content-MD5 check
+func (d *digester) Write(b []byte) (int, error) {
+	return d.w.Write(b)
+}
+
+// sum returns the digests of what was written to d.content and the result of the
+// Content-MD5 check of what was written to d
+func (d *digester) sum() *Digests {
+	s := &Digests{SHA256: d.sha256.Sum(nil)}
+	if d.md5 != nil {
+		s.MD5 = d.md5.Sum(nil)
+	}
+	if d.sha1 != nil {
+		s.SHA1 = d.sha1.Sum(nil)
+	}
+	if d.contentMD5 != "" {
+		expected, err := base64.StdEncoding.DecodeString(d.contentMD5)
+		s.ContentMD5Mismatch = err != nil || !bytes.Equal(expected, d.rawMD5.Sum(nil))
+		if s.ContentMD5Mismatch && err == nil && d.canonical != nil {
+			// Senders may not have converted line breaks, both forms are accepted
+			d.crlf.flush()
+			s.ContentMD5Mismatch = !bytes.Equal(expected, d.canonical.Sum(nil))
+		}
+	}
+	return s
+}
+
+// crlfWriter writes bare CR and LF line breaks to w as CRLF
+type crlfWriter struct {
+	w  io.Writer
+	cr bool // The last byte written was a CR
+}
+
+func (c *crlfWriter) Write(b []byte) (int, error) {
+	out := make([]byte, 0, len(b)+len(b)/32)
+	for _, ch := range b {
+		switch {
+		case ch == '\n' && !c.cr:
+			out = append(out, '\r', '\n')
+		case ch != '\n' && c.cr:
+			out = append(out, '\n', ch)
+		default:
+			out = append(out, ch)
+		}
+		c.cr = ch == '\r'
+	}
+	if _, err := c.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// flush completes a CR ending the content
+func (c *crlfWriter) flush() {
+	if c.cr {
+		c.w.Write([]byte{'\n'})
+		c.cr = false
+	}
+}
@@ -0,0 +1,122 @@
+package enmime
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// contentMD5 returns the Content-MD5 header value for content
+func contentMD5(content string) string {
+	sum := md5.Sum([]byte(content))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// digestMessage returns a message with parts declaring the given Content-MD5 values
+func digestMessage(fileMD5, textMD5 string) string {
+	return fmt.Sprintf(`From: a@example.net
+Subject: Digests
+Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: text/plain; charset=iso-8859-1
+Content-Transfer-Encoding: quoted-printable
+Content-MD5: %v
+
+Caf=E9 menu
+Second line
+--b
+Content-Type: application/octet-stream; name="data.bin"
+Content-Disposition: attachment; filename="data.bin"
+Content-Transfer-Encoding: base64
+Content-MD5: %v
+
+aGVsbG8gd29ybGQ=
+--b--
+`, textMD5, fileMD5)
+}
+
+func TestPartDigests(t *testing.T) {
+	// Text is checked with CRLF line breaks, before charset conversion
+	raw := digestMessage(contentMD5("hello world"), contentMD5("Caf\xe9 menu\r\nSecond line"))
+	mime, err := ReadMIMEBody(strings.NewReader(raw))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 0, len(mime.ContentMD5Errors))
+
+	file := mime.Attachments[0]
+	d := PartDigests(file)
+	s256 := sha256.Sum256([]byte("hello world"))
+	assert.Equal(t, s256[:], d.SHA256)
+	assert.Nil(t, d.MD5, "Content-MD5 is checked without being recorded")
+	assert.Nil(t, d.SHA1)
+	assert.False(t, d.ContentMD5Mismatch)
+
+	text := mime.Root.FirstChild()
+	assert.Equal(t, "Café menu\nSecond line", string(text.Content()))
+	// Digests are those of the content after charset conversion, like those of parts set
+	s256 = sha256.Sum256(text.Content())
+	assert.Equal(t, s256[:], PartDigests(text).SHA256)
+
+	// Content that is set is hashed again
+	assert.NoError(t, SetContent(file, []byte("changed")))
+	s1 := sha1.Sum([]byte("changed"))
+	assert.Equal(t, s1[:], PartDigests(file).SHA1)
+}
+
+func TestDigestOptions(t *testing.T) {
+	raw := strings.Replace(digestMessage("", ""), "Content-MD5: \n", "", -1)
+	mime, err := ReadMIMEBodyOptions(strings.NewReader(raw), &ParseOptions{SHA1: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	d := PartDigests(mime.Attachments[0])
+	s1 := sha1.Sum([]byte("hello world"))
+	assert.Equal(t, s1[:], d.SHA1)
+	assert.Nil(t, d.MD5)
+
+	mime, err = ReadMIMEBodyOptions(strings.NewReader(raw), &ParseOptions{MD5: true})
+	if assert.NoError(t, err) {
+		m5 := md5.Sum([]byte("hello world"))
+		assert.Equal(t, m5[:], PartDigests(mime.Attachments[0]).MD5)
+	}
+}
+
+func TestContentMD5Mismatch(t *testing.T) {
+	raw := digestMessage(contentMD5("hello"), "not base64!")
+	mime, err := ReadMIMEBody(strings.NewReader(raw))
+	if !assert.NoError(t, err) || !assert.Equal(t, 2, len(mime.ContentMD5Errors)) {
+		return
+	}
+	assert.Equal(t, "text/plain", mime.ContentMD5Errors[0].Part.ContentType())
+	assert.Equal(t, "not base64!", mime.ContentMD5Errors[0].Header)
+	assert.Equal(t, mime.Attachments[0], mime.ContentMD5Errors[1].Part)
+	assert.True(t, PartDigests(mime.Attachments[0]).ContentMD5Mismatch)
+	assert.Contains(t, mime.ContentMD5Errors[1].Error(), `"data.bin"`)
+}
+
+func TestBodyDigests(t *testing.T) {
+	raw := "From: a@example.net\nContent-Type: text/plain\nContent-MD5: " +
+		contentMD5("Hello\r\n") + "\n\nHello\n"
+	mime, err := ReadMIMEBody(strings.NewReader(raw))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, len(mime.ContentMD5Errors))
+		s256 := sha256.Sum256([]byte("Hello\n"))
+		assert.Equal(t, s256[:], mime.Digests().SHA256)
+	}
+
+	raw = strings.Replace(raw, "Hello\n", "Goodbye\n", 1)
+	mime, err = ReadMIMEBody(strings.NewReader(raw))
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(mime.ContentMD5Errors)) {
+		assert.Nil(t, mime.ContentMD5Errors[0].Part)
+		assert.True(t, mime.Digests().ContentMD5Mismatch)
+		assert.Contains(t, mime.ContentMD5Errors[0].Error(), "message body")
+	}
+}
@@ -0,0 +1,587 @@
+package enmime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DKIMKeyResolver retrieves the TXT records that hold DKIM public keys.  The name looked up
+// is "<selector>._domainkey.<domain>"; each string returned is a separate record, as returned
+// by net.LookupTXT.
+type DKIMKeyResolver interface {
+	LookupTXT(name string) ([]string, error)
+}
+
+// DNSKeyResolver is a DKIMKeyResolver that queries the DNS
+type DNSKeyResolver struct{}
+
+// LookupTXT returns the TXT records for name
+func (DNSKeyResolver) LookupTXT(name string) ([]string, error) {
+	return net.LookupTXT(name)
+}
+
+// MapKeyResolver is a DKIMKeyResolver serving records from memory, keyed by the lower case
+// name that would be looked up in the DNS
+type MapKeyResolver map[string]string
+
+// LookupTXT returns the record for name, or a not found error
+func (m MapKeyResolver) LookupTXT(name string) ([]string, error) {
+	if txt, ok := m[strings.ToLower(strings.TrimSuffix(name, "."))]; ok {
+		return []string{txt}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+// DKIMStatus is the outcome of verifying a single DKIM signature
+type DKIMStatus int
+
+const (
+	DKIMFail      DKIMStatus = iota // The signature does not match the message
+	DKIMPass                        // The signature is valid
+	DKIMTempError                   // The key could not be retrieved, try again later
+	DKIMPermError                   // The signature or key is malformed or unsupported
+)
+
+// String returns the RFC 8601 result name of the status
+func (s DKIMStatus) String() string {
+	switch s {
+	case DKIMPass:
+		return "pass"
+	case DKIMTempError:
+		return "temperror"
+	case DKIMPermError:
+		return "permerror"
+	}
+	return "fail"
+}
+
+// DKIMResult describes a DKIM-Signature header and the outcome of its verification
+type DKIMResult struct {
+	Status     DKIMStatus
+	Err        error     // Why the signature did not pass; nil if it did
+	Domain     string    // Signing domain (d= tag)
+	Selector   string    // Key selector (s= tag)
+	Identity   string    // Agent or user identifier (i= tag), defaults to "@" + Domain
+	Algorithm  string    // Signing algorithm (a= tag)
+	Headers    []string  // Signed header fields (h= tag)
+	BodyLength int64     // Number of body bytes signed (l= tag), -1 if all of them
+	Timestamp  time.Time // Signature creation time (t= tag), may be zero
+	Expiration time.Time // Signature expiration time (x= tag), may be zero
+}
+
+// rawHeaderField is a header field exactly as it appears in the message
+type rawHeaderField struct {
+	name string // Field name as written
+	raw  []byte // Complete field including folding and the trailing CRLF
+}
+
+// value returns the unparsed value of the field, after the colon
+func (f rawHeaderField) value() string {
+	v := string(f.raw[bytes.IndexByte(f.raw, ':')+1:])
+	return strings.TrimRight(v, "\r\n")
+}
+
+// VerifyDKIM verifies the DKIM-Signature headers of the message, returning one result per
+// signature in the order they appear.  The message must have been read by ReadMIMEBody.
+func (m *MIMEBody) VerifyDKIM(resolver DKIMKeyResolver) ([]DKIMResult, error) {
+	if m.raw == nil {
+		return nil, fmt.Errorf("Raw message not available, use ReadMIMEBody")
+	}
+	return VerifyDKIM(m.raw, resolver)
+}
+
+// VerifyDKIM verifies the DKIM (RFC 6376) signatures of the raw message, returning one
+// result per DKIM-Signature header in the order they appear.  The rsa-sha256 and
+// ed25519-sha256 (RFC 8463) algorithms are supported; rsa-sha1 is rejected as RFC 8301
+// requires.  An error is only returned if the message itself cannot be split into header
+// and body.
+func VerifyDKIM(raw []byte, resolver DKIMKeyResolver) ([]DKIMResult, error) {
+	fields, body, err := splitRawMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]DKIMResult, 0, 1)
+	for i, f := range fields {
+		if strings.EqualFold(f.name, "DKIM-Signature") {
+			results = append(results, verifyDKIMSignature(fields, i, body, resolver))
+		}
+	}
+	return results, nil
+}
+
+// verifyDKIMSignature verifies the signature held in fields[index]
+func verifyDKIMSignature(fields []rawHeaderField, index int, body []byte,
+	resolver DKIMKeyResolver) DKIMResult {
+	result := DKIMResult{BodyLength: -1}
+	fail := func(status DKIMStatus, format string, args ...interface{}) DKIMResult {
+		result.Status = status
+		result.Err = fmt.Errorf(format, args...)
+		return result
+	}
+
+	tags, err := parseTagList(fields[index].value())
+	if err != nil {
+		return fail(DKIMPermError, "Malformed DKIM-Signature: %v", err)
+	}
+	for _, name := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if _, ok := tags[name]; !ok {
+			return fail(DKIMPermError, "DKIM-Signature is missing the %v= tag", name)
+		}
+	}
+	result.Domain = strings.ToLower(tags["d"])
+	result.Selector = tags["s"]
+	result.Algorithm = strings.ToLower(tags["a"])
+	result.Headers = splitHeaderList(tags["h"])
+	result.Identity = tags["i"]
+	if result.Identity == "" {
+		result.Identity = "@" + result.Domain
+	}
+	if tags["v"] != "1" {
+		return fail(DKIMPermError, "Unsupported DKIM-Signature version %q", tags["v"])
+	}
+	if !dkimDomainMatches(result.Identity, result.Domain) {
+		return fail(DKIMPermError, "Identity %v is not within domain %v", result.Identity, result.Domain)
+	}
+	if !containsFold(result.Headers, "From") {
+		return fail(DKIMPermError, "From header is not signed")
+	}
+	if l, ok := tags["l"]; ok {
+		if result.BodyLength, err = strconv.ParseInt(l, 10, 64); err != nil || result.BodyLength < 0 {
+			return fail(DKIMPermError, "Invalid body length %q", l)
+		}
+	}
+	if t, ok := tags["t"]; ok {
+		if n, err := strconv.ParseInt(t, 10, 64); err == nil {
+			result.Timestamp = time.Unix(n, 0)
+		}
+	}
+	if x, ok := tags["x"]; ok {
+		if n, err := strconv.ParseInt(x, 10, 64); err == nil {
+			result.Expiration = time.Unix(n, 0)
+			if time.Now().After(result.Expiration) {
+				return fail(DKIMPermError, "Signature expired at %v", result.Expiration)
+			}
+		}
+	}
+	if status, err := verifyMessageSignature(tags, fields, index, body, resolver); err != nil {
+		return fail(status, "%v", err)
+	}
+
+	result.Status = DKIMPass
+	return result
+}
+
+// verifyMessageSignature verifies the body hash and signature of the DKIM-Signature or
+// ARC-Message-Signature held in fields[index], whose tags have already been checked for
+// presence.  On failure the status to report is returned along with the error.
+func verifyMessageSignature(tags map[string]string, fields []rawHeaderField, index int,
+	body []byte, resolver DKIMKeyResolver) (DKIMStatus, error) {
+	algorithm := strings.ToLower(tags["a"])
+	if algorithm != "rsa-sha256" && algorithm != "ed25519-sha256" {
+		return DKIMPermError, fmt.Errorf("Unsupported algorithm %v", algorithm)
+	}
+	relaxedHeader, relaxedBody, err := parseCanonicalization(tags["c"])
+	if err != nil {
+		return DKIMPermError, err
+	}
+
+	// Body hash
+	canonBody := canonicalBody(body, relaxedBody)
+	if l, ok := tags["l"]; ok {
+		length, err := strconv.ParseInt(l, 10, 64)
+		if err != nil || length < 0 {
+			return DKIMPermError, fmt.Errorf("Invalid body length %q", l)
+		}
+		if length > int64(len(canonBody)) {
+			return DKIMFail, fmt.Errorf("Body is shorter than the signed length %v", length)
+		}
+		canonBody = canonBody[:length]
+	}
+	bodyHash := sha256.Sum256(canonBody)
+	bh, err := decodeTagBase64(tags["bh"])
+	if err != nil {
+		return DKIMPermError, fmt.Errorf("Malformed body hash: %v", err)
+	}
+	if !bytes.Equal(bh, bodyHash[:]) {
+		return DKIMFail, fmt.Errorf("Body hash did not verify")
+	}
+
+	// Header hash and signature
+	pub, status, err := lookupDKIMKey(resolver, tags["s"], strings.ToLower(tags["d"]), algorithm)
+	if err != nil {
+		return status, err
+	}
+	sig, err := decodeTagBase64(tags["b"])
+	if err != nil {
+		return DKIMPermError, fmt.Errorf("Malformed signature: %v", err)
+	}
+	digest := headerHash(fields[:index], fields[index+1:], fields[index], splitHeaderList(tags["h"]),
+		relaxedHeader)
+	if err := verifyDigest(pub, digest, sig); err != nil {
+		return DKIMFail, err
+	}
+
+	return DKIMPass, nil
+}
+
+// parseCanonicalization parses the c= tag, returning whether headers and body use the
+// relaxed algorithm; simple is the default for both
+func parseCanonicalization(c string) (bool, bool, error) {
+	if c == "" {
+		return false, false, nil
+	}
+	parts := strings.SplitN(strings.ToLower(c), "/", 2)
+	if len(parts) == 1 {
+		parts = append(parts, "simple")
+	}
+	relaxed := make([]bool, 2)
+	for i, p := range parts {
+		switch p {
+		case "simple":
+		case "relaxed":
+			relaxed[i] = true
+		default:
+			return false, false, fmt.Errorf("Unknown canonicalization %q", c)
+		}
+	}
+	return relaxed[0], relaxed[1], nil
+}
+
+// lookupDKIMKey retrieves and parses the public key for selector and domain, checking it
+// may be used with algorithm.  On failure the status to report is returned.
+func lookupDKIMKey(resolver DKIMKeyResolver, selector, domain,
+	algorithm string) (crypto.PublicKey, DKIMStatus, error) {
+	name := selector + "._domainkey." + domain
+	txts, err := resolver.LookupTXT(name)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, DKIMPermError, fmt.Errorf("No key for signature at %v", name)
+		}
+		return nil, DKIMTempError, fmt.Errorf("Key lookup for %v failed: %v", name, err)
+	}
+	if len(txts) == 0 {
+		return nil, DKIMPermError, fmt.Errorf("No key for signature at %v", name)
+	}
+
+	// LookupTXT joins the strings of a record, each element is a separate record.  The
+	// first valid key record is used; RFC 6376 leaves the choice to the verifier.
+	var firstStatus DKIMStatus
+	var firstErr error
+	for _, txt := range txts {
+		key, status, err := parseDKIMKey(name, txt, algorithm)
+		if err == nil {
+			return key, status, nil
+		}
+		if firstErr == nil {
+			firstStatus, firstErr = status, err
+		}
+	}
+	return nil, firstStatus, firstErr
+}
+
+// parseDKIMKey parses the key record txt found at name, checking the key may be used with
+// algorithm
+func parseDKIMKey(name, txt, algorithm string) (crypto.PublicKey, DKIMStatus, error) {
+	tags, err := parseTagList(txt)
+	if err != nil {
+		return nil, DKIMPermError, fmt.Errorf("Malformed key record at %v: %v", name, err)
+	}
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, DKIMPermError, fmt.Errorf("Unsupported key record version %q", v)
+	}
+	keyType := strings.ToLower(tags["k"])
+	if keyType == "" {
+		keyType = "rsa"
+	}
+	if h, ok := tags["h"]; ok && !containsFold(strings.Split(h, ":"), "sha256") {
+		return nil, DKIMPermError, fmt.Errorf("Key at %v does not allow sha256", name)
+	}
+	if !strings.HasPrefix(algorithm, keyType+"-") {
+		return nil, DKIMPermError, fmt.Errorf("Key type %v does not match algorithm %v", keyType, algorithm)
+	}
+	data, err := decodeTagBase64(tags["p"])
+	if err != nil {
+		return nil, DKIMPermError, fmt.Errorf("Malformed key at %v: %v", name, err)
+	}
+	if len(data) == 0 {
+		return nil, DKIMPermError, fmt.Errorf("Key at %v has been revoked", name)
+	}
+
+	switch keyType {
+	case "ed25519":
+		if len(data) != ed25519.PublicKeySize {
+			return nil, DKIMPermError, fmt.Errorf("Malformed ed25519 key at %v", name)
+		}
+		return ed25519.PublicKey(data), DKIMPass, nil
+	default:
+		pub, err := x509.ParsePKIXPublicKey(data)
+		if err != nil {
+			// Some signers publish a bare PKCS #1 key
+			pkcs1, err1 := x509.ParsePKCS1PublicKey(data)
+			if err1 != nil {
+				return nil, DKIMPermError, fmt.Errorf("Malformed RSA key at %v: %v", name, err)
+			}
+			pub = pkcs1
+		}
+		rsaKey, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return nil, DKIMPermError, fmt.Errorf("Key at %v is not an RSA key", name)
+		}
+		if rsaKey.N.BitLen() < 1024 {
+			return nil, DKIMPermError, fmt.Errorf("Key at %v is shorter than 1024 bits", name)
+		}
+		return rsaKey, DKIMPass, nil
+	}
+}
+
+// verifyDigest checks sig over the SHA-256 digest.  Ed25519 signs the digest itself rather
+// than the data, as RFC 8463 specifies.
+func verifyDigest(pub crypto.PublicKey, digest, sig []byte) error {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig); err != nil {
+			return fmt.Errorf("Signature did not verify")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, digest, sig) {
+			return fmt.Errorf("Signature did not verify")
+		}
+	default:
+		return fmt.Errorf("Unsupported key type %T", pub)
+	}
+	return nil
+}
+
+// headerHash computes the SHA-256 hash of the signed header fields followed by the
+// signature field itself, with its b= value removed and without a trailing CRLF.  The
+// fields are selected from above and below, the latter being searched first as fields
+// are taken from the bottom of the header up.
+func headerHash(above, below []rawHeaderField, sigField rawHeaderField, names []string,
+	relaxed bool) []byte {
+	all := make([]rawHeaderField, 0, len(above)+len(below))
+	all = append(append(all, above...), below...)
+
+	h := sha256.New()
+	for _, f := range selectHeaderFields(all, names) {
+		h.Write(canonicalHeader(f, relaxed))
+	}
+	sig := canonicalHeader(rawHeaderField{name: sigField.name, raw: stripSignatureValue(sigField.raw)},
+		relaxed)
+	h.Write(bytes.TrimSuffix(sig, []byte("\r\n")))
+	return h.Sum(nil)
+}
+
+// selectHeaderFields picks the fields named in names: each occurrence of a name selects the
+// next instance of that field starting from the bottom.  Names without an instance left
+// select nothing, which is how signers protect against fields being added.
+func selectHeaderFields(fields []rawHeaderField, names []string) []rawHeaderField {
+	used := make(map[string]int)
+	selected := make([]rawHeaderField, 0, len(names))
+	for _, name := range names {
+		key := strings.ToLower(name)
+		skip := used[key]
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !strings.EqualFold(fields[i].name, name) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			selected = append(selected, fields[i])
+			break
+		}
+		used[key]++
+	}
+	return selected
+}
+
+// canonicalHeader canonicalizes a header field with the simple or relaxed algorithm
+func canonicalHeader(f rawHeaderField, relaxed bool) []byte {
+	if !relaxed {
+		return f.raw
+	}
+	value := strings.Replace(f.value(), "\r\n", "", -1)
+	value = strings.Join(strings.FieldsFunc(value, isWSP), " ")
+	return []byte(strings.ToLower(strings.TrimSpace(f.name)) + ":" + value + "\r\n")
+}
+
+// canonicalBody canonicalizes a CRLF terminated body with the simple or relaxed algorithm
+func canonicalBody(body []byte, relaxed bool) []byte {
+	if relaxed {
+		lines := bytes.Split(body, []byte("\r\n"))
+		for i, line := range lines {
+			fields := bytes.FieldsFunc(line, isWSP)
+			line = bytes.Join(fields, []byte(" "))
+			if len(fields) > 0 && isWSP(rune(lines[i][0])) {
+				line = append([]byte(" "), line...)
+			}
+			lines[i] = line
+		}
+		body = bytes.Join(lines, []byte("\r\n"))
+	}
+
+	// Remove trailing empty lines, then make sure the body ends with a line break
+	for bytes.HasSuffix(body, []byte("\r\n")) {
+		body = body[:len(body)-2]
+	}
+	if len(body) == 0 {
+		if relaxed {
+			return []byte{}
+		}
+		return []byte("\r\n")
+	}
+	return append(body[:len(body):len(body)], '\r', '\n')
+}
+
+// isWSP returns true for the white space characters of RFC 5234
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// stripSignatureValue blanks the value of the b= tag of a signature field, leaving the
+// rest of it, including white space, untouched
+func stripSignatureValue(raw []byte) []byte {
+	colon := bytes.IndexByte(raw, ':')
+	out := make([]byte, 0, len(raw))
+	out = append(out, raw[:colon+1]...)
+	for _, tag := range bytes.SplitAfter(raw[colon+1:], []byte(";")) {
+		eq := bytes.IndexByte(tag, '=')
+		if eq > 0 && string(bytes.TrimSpace(tag[:eq])) == "b" {
+			out = append(out, tag[:eq+1]...)
+			if bytes.HasSuffix(tag, []byte(";")) {
+				out = append(out, ';')
+			} else if bytes.HasSuffix(tag, []byte("\r\n")) {
+				out = append(out, '\r', '\n')
+			}
+			continue
+		}
+		out = append(out, tag...)
+	}
+	return out
+}
+
+// parseTagList parses a DKIM tag=value list (RFC 6376 section 3.2).  White space around
+// tags and values is removed; duplicate tags are an error.
+func parseTagList(value string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, spec := range strings.Split(value, ";") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		eq := strings.Index(spec, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("Missing = in tag %q", strings.TrimSpace(spec))
+		}
+		name := strings.TrimSpace(spec[:eq])
+		if name == "" {
+			return nil, fmt.Errorf("Empty tag name in %q", strings.TrimSpace(spec))
+		}
+		if _, dup := tags[name]; dup {
+			return nil, fmt.Errorf("Duplicate tag %v", name)
+		}
+		tags[name] = strings.TrimSpace(spec[eq+1:])
+	}
+	return tags, nil
+}
+
+// decodeTagBase64 decodes a base64 tag value, which may contain folding white space
+func decodeTagBase64(value string) ([]byte, error) {
+	value = strings.Join(strings.Fields(value), "")
+	return base64.StdEncoding.DecodeString(value)
+}
+
+// splitHeaderList splits the colon separated header names of an h= tag
+func splitHeaderList(value string) []string {
+	names := make([]string, 0, 8)
+	for _, name := range strings.Split(value, ":") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// containsFold returns true if list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// dkimDomainMatches returns true if the domain of identity is domain or a subdomain of it
+func dkimDomainMatches(identity, domain string) bool {
+	at := strings.LastIndex(identity, "@")
+	if at < 0 {
+		return false
+	}
+	idDomain := strings.ToLower(identity[at+1:])
+	return idDomain == domain || strings.HasSuffix(idDomain, "."+domain)
+}
+
+// splitRawMessage splits a raw message into its header fields and body.  Line endings are
+// converted to CRLF, as messages stored on disk often use bare LF.
+func splitRawMessage(raw []byte) ([]rawHeaderField, []byte, error) {
+	raw = toCRLF(raw)
+	fields := make([]rawHeaderField, 0, 16)
+	pos := 0
+	for pos < len(raw) {
+		end := bytes.Index(raw[pos:], []byte("\r\n"))
+		if end < 0 {
+			end = len(raw) - pos
+		} else {
+			end += 2
+		}
+		line := raw[pos : pos+end]
+		switch {
+		case bytes.Equal(line, []byte("\r\n")):
+			// End of header
+			return fields, raw[pos+end:], nil
+		case line[0] == ' ' || line[0] == '\t':
+			if len(fields) == 0 {
+				return nil, nil, fmt.Errorf("Header starts with a continuation line")
+			}
+			f := &fields[len(fields)-1]
+			f.raw = raw[pos-len(f.raw) : pos+end]
+		default:
+			colon := bytes.IndexByte(line, ':')
+			if colon <= 0 {
+				return nil, nil, fmt.Errorf("Malformed header line %q", line)
+			}
+			fields = append(fields, rawHeaderField{name: string(line[:colon]), raw: line})
+		}
+		pos += end
+	}
+	// No body
+	return fields, nil, nil
+}
+
+// toCRLF converts bare LF line endings to CRLF
+func toCRLF(raw []byte) []byte {
+	bare := bytes.Count(raw, []byte("\n")) - bytes.Count(raw, []byte("\r\n"))
+	if bare == 0 {
+		return raw
+	}
+	out := make([]byte, 0, len(raw)+bare)
+	for i, c := range raw {
+		if c == '\n' && (i == 0 || raw[i-1] != '\r') {
+			out = append(out, '\r')
+		}
+		out = append(out, c)
+	}
+	return out
+}
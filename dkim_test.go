@@ -0,0 +1,156 @@
+package enmime
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testDKIMKeys = MapKeyResolver{
+	"rsa._domainkey.example.net": "v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDHvPmFbZMsbhgo" +
+		"4Nt16I497/Og9dYbqfZWQUO/L+FJ1CVUcxZH+ELHb788AVDoGXf0lWhZBRRVg1qafacvGCpz8kfnTgmWHQkv3IxTzyklEX" +
+		"/1QgtS0ZL8xrWf/CLy0djtv6qmHDej38HiBS7hyyBzNLEduq02ecYzw5TFrQxQjQIDAQAB",
+	"ed._domainkey.example.net": "v=DKIM1; k=ed25519; p=5dgIK+Vaz8U0grr7W9dKH/oXC+j9Sf9u0eVb2BLmkWc=",
+}
+
+// tempFailResolver fails every lookup with a temporary error
+type tempFailResolver struct{}
+
+func (tempFailResolver) LookupTXT(name string) ([]string, error) {
+	return nil, &net.DNSError{Err: "server misbehaving", Name: name, IsTemporary: true}
+}
+
+// recordsResolver serves several TXT records per name
+type recordsResolver map[string][]string
+
+func (r recordsResolver) LookupTXT(name string) ([]string, error) {
+	return r[name], nil
+}
+
+func readRawMessage(filename string) []byte {
+	raw, err := ioutil.ReadFile(filepath.Join("test-data", "mail", filename))
+	if err != nil {
+		panic(err)
+	}
+	return raw
+}
+
+func TestVerifyDKIM(t *testing.T) {
+	raw := readRawMessage("dkim-signed.raw")
+	mime, err := ReadMIMEBody(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	assert.Contains(t, mime.Text, "The report")
+
+	results, err := mime.VerifyDKIM(testDKIMKeys)
+	if !assert.NoError(t, err) || !assert.Equal(t, 2, len(results)) {
+		return
+	}
+	rsa, ed := results[0], results[1]
+	assert.Equal(t, DKIMPass, rsa.Status, "%v", rsa.Err)
+	assert.Equal(t, "rsa-sha256", rsa.Algorithm)
+	assert.Equal(t, "example.net", rsa.Domain)
+	assert.Equal(t, "rsa", rsa.Selector)
+	assert.Equal(t, "joe@mail.example.net", rsa.Identity)
+	assert.Equal(t, []string{"From", "To", "Subject", "Date", "Message-ID", "From"}, rsa.Headers)
+	assert.Equal(t, int64(39), rsa.BodyLength)
+	assert.Equal(t, DKIMPass, ed.Status, "%v", ed.Err)
+	assert.Equal(t, "@example.net", ed.Identity)
+	assert.Equal(t, int64(-1), ed.BodyLength)
+	assert.True(t, ed.Timestamp.Equal(time.Date(2013, time.June, 3, 8, 0, 0, 0, time.UTC)))
+
+	// Bare LF line endings
+	results, err = VerifyDKIM(bytes.Replace(raw, []byte("\r\n"), []byte("\n"), -1), testDKIMKeys)
+	if assert.NoError(t, err) && assert.Equal(t, 2, len(results)) {
+		assert.Equal(t, DKIMPass, results[0].Status, "%v", results[0].Err)
+		assert.Equal(t, DKIMPass, results[1].Status, "%v", results[1].Err)
+	}
+
+	// Text appended after the signed length only breaks the signature covering everything
+	results, _ = VerifyDKIM(append(raw, []byte("Unsigned footer\r\n")...), testDKIMKeys)
+	assert.Equal(t, DKIMPass, results[0].Status, "%v", results[0].Err)
+	assert.Equal(t, DKIMFail, results[1].Status)
+
+	// Modified header
+	results, _ = VerifyDKIM(bytes.Replace(raw, []byte("Quarterly"), []byte("Annual"), 1), testDKIMKeys)
+	assert.Equal(t, DKIMFail, results[0].Status)
+	assert.Equal(t, DKIMFail, results[1].Status)
+
+	// Added From header, protected against by the RSA signature only
+	results, _ = VerifyDKIM(append([]byte("From: mallory@example.org\r\n"), raw...), testDKIMKeys)
+	assert.Equal(t, DKIMFail, results[0].Status)
+	assert.Equal(t, DKIMPass, results[1].Status, "%v", results[1].Err)
+
+	// Key lookup failures
+	results, _ = VerifyDKIM(raw, MapKeyResolver{})
+	assert.Equal(t, DKIMPermError, results[0].Status)
+	results, _ = VerifyDKIM(raw, tempFailResolver{})
+	assert.Equal(t, DKIMTempError, results[0].Status)
+	assert.Equal(t, "temperror", results[0].Status.String())
+
+	// Separate TXT records are not joined, the first valid key record is used
+	key := testDKIMKeys["rsa._domainkey.example.net"]
+	results, _ = VerifyDKIM(raw, recordsResolver{
+		"rsa._domainkey.example.net": {"v=spf1 -all", key}})
+	assert.Equal(t, DKIMPass, results[0].Status, "%v", results[0].Err)
+	results, _ = VerifyDKIM(raw, recordsResolver{
+		"rsa._domainkey.example.net": {key[:100], key[100:]}})
+	assert.Equal(t, DKIMPermError, results[0].Status)
+}
+
+func TestVerifyDKIMRequiresRaw(t *testing.T) {
+	msg := readMessage("dkim-signed.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	_, err = mime.VerifyDKIM(testDKIMKeys)
+	assert.Error(t, err)
+}
+
+func TestVerifyDKIMMalformed(t *testing.T) {
+	var testTable = []struct {
+		signature string
+		status    DKIMStatus
+	}{
+		{"v=1; a=rsa-sha256; d=example.net; s=rsa; h=from; bh=; b=", DKIMFail},
+		{"v=1; a=rsa-sha1; d=example.net; s=rsa; h=from; bh=; b=", DKIMPermError},
+		{"v=1; a=rsa-sha256; d=example.net; s=rsa; h=to; bh=; b=", DKIMPermError},
+		{"v=1; a=rsa-sha256; d=example.net; s=rsa; h=from; bh=", DKIMPermError},
+		{"v=2; a=rsa-sha256; d=example.net; s=rsa; h=from; bh=; b=", DKIMPermError},
+		{"v=1; a=rsa-sha256; d=example.net; i=@example.com; s=rsa; h=from; bh=; b=", DKIMPermError},
+		{"v=1; a=rsa-sha256; d=example.net; s=rsa; h=from; x=1; bh=; b=", DKIMPermError},
+		{"v=1; v=1; a=rsa-sha256; d=example.net; s=rsa; h=from; bh=; b=", DKIMPermError},
+	}
+
+	for _, tt := range testTable {
+		raw := "DKIM-Signature: " + tt.signature + "\r\nFrom: joe@example.net\r\n\r\nHi\r\n"
+		results, err := VerifyDKIM([]byte(raw), testDKIMKeys)
+		if assert.NoError(t, err) && assert.Equal(t, 1, len(results)) {
+			assert.Equal(t, tt.status, results[0].Status, "Signature %q: %v", tt.signature, results[0].Err)
+		}
+	}
+}
+
+func TestDKIMCanonicalization(t *testing.T) {
+	// Examples from RFC 6376 section 3.4.6
+	fields, body, err := splitRawMessage([]byte("A: X\r\nB : Y\t\r\n\tZ  \r\n\r\n C \r\nD \t E\r\n\r\n\r\n"))
+	if !assert.NoError(t, err) || !assert.Equal(t, 2, len(fields)) {
+		return
+	}
+	assert.Equal(t, "a:X\r\n", string(canonicalHeader(fields[0], true)))
+	assert.Equal(t, "b:Y Z\r\n", string(canonicalHeader(fields[1], true)))
+	assert.Equal(t, "B : Y\t\r\n\tZ  \r\n", string(canonicalHeader(fields[1], false)))
+	assert.Equal(t, " C\r\nD E\r\n", string(canonicalBody(body, true)))
+	assert.Equal(t, " C \r\nD \t E\r\n", string(canonicalBody(body, false)))
+
+	assert.Equal(t, "", string(canonicalBody(nil, true)))
+	assert.Equal(t, "\r\n", string(canonicalBody([]byte("\r\n\r\n"), false)))
+	assert.Equal(t, "x\r\n", string(canonicalBody([]byte("x"), false)))
+}
@@ -0,0 +1,188 @@
+package enmime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDKIMHeaders are the header fields SignDKIM signs when DKIMSignOptions.Headers is
+// empty, if they are present in the message
+var DefaultDKIMHeaders = []string{
+	"From", "Reply-To", "To", "Cc", "Subject", "Date", "Message-ID", "In-Reply-To",
+	"References", "MIME-Version", "Content-Type", "Content-Transfer-Encoding",
+}
+
+// DKIMSignOptions configures SignDKIM
+type DKIMSignOptions struct {
+	Domain   string        // Signing domain (d= tag)
+	Selector string        // Key selector (s= tag)
+	Signer   crypto.Signer // An *rsa.PrivateKey or ed25519.PrivateKey
+	Identity string        // Agent or user identifier (i= tag), optional
+
+	// Headers lists the header fields to sign.  Names are used as given, so a name may be
+	// repeated, or name a field the message does not have, to prevent such fields from
+	// being added later.  If empty, the DefaultDKIMHeaders present in the message are
+	// signed.  From must be included.
+	Headers []string
+
+	// Canonicalization is the c= tag, such as "relaxed/simple"; relaxed/relaxed if empty
+	Canonicalization string
+
+	Time       time.Time     // Signature timestamp (t= tag); the current time if zero
+	Expiration time.Duration // Validity of the signature (x= tag); no expiration if zero
+}
+
+// SignDKIM computes a DKIM (RFC 6376) signature for the raw message and returns the
+// DKIM-Signature header field, terminated by CRLF, to be prepended to the message.  The
+// algorithm is rsa-sha256 or ed25519-sha256 (RFC 8463), depending on the key.
+func SignDKIM(raw []byte, opts *DKIMSignOptions) (string, error) {
+	if opts == nil || opts.Signer == nil || opts.Domain == "" || opts.Selector == "" {
+		return "", fmt.Errorf("DKIM signing requires a domain, selector and key")
+	}
+	var algorithm string
+	switch opts.Signer.Public().(type) {
+	case *rsa.PublicKey:
+		algorithm = "rsa-sha256"
+	case ed25519.PublicKey:
+		algorithm = "ed25519-sha256"
+	default:
+		return "", fmt.Errorf("Unsupported DKIM key type %T", opts.Signer.Public())
+	}
+	c := opts.Canonicalization
+	if c == "" {
+		c = "relaxed/relaxed"
+	}
+	relaxedHeader, relaxedBody, err := parseCanonicalization(c)
+	if err != nil {
+		return "", err
+	}
+	if opts.Identity != "" && !dkimDomainMatches(opts.Identity, strings.ToLower(opts.Domain)) {
+		return "", fmt.Errorf("Identity %v is not within domain %v", opts.Identity, opts.Domain)
+	}
+
+	fields, body, err := splitRawMessage(raw)
+	if err != nil {
+		return "", err
+	}
+	names := opts.Headers
+	if len(names) == 0 {
+		names = make([]string, 0, len(DefaultDKIMHeaders))
+		for _, name := range DefaultDKIMHeaders {
+			if len(selectHeaderFields(fields, []string{name})) > 0 {
+				names = append(names, name)
+			}
+		}
+	}
+	if !containsFold(names, "From") {
+		return "", fmt.Errorf("The From header must be signed")
+	}
+
+	signed := opts.Time
+	if signed.IsZero() {
+		signed = time.Now()
+	}
+	bodyHash := sha256.Sum256(canonicalBody(body, relaxedBody))
+
+	w := &dkimHeaderWriter{}
+	w.WriteString("DKIM-Signature:")
+	w.tag("v=1;")
+	w.tag("a=" + algorithm + ";")
+	w.tag("c=" + strings.ToLower(c) + ";")
+	w.tag("d=" + opts.Domain + ";")
+	w.tag("s=" + opts.Selector + ";")
+	if opts.Identity != "" {
+		w.tag("i=" + opts.Identity + ";")
+	}
+	w.tag("t=" + strconv.FormatInt(signed.Unix(), 10) + ";")
+	if opts.Expiration > 0 {
+		w.tag("x=" + strconv.FormatInt(signed.Add(opts.Expiration).Unix(), 10) + ";")
+	}
+	for i, name := range names {
+		sep := ":"
+		if i == len(names)-1 {
+			sep = ";"
+		}
+		if i == 0 {
+			w.tag("h=" + name + sep)
+		} else {
+			w.word(name + sep)
+		}
+	}
+	w.tag("bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + ";")
+	w.tag("b=")
+
+	sigField := rawHeaderField{name: "DKIM-Signature", raw: []byte(w.String() + "\r\n")}
+	digest := headerHash(fields, nil, sigField, names, relaxedHeader)
+	var hash crypto.Hash = crypto.SHA256
+	if algorithm == "ed25519-sha256" {
+		// Ed25519 signs the digest as a message
+		hash = crypto.Hash(0)
+	}
+	sig, err := opts.Signer.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return "", fmt.Errorf("Error signing message: %v", err)
+	}
+	w.split(base64.StdEncoding.EncodeToString(sig))
+	w.WriteString("\r\n")
+
+	return w.String(), nil
+}
+
+// dkimHeaderWriter builds a tag list header field, folding lines before they exceed 78
+// characters
+type dkimHeaderWriter struct {
+	bytes.Buffer
+}
+
+// tag writes a tag, preceded by a space or a fold
+func (w *dkimHeaderWriter) tag(s string) {
+	if w.lineLength()+1+len(s) > 78 {
+		w.WriteString("\r\n\t")
+	} else {
+		w.WriteString(" ")
+	}
+	w.WriteString(s)
+}
+
+// word continues the current tag value without a space, folding if needed
+func (w *dkimHeaderWriter) word(s string) {
+	if w.lineLength()+len(s) > 78 {
+		w.WriteString("\r\n\t")
+	}
+	w.WriteString(s)
+}
+
+// split continues the current tag value with s, which may be split over as many lines as
+// needed; used for base64 values
+func (w *dkimHeaderWriter) split(s string) {
+	for len(s) > 0 {
+		room := 78 - w.lineLength()
+		if room < 16 && room < len(s) {
+			w.WriteString("\r\n\t")
+			continue
+		}
+		if room > len(s) {
+			room = len(s)
+		}
+		w.WriteString(s[:room])
+		s = s[room:]
+	}
+}
+
+// lineLength returns the length of the last line written
+func (w *dkimHeaderWriter) lineLength() int {
+	b := w.Bytes()
+	if nl := bytes.LastIndexByte(b, '\n'); nl >= 0 {
+		return len(b) - nl - 1
+	}
+	return len(b)
+}
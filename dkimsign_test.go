@@ -0,0 +1,100 @@
+package enmime
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignDKIM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPub, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := MapKeyResolver{
+		"rsa._domainkey.example.org": "v=DKIM1; p=" + base64.StdEncoding.EncodeToString(rsaPub),
+		"ed._domainkey.example.org":  "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(edPub),
+	}
+
+	raw := readRawMessage("non-mime.raw")
+	var testTable = []struct {
+		opts    DKIMSignOptions
+		headers []string
+	}{
+		{
+			opts: DKIMSignOptions{Domain: "example.org", Selector: "rsa", Signer: rsaKey},
+			// Only the default headers present in the message
+			headers: []string{"From", "To", "Subject", "Date"},
+		},
+		{
+			opts: DKIMSignOptions{Domain: "example.org", Selector: "ed", Signer: edKey,
+				Canonicalization: "simple/simple", Identity: "bounces@lists.example.org"},
+		},
+		{
+			opts: DKIMSignOptions{Domain: "example.org", Selector: "rsa", Signer: rsaKey,
+				Canonicalization: "relaxed", Headers: []string{"from", "subject", "from", "reply-to"},
+				Time: time.Unix(1370246400, 0), Expiration: 1000000 * time.Hour},
+			headers: []string{"from", "subject", "from", "reply-to"},
+		},
+	}
+
+	for _, tt := range testTable {
+		header, err := SignDKIM(raw, &tt.opts)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.True(t, strings.HasSuffix(header, "\r\n"))
+		for _, line := range strings.Split(strings.TrimSuffix(header, "\r\n"), "\r\n") {
+			assert.True(t, len(line) <= 78, "Line too long: %q", line)
+		}
+
+		results, err := VerifyDKIM(append([]byte(header), raw...), resolver)
+		if assert.NoError(t, err) && assert.Equal(t, 1, len(results)) {
+			r := results[0]
+			assert.Equal(t, DKIMPass, r.Status, "Options %+v: %v\n%v", tt.opts, r.Err, header)
+			if tt.headers != nil {
+				assert.Equal(t, tt.headers, r.Headers)
+			}
+			if !tt.opts.Time.IsZero() {
+				assert.True(t, tt.opts.Time.Equal(r.Timestamp))
+				assert.True(t, r.Expiration.After(r.Timestamp))
+			}
+		}
+
+		// Any change to the message must be detected
+		tampered := strings.Replace(string(raw), "a test", "a toast", 1)
+		results, _ = VerifyDKIM([]byte(header+tampered), resolver)
+		assert.Equal(t, DKIMFail, results[0].Status)
+	}
+}
+
+func TestSignDKIMErrors(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	raw := readRawMessage("non-mime.raw")
+
+	_, err := SignDKIM(raw, nil)
+	assert.Error(t, err)
+	_, err = SignDKIM(raw, &DKIMSignOptions{Domain: "example.org", Selector: "ed"})
+	assert.Error(t, err)
+	_, err = SignDKIM(raw, &DKIMSignOptions{Domain: "example.org", Selector: "ed", Signer: edKey,
+		Headers: []string{"Subject"}})
+	assert.Error(t, err)
+	_, err = SignDKIM(raw, &DKIMSignOptions{Domain: "example.org", Selector: "ed", Signer: edKey,
+		Identity: "joe@example.com"})
+	assert.Error(t, err)
+	_, err = SignDKIM(raw, &DKIMSignOptions{Domain: "example.org", Selector: "ed", Signer: edKey,
+		Canonicalization: "strict/simple"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,475 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// EncodeOptions controls how EncodePart and MIMEBody.Encode write parts.
+type EncodeOptions struct {
+	// PreserveRaw writes parts read by ReadMIMEBody exactly as they were found, except
+	// that line breaks are CRLF, so that signatures computed over them remain valid.  Parts
+	// that were modified keep their original header fields, in order and as spelled, where
+	// they did not change, and multiparts keep their preamble and epilogue.  Other parts,
+	// and every part when PreserveRaw is false, are encoded from their header and content.
+	PreserveRaw bool
+}
+
+// EncodePart writes p and its children to w in wire format with CRLF line breaks.  The
+// boundaries and transfer encodings given in the headers are kept when they can carry the
+// content; otherwise a new boundary is generated, and text is encoded as quoted-printable
+// and other content as base64.  Decoded text is written as UTF-8.  opts may be nil.
+func EncodePart(w io.Writer, p MIMEPart, opts *EncodeOptions) error {
+	var buf bytes.Buffer
+	if err := encodePart(&buf, p, opts != nil && opts.PreserveRaw); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// Encode writes the message to w, see EncodePart.  The header of the message is written
+// from its fields, the body from the tree under Root, or from the decoded body of a
+// non-multipart message.  With PreserveRaw, a message read by ReadMIMEBody and not
+// modified since is written as it was read.  opts may be nil.
+func (m *MIMEBody) Encode(w io.Writer, opts *EncodeOptions) error {
+	preserve := opts != nil && opts.PreserveRaw
+	h := textproto.MIMEHeader(m.header)
+	if m.Root != nil {
+		// Root may have been replaced, e.g. by a decrypted entity, so the Content fields
+		// come from it and the others from the message
+		h = make(textproto.MIMEHeader)
+		for name, values := range m.header {
+			if !strings.HasPrefix(name, "Content-") {
+				h[name] = values
+			}
+		}
+		for name, values := range m.Root.Header() {
+			if strings.HasPrefix(name, "Content-") {
+				h[name] = values
+			}
+		}
+	}
+	if preserve && m.unmodified(h) {
+		_, err := w.Write(toCRLF(m.raw))
+		return err
+	}
+
+	var buf bytes.Buffer
+	if m.Root == nil {
+		mediatype, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+		if mediatype == "" {
+			mediatype = "text/plain"
+		}
+		p := &memMIMEPart{header: h, contentType: mediatype, content: m.body}
+		if m.raw != nil {
+			p.rawHeader = m.raw[:rawHeaderLength(m.raw)]
+		}
+		if body := m.rawBody(); preserve && body != nil {
+			writeEntityHeader(&buf, h, p, preserve)
+			buf.Write(body)
+		} else if err := encodeEntity(&buf, h, p, preserve); err != nil {
+			return err
+		}
+	} else if err := encodeEntity(&buf, h, m.Root, preserve); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// unmodified returns true if the message was read by ReadMIMEBody, its tree was not
+// modified since and h, its header, holds the fields that were read
+func (m *MIMEBody) unmodified(h textproto.MIMEHeader) bool {
+	if m.raw == nil {
+		return false
+	}
+	if m.Root != nil {
+		// The root of the tree that was read holds the whole message until it is modified
+		raw := rawContent(m.Root)
+		if len(raw) != len(m.raw) || len(raw) == 0 || &raw[0] != &m.raw[0] {
+			return false
+		}
+	}
+	_, orig := parseRawHeader(m.raw[:rawHeaderLength(m.raw)])
+	if orig == nil || len(orig) != len(h) {
+		return false
+	}
+	for name, values := range h {
+		if !equalValues(values, orig[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTo writes the message to w, encoding every part, see Encode
+func (m *MIMEBody) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	if err := m.Encode(&buf, nil); err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
+
+// rawBody returns the original body of the message, or nil if it is not known
+func (m *MIMEBody) rawBody() []byte {
+	if m.raw == nil {
+		return nil
+	}
+	_, body, err := splitRawMessage(m.raw)
+	if err != nil {
+		return nil
+	}
+	return body
+}
+
+// encodePart writes p and its children, using the original bytes of parts when preserve is
+// true and they are known
+func encodePart(w *bytes.Buffer, p MIMEPart, preserve bool) error {
+	if raw := rawContent(p); preserve && raw != nil {
+		w.Write(toCRLF(raw))
+		return nil
+	}
+	return encodeEntity(w, p.Header(), p, preserve)
+}
+
+// encodeEntity writes p with the header h
+func encodeEntity(w *bytes.Buffer, h textproto.MIMEHeader, p MIMEPart, preserve bool) error {
+	if h.Get("Content-Type") == "" && p.ContentType() != "" {
+		// Parts built in code may only have their media type
+		h = copyHeader(h)
+		h.Set("Content-Type", p.ContentType())
+	}
+	if strings.HasPrefix(p.ContentType(), "multipart/") {
+		mediatype, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+		if err != nil {
+			return fmt.Errorf("Unable to parse media type: %v", err)
+		}
+		boundary := params["boundary"]
+		if boundary == "" {
+			token, err := randomToken()
+			if err != nil {
+				return err
+			}
+			boundary = "enmime-" + token
+			params["boundary"] = boundary
+			h = copyHeader(h)
+			h.Set("Content-Type", mime.FormatMediaType(mediatype, params))
+		}
+		writeEntityHeader(w, h, p, preserve)
+		mp, _ := p.(*memMIMEPart)
+		if preserve && mp != nil {
+			w.Write(toCRLF(mp.preamble))
+		}
+		for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+			w.WriteString("--" + boundary + "\r\n")
+			if err := encodePart(w, c, preserve); err != nil {
+				return err
+			}
+			w.WriteString("\r\n")
+		}
+		w.WriteString("--" + boundary + "--\r\n")
+		if preserve && mp != nil {
+			w.Write(toCRLF(mp.epilogue))
+		}
+		return nil
+	}
+
+	content := p.Content()
+	if strings.HasPrefix(p.ContentType(), "text/") && !isASCII(content) {
+		// Text was decoded to UTF-8 while parsing
+		mediatype, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+		if h.Get("Content-Type") == "" {
+			mediatype, params, err = p.ContentType(), make(map[string]string), nil
+		}
+		if err == nil && !strings.EqualFold(params["charset"], "utf-8") {
+			params["charset"] = "utf-8"
+			h = copyHeader(h)
+			h.Set("Content-Type", mime.FormatMediaType(mediatype, params))
+		}
+	}
+	declared := h.Get("Content-Transfer-Encoding")
+	encoding := transferEncoding(declared, p.ContentType(), content)
+	if encoding != declared {
+		h = copyHeader(h)
+		h.Set("Content-Transfer-Encoding", encoding)
+	}
+	writeEntityHeader(w, h, p, preserve)
+
+	text := strings.HasPrefix(p.ContentType(), "text/")
+	switch strings.ToLower(encoding) {
+	case "base64":
+		enc := NewBase64Encoder(w)
+		enc.Write(content)
+		enc.Close()
+	case "quoted-printable":
+		enc := NewQuotedPrintableEncoder(w, !text)
+		enc.Write(content)
+		enc.Close()
+	case "binary":
+		w.Write(content)
+	default:
+		w.Write(toCRLF(content))
+	}
+	return nil
+}
+
+// transferEncoding returns the Content-Transfer-Encoding content is written with: the
+// declared one if it can carry the content, otherwise the one SelectTransferEncoding
+// chooses.  Unknown encodings are kept, as their content was not decoded.
+func transferEncoding(declared, mediatype string, content []byte) string {
+	text := strings.HasPrefix(mediatype, "text/")
+	switch strings.ToLower(declared) {
+	case "", "7bit":
+		if SelectTransferEncoding(content, text) == "7bit" {
+			return declared
+		}
+	case "8bit":
+		if bytes.IndexByte(content, 0) < 0 && maxLineLength(content) <= 998 &&
+			(text || !hasBareLineBreak(content)) {
+			return declared
+		}
+	default:
+		return declared
+	}
+	return SelectTransferEncoding(content, text)
+}
+
+// SelectTransferEncoding returns the Content-Transfer-Encoding best suited to content:
+// 7bit for ASCII content with lines of at most 998 characters, quoted-printable for text
+// that is mostly ASCII or has longer lines, and base64 for binary data or text where more
+// than one byte in six would need quoting.  Line breaks of text are written as CRLF, other
+// content needs CRLF line breaks to be sent as 7bit.
+func SelectTransferEncoding(content []byte, text bool) string {
+	special := 0
+	for _, c := range content {
+		switch {
+		case c == 0:
+			// Binary data
+			return "base64"
+		case c >= 0x7f || c < ' ' && c != '\t' && c != '\r' && c != '\n':
+			special++
+		}
+	}
+	if !text && hasBareLineBreak(content) {
+		return "base64"
+	}
+	if special == 0 && maxLineLength(content) <= 998 {
+		return "7bit"
+	}
+	if !text || special*6 > len(content) {
+		return "base64"
+	}
+	return "quoted-printable"
+}
+
+// hasBareLineBreak returns true if b holds a CR or LF that is not part of a CRLF
+func hasBareLineBreak(b []byte) bool {
+	for i, c := range b {
+		if c == '\n' && (i == 0 || b[i-1] != '\r') ||
+			c == '\r' && (i == len(b)-1 || b[i+1] != '\n') {
+			return true
+		}
+	}
+	return false
+}
+
+// copyHeader returns a copy of h that can be modified without affecting h
+func copyHeader(h textproto.MIMEHeader) textproto.MIMEHeader {
+	c := make(textproto.MIMEHeader, len(h))
+	for name, values := range h {
+		c[name] = append([]string(nil), values...)
+	}
+	return c
+}
+
+// isASCII returns true if b only holds 7-bit characters
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// maxLineLength returns the length of the longest line of b, without its line break
+func maxLineLength(b []byte) int {
+	max := 0
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		if n := len(bytes.TrimSuffix(line, []byte("\r"))); n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// headerOrder lists the header fields written first, in this order; the others follow
+// sorted by name
+var headerOrder = []string{
+	"Date", "From", "Reply-To", "To", "Cc", "Subject", "Message-Id", "In-Reply-To",
+	"References", "Mime-Version", "Content-Type", "Content-Transfer-Encoding",
+	"Content-Disposition", "Content-Id", "Content-Description",
+}
+
+// displayNames maps canonical header keys to their usual spelling
+var displayNames = map[string]string{
+	"Message-Id":                 "Message-ID",
+	"Mime-Version":               "MIME-Version",
+	"Content-Id":                 "Content-ID",
+	"Content-Md5":                "Content-MD5",
+	"Dkim-Signature":             "DKIM-Signature",
+	"Arc-Seal":                   "ARC-Seal",
+	"Arc-Message-Signature":      "ARC-Message-Signature",
+	"Arc-Authentication-Results": "ARC-Authentication-Results",
+}
+
+// writeEntityHeader writes h as the header of p.  If preserve is true and the original
+// header of p is known, its fields are kept where h did not change them, see
+// writeMergedHeader.
+func writeEntityHeader(w *bytes.Buffer, h textproto.MIMEHeader, p MIMEPart, preserve bool) {
+	if mp, ok := p.(*memMIMEPart); ok && preserve && mp.rawHeader != nil {
+		if fields, orig := parseRawHeader(mp.rawHeader); orig != nil {
+			writeMergedHeader(w, h, fields, orig)
+			return
+		}
+	}
+	writeHeader(w, h)
+}
+
+// parseRawHeader returns the fields of a raw header and the header they parse into, or
+// nils if it is malformed
+func parseRawHeader(raw []byte) ([]rawHeaderField, textproto.MIMEHeader) {
+	raw = toCRLF(raw)
+	if !bytes.HasSuffix(raw, []byte("\r\n\r\n")) && !bytes.Equal(raw, []byte("\r\n")) {
+		// No body follows
+		raw = append(append([]byte(nil), raw...), "\r\n"...)
+	}
+	fields, _, err := splitRawMessage(raw)
+	if err != nil {
+		return nil, nil
+	}
+	h, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(raw))).ReadMIMEHeader()
+	if err != nil {
+		return nil, nil
+	}
+	return fields, h
+}
+
+// writeMergedHeader writes h followed by a blank line, keeping the original fields, which
+// parsed into orig, of the names whose values did not change: they are written as found.
+// Changed fields are written in place of the first original field of their name, with its
+// spelling, and new fields at the end.
+func writeMergedHeader(w *bytes.Buffer, h textproto.MIMEHeader, fields []rawHeaderField,
+	orig textproto.MIMEHeader) {
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		display := strings.TrimRight(f.name, " \t")
+		name := textproto.CanonicalMIMEHeaderKey(display)
+		if equalValues(h[name], orig[name]) {
+			w.Write(f.raw)
+			if !bytes.HasSuffix(f.raw, []byte("\r\n")) {
+				w.WriteString("\r\n")
+			}
+		} else if !seen[name] {
+			for _, v := range h[name] {
+				writeField(w, display, v)
+			}
+		}
+		seen[name] = true
+	}
+	added := make(textproto.MIMEHeader)
+	for name, values := range h {
+		if !seen[name] {
+			added[name] = values
+		}
+	}
+	writeHeader(w, added)
+}
+
+// equalValues returns true if a and b hold the same values in the same order
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeHeader writes the header fields of h followed by a blank line
+func writeHeader(w *bytes.Buffer, h textproto.MIMEHeader) {
+	names := make([]string, 0, len(h))
+	seen := make(map[string]bool)
+	for _, name := range headerOrder {
+		if _, ok := h[name]; ok {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	rest := make([]string, 0, len(h))
+	for name := range h {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range append(names, rest...) {
+		display := name
+		if d, ok := displayNames[name]; ok {
+			display = d
+		}
+		for _, v := range h[name] {
+			writeField(w, display, v)
+		}
+	}
+	w.WriteString("\r\n")
+}
+
+// writeField writes a header field, folded at whitespace so that its lines do not exceed
+// 78 characters where possible.  Lines without whitespace to fold at are limited to 998
+// characters by the values they can hold.  Values may already be folded with CRLF.
+func writeField(w *bytes.Buffer, name, value string) {
+	for i, line := range strings.Split(name+": "+value, "\r\n") {
+		min := 1
+		if i == 0 {
+			min = len(name) + 2
+		}
+		for len(line) > 78 {
+			cut := foldPoint(line, min)
+			if cut < 0 {
+				break
+			}
+			w.WriteString(line[:cut] + "\r\n")
+			line, min = line[cut:], 1
+		}
+		w.WriteString(line + "\r\n")
+	}
+}
+
+// foldPoint returns the index of the whitespace line is best folded before: the last one
+// leaving at most 78 characters on the first line, or else the first one.  Whitespace
+// before min, before any other character or after the last one is not used.  -1 is
+// returned if there is none.
+func foldPoint(line string, min int) int {
+	last := len(strings.TrimRight(line, " \t"))
+	cut, content := -1, false
+	for i := 0; i < last && (i <= 78 || cut < 0); i++ {
+		if line[i] != ' ' && line[i] != '\t' {
+			content = true
+		} else if content && i >= min {
+			cut = i
+		}
+	}
+	return cut
+}
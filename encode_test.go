@@ -0,0 +1,258 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// reencode encodes mime and reads the result back
+func reencode(t *testing.T, mime *MIMEBody, opts *EncodeOptions) (*MIMEBody, []byte) {
+	var buf bytes.Buffer
+	if err := mime.Encode(&buf, opts); err != nil {
+		t.Fatalf("Failed to encode message: %v", err)
+	}
+	out, err := ReadMIMEBody(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read encoded message: %v\n%s", err, buf.Bytes())
+	}
+	return out, buf.Bytes()
+}
+
+func TestEncodeMultipart(t *testing.T) {
+	for _, name := range []string{"attachment.raw", "html-mime-inline.raw", "mime-mixed.raw",
+		"17-with-attachments.eml"} {
+		mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage(name)))
+		if err != nil {
+			t.Fatalf("Failed to read %v: %v", name, err)
+		}
+		out, raw := reencode(t, mime, nil)
+
+		assert.NotContains(t, strings.Replace(string(raw), "\r\n", "", -1), "\n", name)
+		// Line breaks are written as CRLF
+		lf := func(s string) string { return strings.Replace(s, "\r\n", "\n", -1) }
+		assert.Equal(t, lf(mime.Text), lf(out.Text), name)
+		assert.Equal(t, lf(mime.Html), lf(out.Html), name)
+		assert.Equal(t, mime.GetHeader("Subject"), out.GetHeader("Subject"), name)
+		if assert.Equal(t, len(mime.Attachments), len(out.Attachments), name) {
+			for i, a := range mime.Attachments {
+				assert.Equal(t, a.FileName(), out.Attachments[i].FileName(), name)
+				assert.Equal(t, a.Content(), out.Attachments[i].Content(), name)
+			}
+		}
+		assert.Equal(t, len(mime.Inlines), len(out.Inlines), name)
+	}
+}
+
+func TestEncodeNonMultipart(t *testing.T) {
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("16-latin_1_text_body.eml")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	out, raw := reencode(t, mime, nil)
+	assert.Contains(t, string(raw), "Content-Type: text/plain; charset=utf-8; format=flowed\r\n")
+	assert.Contains(t, string(raw), "Content-Transfer-Encoding: quoted-printable\r\n")
+	assert.Equal(t, mime.Text, out.Text)
+
+	// The original body is kept
+	_, raw = reencode(t, mime, &EncodeOptions{PreserveRaw: true})
+	assert.Contains(t, string(raw), "Content-Type: text/plain; charset=ISO-8859-1; format=flowed\r\n")
+	assert.True(t, bytes.HasSuffix(raw, mime.rawBody()))
+}
+
+func TestEncodePreserveRaw(t *testing.T) {
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("smime-signed.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	signed := rawContent(mime.Root.FirstChild())
+	out, raw := reencode(t, mime, &EncodeOptions{PreserveRaw: true})
+	assert.Contains(t, string(raw), string(signed))
+	sigs, err := out.VerifySMIME(testSMIMERoots())
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(sigs)) {
+		assert.True(t, sigs[0].Valid)
+	}
+
+	mime, err = ReadMIMEBody(bytes.NewReader(readRawMessage("pgp-signed.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	out, _ = reencode(t, mime, &EncodeOptions{PreserveRaw: true})
+	pgpSigs, err := out.VerifyPGP(readKeyRing("pubring.asc"))
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(pgpSigs)) {
+		assert.True(t, pgpSigs[0].Valid, "%v", pgpSigs[0].Err)
+	}
+}
+
+func TestEncodePart(t *testing.T) {
+	// The declared encoding cannot carry the content
+	p := NewMIMEPart(nil, "text/plain")
+	p.header = textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=iso-8859-1"},
+		"Content-Transfer-Encoding": {"7bit"},
+	}
+	p.content = []byte("Mit freundlichen Grüßen aus der Stadt\n")
+	var buf bytes.Buffer
+	if assert.NoError(t, EncodePart(&buf, p, nil)) {
+		assert.Equal(t, "Content-Type: text/plain; charset=utf-8\r\n"+
+			"Content-Transfer-Encoding: quoted-printable\r\n\r\n"+
+			"Mit freundlichen Gr=C3=BC=C3=9Fen aus der Stadt\r\n", buf.String())
+	}
+	assert.Equal(t, "7bit", p.Header().Get("Content-Transfer-Encoding"), "header was modified")
+
+	// A multipart without boundary gets one
+	root, err := newMultipart("multipart/mixed", nil, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.header.Set("Content-Type", "multipart/mixed")
+	buf.Reset()
+	if assert.NoError(t, EncodePart(&buf, root, nil)) {
+		part, err := ParseMIME(bufio.NewReader(bytes.NewReader(buf.Bytes())))
+		if assert.NoError(t, err) && assert.NotNil(t, part.FirstChild()) {
+			assert.Equal(t, "Mit freundlichen Grüßen aus der Stadt\r\n",
+				string(part.FirstChild().Content()))
+		}
+	}
+
+	assert.Equal(t, "base64", transferEncoding("7bit", "image/png", []byte("\x89PNG")))
+	assert.Equal(t, "8bit", transferEncoding("8bit", "text/plain", []byte("Grüße")))
+	assert.Equal(t, "quoted-printable", transferEncoding("8bit", "text/plain",
+		[]byte(strings.Repeat("a", 1000))))
+	assert.Equal(t, "x-uuencode", transferEncoding("x-uuencode", "text/plain", []byte("\x00")))
+}
+
+func TestEncodeBuiltTree(t *testing.T) {
+	// Parts without a header are written with their media type
+	png := []byte("\x89PNG\r\n\x1a\nimage")
+	root := NewMIMEPart(nil, "multipart/mixed")
+	text := NewMIMEPart(nil, "text/plain")
+	image := NewMIMEPart(nil, "image/png")
+	assert.NoError(t, SetContent(text, []byte("See the image\n")))
+	assert.NoError(t, SetContent(image, png))
+	assert.NoError(t, AppendChild(root, text))
+	assert.NoError(t, AppendChild(root, image))
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, EncodePart(&buf, root, nil)) {
+		return
+	}
+	part, err := ParseMIME(bufio.NewReader(bytes.NewReader(buf.Bytes())))
+	if !assert.NoError(t, err, "%s", buf.Bytes()) {
+		return
+	}
+	assert.Equal(t, "multipart/mixed", part.ContentType())
+	if c := part.FirstChild(); assert.NotNil(t, c) {
+		assert.Equal(t, "text/plain", c.ContentType())
+		assert.Equal(t, "See the image\r\n", string(c.Content()))
+		if c = c.NextSibling(); assert.NotNil(t, c) {
+			assert.Equal(t, "image/png", c.ContentType())
+			assert.Equal(t, png, c.Content())
+		}
+	}
+}
+
+func TestSelectTransferEncoding(t *testing.T) {
+	assert.Equal(t, "7bit", SelectTransferEncoding([]byte("Plain text\nlines\n"), true))
+	assert.Equal(t, "7bit", SelectTransferEncoding([]byte("{\"a\": 1}\r\n"), false))
+	assert.Equal(t, "quoted-printable", SelectTransferEncoding([]byte("Mostly ASCII text, ça va\n"), true))
+	assert.Equal(t, "quoted-printable",
+		SelectTransferEncoding([]byte(strings.Repeat("long line ", 100)), true))
+	assert.Equal(t, "base64", SelectTransferEncoding([]byte("Привет, как дела?"), true))
+	assert.Equal(t, "base64", SelectTransferEncoding([]byte("text\x00with a NUL"), true))
+	// Other content only keeps its line breaks as CRLF
+	assert.Equal(t, "base64", SelectTransferEncoding([]byte("a\nb"), false))
+	assert.Equal(t, "base64", SelectTransferEncoding([]byte("Mostly ASCII, ça va\r\n"), false))
+}
+
+func TestEncodePreserveDKIM(t *testing.T) {
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("dkim-signed.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	out, _ := reencode(t, mime, &EncodeOptions{PreserveRaw: true})
+	results, err := out.VerifyDKIM(testDKIMKeys)
+	if assert.NoError(t, err) && assert.Equal(t, 2, len(results)) {
+		assert.Equal(t, DKIMPass, results[0].Status, "%v", results[0].Err)
+		assert.Equal(t, DKIMPass, results[1].Status, "%v", results[1].Err)
+	}
+
+	// A multipart message with a preamble and an epilogue
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := MapKeyResolver{
+		"ed._domainkey.example.org": "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub),
+	}
+	raw := "From: joe@example.org\r\nTo: jane@example.net\r\n" +
+		"Subject: A subject that is folded\r\n over two lines\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=\"b\"\r\n\r\n" +
+		"This is a multi-part message in MIME format.\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nFirst\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nSecond\r\n" +
+		"--b--\r\nEpilogue\r\n"
+	var sigs string
+	for _, c := range []string{"relaxed/relaxed", "simple/simple"} {
+		sig, err := SignDKIM([]byte(raw), &DKIMSignOptions{Domain: "example.org", Selector: "ed",
+			Signer: key, Canonicalization: c})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigs += sig
+	}
+	mime, err = ReadMIMEBody(strings.NewReader(sigs + raw))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	out, encoded := reencode(t, mime, &EncodeOptions{PreserveRaw: true})
+	assert.Equal(t, sigs+raw, string(encoded))
+	results, err = out.VerifyDKIM(resolver)
+	if assert.NoError(t, err) && assert.Equal(t, 2, len(results)) {
+		assert.Equal(t, DKIMPass, results[0].Status, "%v", results[0].Err)
+		assert.Equal(t, DKIMPass, results[1].Status, "%v", results[1].Err)
+	}
+
+	// Once modified, the original fields, preamble and epilogue are kept
+	assert.NoError(t, SetContent(mime.Root.FirstChild(), []byte("Changed\r\n")))
+	out, encoded = reencode(t, mime, &EncodeOptions{PreserveRaw: true})
+	assert.True(t, strings.HasPrefix(string(encoded), sigs+"From: joe@example.org\r\n"))
+	assert.Contains(t, string(encoded), "Subject: A subject that is folded\r\n over two lines\r\n")
+	assert.Contains(t, string(encoded), "\r\n\r\nThis is a multi-part message in MIME format.\r\n--b\r\n")
+	assert.Contains(t, string(encoded), "Content-Type: text/plain\r\n\r\nSecond\r\n")
+	assert.True(t, strings.HasSuffix(string(encoded), "\r\n--b--\r\nEpilogue\r\n"))
+	assert.Equal(t, "Changed\r\n", string(out.Root.FirstChild().Content()))
+	results, _ = out.VerifyDKIM(resolver)
+	if assert.Equal(t, 2, len(results)) {
+		assert.Equal(t, DKIMFail, results[0].Status)
+	}
+}
+
+func TestWriteField(t *testing.T) {
+	var buf bytes.Buffer
+	value := strings.Repeat("word ", 40) + "end"
+	writeField(&buf, "X-Long", value)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	assert.True(t, len(lines) > 2)
+	for _, line := range lines {
+		assert.True(t, len(line) <= 78, "Line too long: %q", line)
+	}
+	assert.Equal(t, "X-Long: "+value, strings.Replace(buf.String()[:buf.Len()-2], "\r\n", "", -1))
+
+	// Without whitespace the line cannot be folded
+	buf.Reset()
+	writeField(&buf, "References", "<"+strings.Repeat("x", 100)+"@example.net>")
+	assert.Equal(t, 1, strings.Count(buf.String(), "\r\n"))
+
+	// Values that are already folded are kept
+	buf.Reset()
+	writeField(&buf, "Subject", "=?utf-8?q?a?=\r\n =?utf-8?q?b?=")
+	assert.Equal(t, "Subject: =?utf-8?q?a?=\r\n =?utf-8?q?b?=\r\n", buf.String())
+}
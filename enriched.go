@@ -0,0 +1,332 @@
+package enmime
+
+import (
+	"html"
+	"strings"
+)
+
+// Conversion of text/enriched (RFC 1896) and its predecessor text/richtext (RFC 1341)
+// into plain text and HTML.  Both formats mark up text with <command> ... </command>
+// pairs, unknown commands are ignored but their content is displayed.
+
+// enrichedTokenKind identifies the type of an enrichedToken
+type enrichedTokenKind int
+
+const (
+	enrichedText  enrichedTokenKind = iota // A run of displayable text
+	enrichedBreak                          // A hard line break
+	enrichedOpen                           // An opening <command>
+	enrichedClose                          // A closing </command>
+)
+
+// enrichedToken is a lexical unit of a text/enriched or text/richtext document
+type enrichedToken struct {
+	kind  enrichedTokenKind
+	text  string // Text for enrichedText, lower cased command name otherwise
+	param string // Content of the <param> following an enrichedOpen
+}
+
+// tokenizeEnriched splits an enriched document into tokens, applying the line break rules
+// of the format.  In text/enriched a single line break is a space and a run of n line
+// breaks is n-1 hard breaks, unless inside <nofill>.  In text/richtext line breaks are
+// always spaces; hard breaks are written as <nl> or <np>, and "<" as <lt>.
+func tokenizeEnriched(input string, richtext bool) []enrichedToken {
+	input = strings.Replace(input, "\r\n", "\n", -1)
+	tokens := make([]enrichedToken, 0, 16)
+	text := make([]byte, 0, len(input))
+	flush := func() {
+		if len(text) > 0 {
+			tokens = append(tokens, enrichedToken{kind: enrichedText, text: string(text)})
+			text = text[:0]
+		}
+	}
+	lastOpen := -1
+	nofill := 0
+
+	for i := 0; i < len(input); i++ {
+		switch c := input[i]; {
+		case c == '<' && !richtext && i+1 < len(input) && input[i+1] == '<':
+			text = append(text, '<')
+			i++
+		case c == '<':
+			end := strings.IndexByte(input[i:], '>')
+			if end < 0 {
+				// Unterminated command, treat as text
+				text = append(text, input[i:]...)
+				i = len(input)
+				break
+			}
+			name := strings.ToLower(input[i+1 : i+end])
+			i += end
+			closing := strings.HasPrefix(name, "/")
+			name = strings.TrimPrefix(name, "/")
+
+			switch {
+			case richtext && name == "lt":
+				text = append(text, '<')
+				continue
+			case richtext && (name == "nl" || name == "np"):
+				flush()
+				tokens = append(tokens, enrichedToken{kind: enrichedBreak})
+				continue
+			case !richtext && name == "param" && !closing:
+				// Parameter of the preceding command, not displayed
+				stop := strings.Index(strings.ToLower(input[i+1:]), "</param>")
+				if stop < 0 {
+					stop = len(input) - i - 1
+				}
+				if lastOpen >= 0 {
+					tokens[lastOpen].param = input[i+1 : i+1+stop]
+				}
+				i += stop + len("</param>")
+				continue
+			case name == "nofill" && !richtext:
+				if closing && nofill > 0 {
+					nofill--
+				} else if !closing {
+					nofill++
+				}
+			}
+
+			flush()
+			if closing {
+				tokens = append(tokens, enrichedToken{kind: enrichedClose, text: name})
+			} else {
+				tokens = append(tokens, enrichedToken{kind: enrichedOpen, text: name})
+				lastOpen = len(tokens) - 1
+			}
+		case c == '\n':
+			n := 1
+			for i+1 < len(input) && input[i+1] == '\n' {
+				n++
+				i++
+			}
+			switch {
+			case richtext:
+				text = append(text, ' ')
+			case nofill > 0:
+				flush()
+				for ; n > 0; n-- {
+					tokens = append(tokens, enrichedToken{kind: enrichedBreak})
+				}
+			case n == 1:
+				text = append(text, ' ')
+			default:
+				flush()
+				for ; n > 1; n-- {
+					tokens = append(tokens, enrichedToken{kind: enrichedBreak})
+				}
+			}
+		default:
+			text = append(text, c)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// isHiddenEnriched returns true for commands whose content must not be displayed
+func isHiddenEnriched(name string) bool {
+	return name == "comment"
+}
+
+// enrichedToText converts a text/enriched (or text/richtext) document to plain text.
+// Formatting is dropped and excerpts are quoted with "> ".
+func enrichedToText(input string, richtext bool) string {
+	out := make([]byte, 0, len(input))
+	excerpt, hidden := 0, 0
+	lineStart := true
+
+	for _, tok := range tokenizeEnriched(input, richtext) {
+		switch tok.kind {
+		case enrichedOpen, enrichedClose:
+			counter := &excerpt
+			if isHiddenEnriched(tok.text) {
+				counter = &hidden
+			} else if tok.text != "excerpt" {
+				continue
+			}
+			if tok.kind == enrichedOpen {
+				*counter++
+			} else if *counter > 0 {
+				*counter--
+			}
+		case enrichedBreak:
+			if hidden == 0 {
+				out = append(out, '\n')
+				lineStart = true
+			}
+		case enrichedText:
+			if hidden > 0 {
+				continue
+			}
+			if lineStart && excerpt > 0 {
+				out = append(out, strings.Repeat("> ", excerpt)...)
+			}
+			out = append(out, tok.text...)
+			lineStart = false
+		}
+	}
+
+	return string(out)
+}
+
+// enrichedHtmlTags maps enriched commands to the HTML elements used to render them
+var enrichedHtmlTags = map[string][2]string{
+	"bold":        {"<b>", "</b>"},
+	"italic":      {"<i>", "</i>"},
+	"underline":   {"<u>", "</u>"},
+	"fixed":       {"<tt>", "</tt>"},
+	"smaller":     {"<small>", "</small>"},
+	"bigger":      {"<big>", "</big>"},
+	"center":      {`<div style="text-align:center">`, "</div>"},
+	"flushleft":   {`<div style="text-align:left">`, "</div>"},
+	"flushright":  {`<div style="text-align:right">`, "</div>"},
+	"flushboth":   {`<div style="text-align:justify">`, "</div>"},
+	"indent":      {`<div style="margin-left:2em">`, "</div>"},
+	"indentright": {`<div style="margin-right:2em">`, "</div>"},
+	"excerpt":     {"<blockquote>", "</blockquote>"},
+	"nofill":      {"<pre>", "</pre>"},
+	"heading":     {"<h3>", "</h3>"},
+	"footing":     {"<h6>", "</h6>"},
+	"signature":   {`<div class="signature">`, "</div>"},
+}
+
+// enrichedParam strips a command parameter down to characters that are safe to place in
+// an HTML attribute or CSS value
+func enrichedParam(param string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == ' ', r == '-', r == ',', r == '#':
+			return r
+		}
+		return -1
+	}, strings.TrimSpace(param))
+}
+
+// enrichedColor converts a <color> parameter, which is either a color name or a comma
+// separated list of 16-bit hex red, green and blue values, into a CSS color.
+func enrichedColor(param string) string {
+	param = enrichedParam(param)
+	rgb := strings.Split(param, ",")
+	if len(rgb) != 3 {
+		return param
+	}
+	color := "#"
+	for _, c := range rgb {
+		c = strings.TrimSpace(c)
+		if len(c) < 2 {
+			c = "0" + c
+		}
+		color += c[:2]
+	}
+	return color
+}
+
+// enrichedOpenTag returns the HTML used to open the element for tok, or "" if the command
+// is not rendered
+func enrichedOpenTag(tok enrichedToken) string {
+	if tags, ok := enrichedHtmlTags[tok.text]; ok {
+		return tags[0]
+	}
+	param := enrichedParam(tok.param)
+	switch tok.text {
+	case "color":
+		return `<span style="color:` + enrichedColor(tok.param) + `">`
+	case "fontfamily":
+		return `<span style="font-family:` + param + `">`
+	case "lang":
+		return `<span lang="` + param + `">`
+	case "paraindent":
+		return `<div style="margin-left:2em">`
+	}
+	return ""
+}
+
+// enrichedCloseTag returns the HTML used to close the element for the named command
+func enrichedCloseTag(name string) string {
+	if tags, ok := enrichedHtmlTags[name]; ok {
+		return tags[1]
+	}
+	switch name {
+	case "color", "fontfamily", "lang":
+		return "</span>"
+	case "paraindent":
+		return "</div>"
+	}
+	return ""
+}
+
+// enrichedToHtml converts a text/enriched (or text/richtext) document to HTML.  Elements
+// are kept properly nested: a close command also closes the elements opened after its
+// command, and closes without an open command are dropped.
+func enrichedToHtml(input string, richtext bool) string {
+	out := make([]byte, 0, len(input)*2)
+	out = append(out, "<html><body>"...)
+	hidden, nofill := 0, 0
+	var open []string // Commands whose element is open, innermost last
+	closeFrom := func(i int) {
+		for j := len(open) - 1; j >= i; j-- {
+			out = append(out, enrichedCloseTag(open[j])...)
+			if open[j] == "nofill" {
+				nofill--
+			}
+		}
+		open = open[:i]
+	}
+
+	for _, tok := range tokenizeEnriched(input, richtext) {
+		switch tok.kind {
+		case enrichedOpen:
+			if isHiddenEnriched(tok.text) {
+				hidden++
+			}
+			if hidden > 0 {
+				continue
+			}
+			if tag := enrichedOpenTag(tok); tag != "" {
+				out = append(out, tag...)
+				open = append(open, tok.text)
+				if tok.text == "nofill" {
+					nofill++
+				}
+			}
+		case enrichedClose:
+			if isHiddenEnriched(tok.text) {
+				if hidden > 0 {
+					hidden--
+				}
+				continue
+			}
+			if hidden > 0 {
+				continue
+			}
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == tok.text {
+					closeFrom(i)
+					break
+				}
+			}
+		case enrichedBreak:
+			if hidden > 0 {
+				continue
+			}
+			if nofill > 0 {
+				out = append(out, '\n')
+			} else {
+				out = append(out, "<br>\n"...)
+			}
+		case enrichedText:
+			if hidden == 0 {
+				out = append(out, html.EscapeString(tok.text)...)
+			}
+		}
+	}
+
+	closeFrom(0)
+	out = append(out, "</body></html>"...)
+	return string(out)
+}
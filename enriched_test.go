@@ -0,0 +1,110 @@
+package enmime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrichedToText(t *testing.T) {
+	var testTable = []struct {
+		input, expect string
+	}{
+		{"", ""},
+		{"Plain", "Plain"},
+		{"<bold>Bold</bold> text", "Bold text"},
+		{"One\r\nline", "One line"},
+		{"Two\n\nlines", "Two\nlines"},
+		{"Three\n\n\nlines", "Three\n\nlines"},
+		{"Less <<than", "Less <than"},
+		{"<color><param>red</param>Red</color>", "Red"},
+		{"<nofill>Keep\nbreaks</nofill>", "Keep\nbreaks"},
+		{"Quote:\n\n<excerpt>Old\n\ntext</excerpt>", "Quote:\n> Old\n> text"},
+		{"<unknown>Shown</unknown>", "Shown"},
+	}
+
+	for _, tt := range testTable {
+		result := enrichedToText(tt.input, false)
+		assert.Equal(t, tt.expect, result,
+			"Expected %q, got %q for input %q", tt.expect, result, tt.input)
+	}
+}
+
+func TestRichtextToText(t *testing.T) {
+	var testTable = []struct {
+		input, expect string
+	}{
+		{"<bold>Bold</bold> text", "Bold text"},
+		{"Soft\r\nbreak", "Soft break"},
+		{"Hard<nl>break", "Hard\nbreak"},
+		{"Less <lt>than", "Less <than"},
+		{"Hidden<comment>secret</comment>", "Hidden"},
+	}
+
+	for _, tt := range testTable {
+		result := enrichedToText(tt.input, true)
+		assert.Equal(t, tt.expect, result,
+			"Expected %q, got %q for input %q", tt.expect, result, tt.input)
+	}
+}
+
+func TestEnrichedToHtml(t *testing.T) {
+	var testTable = []struct {
+		input, expect string
+	}{
+		{"<bold>Bold</bold> & text", "<b>Bold</b> &amp; text"},
+		{"Two\n\nlines", "Two<br>\nlines"},
+		{"<<html>", "&lt;html&gt;"},
+		{"<color><param>red</param>Red</color>", `<span style="color:red">Red</span>`},
+		{"<color><param>ffff,0000,8000</param>Pink</color>", `<span style="color:#ff0080">Pink</span>`},
+		{`<fontfamily><param>x"><script></param>F</fontfamily>`, `<span style="font-family:xscript">F</span>`},
+		{"<nofill>Keep\nbreaks</nofill>", "<pre>Keep\nbreaks</pre>"},
+		{"Not</bold> bold</italic>", "Not bold"},
+		{"<bold>Bold<italic>both</bold>plain</italic>", "<b>Bold<i>both</i></b>plain"},
+		{"<bold><nofill>Pre</bold>\n\nafter", "<b><pre>Pre</pre></b><br>\n<br>\nafter"},
+		{"<underline>Unclosed", "<u>Unclosed</u>"},
+		{"<comment></bold></comment><bold>B</bold>", "<b>B</b>"},
+	}
+
+	for _, tt := range testTable {
+		expect := "<html><body>" + tt.expect + "</body></html>"
+		result := enrichedToHtml(tt.input, false)
+		assert.Equal(t, expect, result,
+			"Expected %q, got %q for input %q", expect, result, tt.input)
+	}
+}
+
+func TestParseEnriched(t *testing.T) {
+	msg := readMessage("enriched.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse non-MIME: %v", err)
+	}
+
+	assert.Equal(t, "Now is the time for all good men\n(and <women>) to come to the aid of their\n> beloved country ",
+		mime.Text)
+	assert.Contains(t, mime.Html, "<b>Now</b> is the time for <i>all</i> good men<br>")
+	assert.Contains(t, mime.Html, "<blockquote>beloved country</blockquote>")
+}
+
+func TestParseEnrichedAlternative(t *testing.T) {
+	// Enriched text is only used when preferred over the plain and HTML alternatives
+	msg := readMessage("mime-alternative.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.NotContains(t, mime.Text, "Enriched")
+	assert.NotContains(t, mime.Html, "Enriched")
+
+	msg = readMessage("mime-alternative.raw")
+	mime, err = ParseMIMEBodyOptions(msg, &ParseOptions{
+		Alternatives: []string{"text/plain", "text/enriched", "text/html"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "Flowed plain section\n--\nTrailing section", mime.Text)
+	assert.Equal(t, "<html><body><b>Enriched</b> section</body></html>", mime.Html)
+	assert.Equal(t, 1, len(mime.Inlines), "Should have one inline")
+}
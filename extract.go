@@ -0,0 +1,212 @@
+package enmime
+
+import (
+	"encoding/json"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFileName is the longest file name, in bytes, SafeFileName returns
+const maxFileName = 200
+
+// ExtractOptions controls ExtractAttachments
+type ExtractOptions struct {
+	// Manifest is the name of a JSON file listing the extracted files that is written to
+	// the directory, after SafeFileName.  If empty, no manifest is written.  The file must
+	// not exist: unlike the extracted files, it is not renamed.
+	Manifest string
+}
+
+// ExtractedFile describes a part written by ExtractAttachments
+type ExtractedFile struct {
+	Part        MIMEPart  `json:"-"`
+	Name        string    `json:"name"`        // Name of the file in the directory
+	FileName    string    `json:"fileName"`    // File name given by the part, may be unsafe
+	ContentType string    `json:"contentType"` // Content-Type without parameters
+	Disposition string    `json:"disposition"` // attachment or inline
+	Size        int       `json:"size"`        // Length of the decoded content
+	ModTime     time.Time `json:"modTime"`     // Content-Disposition modification-date, or zero
+}
+
+// ExtractAttachments writes the content of the Attachments and Inlines of the message to
+// files in dir, which is created if needed, and returns a manifest of what was written.
+// File names are made safe with SafeFileName and deduplicated, case-insensitively, by
+// adding a counter; existing files are never overwritten.  Parts without a file name are
+// named after their content type.  The modification time of a file is set from the
+// modification-date parameter of Content-Disposition if there is one.  opts may be nil.
+func (m *MIMEBody) ExtractAttachments(dir string, opts *ExtractOptions) ([]ExtractedFile, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	manifest := ""
+	if opts != nil && opts.Manifest != "" {
+		manifest = SafeFileName(opts.Manifest)
+		used[strings.ToLower(manifest)] = true
+		// Fail before extracting anything
+		if _, err := os.Lstat(filepath.Join(dir, manifest)); err == nil {
+			return nil, &os.PathError{Op: "create", Path: filepath.Join(dir, manifest), Err: os.ErrExist}
+		}
+	}
+
+	parts := append(append([]MIMEPart(nil), m.Attachments...), m.Inlines...)
+	files := make([]ExtractedFile, 0, len(parts))
+	for _, p := range parts {
+		f := ExtractedFile{
+			Part:        p,
+			FileName:    p.FileName(),
+			ContentType: p.ContentType(),
+			Disposition: p.Disposition(),
+			Size:        len(p.Content()),
+		}
+		_, params, err := mime.ParseMediaType(p.Header().Get("Content-Disposition"))
+		if err == nil && params["modification-date"] != "" {
+			if t, err := ParseDate(params["modification-date"]); err == nil {
+				f.ModTime = t
+			}
+		}
+
+		name := SafeFileName(f.FileName)
+		if name == "" {
+			name = "attachment"
+			if exts, _ := mime.ExtensionsByType(f.ContentType); len(exts) > 0 {
+				name += exts[0]
+			}
+		}
+		path, err := writeNewFile(dir, name, used, p.Content())
+		if err != nil {
+			return files, err
+		}
+		f.Name = filepath.Base(path)
+		if !f.ModTime.IsZero() {
+			if err := os.Chtimes(path, f.ModTime, f.ModTime); err != nil {
+				return files, err
+			}
+		}
+		files = append(files, f)
+	}
+
+	if manifest != "" {
+		data, err := json.MarshalIndent(files, "", "  ")
+		if err != nil {
+			return files, err
+		}
+		if err := createFile(filepath.Join(dir, manifest), append(data, '\n')); err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
+
+// writeNewFile writes content to a file of dir that did not exist, named name or, if that
+// name is in used or taken, name with a counter added.  The name is added to used and the
+// path of the file is returned.
+func writeNewFile(dir, name string, used map[string]bool, content []byte) (string, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		candidate := name
+		if i > 1 {
+			suffix := " (" + strconv.Itoa(i) + ")"
+			candidate = truncateName(stem, maxFileName-len(suffix)-len(ext)) + suffix + ext
+		}
+		if used[strings.ToLower(candidate)] {
+			continue
+		}
+		path := filepath.Join(dir, candidate)
+		err := createFile(path, content)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		used[strings.ToLower(candidate)] = true
+		return path, nil
+	}
+}
+
+// createFile writes content to a new file at path, failing if the file exists
+func createFile(path string, content []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SafeFileName returns a version of name that can be used as a file name on common
+// systems: only its last path element is kept; control characters, bidirectional text
+// controls and characters reserved by Windows are removed or replaced; leading and
+// trailing dots and spaces are removed; device names such as CON get a prefix, and long
+// names are shortened, keeping their extension.  The result may be empty.
+func SafeFileName(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == utf8.RuneError, strings.ContainsRune(`<>:"|?*`, r):
+			return '_'
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r), unicode.Is(unicode.Bidi_Control, r):
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, ". ")
+
+	if reservedFileName(name) {
+		name = "_" + name
+	}
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	if len(ext) > 20 {
+		// Not a real extension
+		stem, ext = name, ""
+	}
+	if len(stem)+len(ext) > maxFileName {
+		stem = strings.TrimRight(truncateName(stem, maxFileName-len(ext)), ". ")
+	}
+	return stem + ext
+}
+
+// reservedFileName returns true if name is a Windows device name, whatever its extensions
+func reservedFileName(name string) bool {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+	switch s := strings.ToUpper(strings.TrimRight(name, " ")); s {
+	case "CON", "PRN", "AUX", "NUL", "CONIN$", "CONOUT$":
+		return true
+	default:
+		return len(s) == 4 && (strings.HasPrefix(s, "COM") || strings.HasPrefix(s, "LPT")) &&
+			s[3] >= '1' && s[3] <= '9'
+	}
+}
+
+// truncateName returns the longest prefix of s of at most n bytes that does not split a
+// character
+func truncateName(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	if n < 0 {
+		n = 0
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,108 @@
+package enmime
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafeFileName(t *testing.T) {
+	assert.Equal(t, "report.pdf", SafeFileName("report.pdf"))
+	assert.Equal(t, "passwd", SafeFileName("../../etc/passwd"))
+	assert.Equal(t, "evil.bat", SafeFileName(`C:\Windows\..\evil.bat`))
+	assert.Equal(t, "bashrc", SafeFileName(".bashrc"))
+	assert.Equal(t, "", SafeFileName(".."))
+	// Right-to-left override hiding the real extension
+	assert.Equal(t, "invoicegpj.exe", SafeFileName("invoice\u202Egpj.exe"))
+	assert.Equal(t, "tab and newline", SafeFileName("tab\tand\x00 newline\r\n"))
+	assert.Equal(t, "what_ why_.txt", SafeFileName("what? why*.txt"))
+	assert.Equal(t, "_CON", SafeFileName("CON"))
+	assert.Equal(t, "_nul.tar.gz", SafeFileName("nul.tar.gz"))
+	assert.Equal(t, "_com1.txt", SafeFileName("com1.txt"))
+	assert.Equal(t, "console.txt", SafeFileName("console.txt"))
+	assert.Equal(t, "bad_name.txt", SafeFileName("bad\xffname.txt"))
+
+	long := SafeFileName(strings.Repeat("é", 150) + ".txt")
+	assert.True(t, len(long) <= 200)
+	assert.True(t, strings.HasSuffix(long, "é.txt"))
+}
+
+func TestExtractAttachments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enmime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Existing files are kept
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		Html("<img src=\"cid:logo\">").
+		AddAttachment([]byte("one"), "text/plain", "notes.txt").
+		AddAttachment([]byte("two"), "text/plain", "NOTES.TXT").
+		AddAttachment([]byte("root"), "text/plain", "../../../tmp/evil.sh").
+		AddAttachment([]byte("manifest"), "application/json", "manifest.json").
+		AddAttachment([]byte("%PDF"), "application/pdf", "").
+		AddInline([]byte("GIF89a"), "image/gif", "logo.gif", "logo")
+	mime, _ := parseBuilt(t, b)
+	modified := time.Date(2026, 10, 1, 12, 30, 0, 0, time.UTC)
+	assert.NoError(t, SetHeader(mime.Attachments[0], "Content-Disposition",
+		`attachment; filename="notes.txt"; modification-date="Thu, 01 Oct 2026 12:30:00 +0000"`))
+
+	files, err := mime.ExtractAttachments(filepath.Join(dir, "out"), &ExtractOptions{Manifest: "manifest.json"})
+	if !assert.NoError(t, err) || !assert.Equal(t, 6, len(files)) {
+		return
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+		content, err := ioutil.ReadFile(filepath.Join(dir, "out", f.Name))
+		if assert.NoError(t, err) {
+			assert.Equal(t, f.Part.Content(), content)
+			assert.Equal(t, len(content), f.Size)
+		}
+	}
+	assert.Equal(t, []string{"notes.txt", "NOTES (2).TXT", "evil.sh", "manifest (2).json",
+		"attachment.pdf", "logo.gif"}, names)
+	assert.Equal(t, "../../../tmp/evil.sh", files[2].FileName)
+	assert.Equal(t, "inline", files[5].Disposition)
+
+	assert.True(t, modified.Equal(files[0].ModTime))
+	info, err := os.Stat(filepath.Join(dir, "out", "notes.txt"))
+	if assert.NoError(t, err) {
+		assert.True(t, modified.Equal(info.ModTime()))
+	}
+
+	var manifest []ExtractedFile
+	data, err := ioutil.ReadFile(filepath.Join(dir, "out", "manifest.json"))
+	if assert.NoError(t, err) && assert.NoError(t, json.Unmarshal(data, &manifest)) {
+		assert.Equal(t, len(files), len(manifest))
+		assert.Equal(t, "NOTES (2).TXT", manifest[1].Name)
+		assert.Equal(t, "application/pdf", manifest[4].ContentType)
+	}
+
+	// A second extraction to the same directory does not overwrite anything
+	files, err = mime.ExtractAttachments(filepath.Join(dir, "out"), nil)
+	if assert.NoError(t, err) && assert.Equal(t, 6, len(files)) {
+		// The name depends on whether the file system ignores case
+		assert.True(t, strings.HasPrefix(files[0].Name, "notes ("), files[0].Name)
+	}
+	content, _ := ioutil.ReadFile(filepath.Join(dir, "notes.txt"))
+	assert.Equal(t, "keep", string(content))
+
+	// The manifest is not renamed, extraction fails if it exists
+	entries, _ := ioutil.ReadDir(filepath.Join(dir, "out"))
+	files, err = mime.ExtractAttachments(filepath.Join(dir, "out"), &ExtractOptions{Manifest: "manifest.json"})
+	assert.True(t, os.IsExist(err), "%v", err)
+	assert.Equal(t, 0, len(files))
+	after, _ := ioutil.ReadDir(filepath.Join(dir, "out"))
+	assert.Equal(t, len(entries), len(after))
+}
@@ -331,21 +331,27 @@ Loop:
   return plainTextState
 }
 
-// Convert the encTextBytes to UTF-8 and return as a string
-func convertText(charsetName string, encoding string, encTextBytes []byte) (string, error) {
-  // Setup mahonia to convert bytes to UTF-8 string
-
+// charsetDecoder returns a mahonia decoder converting the named charset to UTF-8
+func charsetDecoder(charsetName string) (mahonia.Decoder, error) {
   // TODO : mahonia is deprecated. Use official golang packages.
   charset := mahonia.GetCharset(charsetName)
   if charset == nil {
     // Unknown charset
-    return "", fmt.Errorf("Unknown (to mahonia) charset: %q", charsetName)
+    return nil, fmt.Errorf("Unknown (to mahonia) charset: %q", charsetName)
+  }
+  return charset.NewDecoder(), nil
+}
+
+// Convert the encTextBytes to UTF-8 and return as a string
+func convertText(charsetName string, encoding string, encTextBytes []byte) (string, error) {
+  // Setup mahonia to convert bytes to UTF-8 string
+  decoder, err := charsetDecoder(charsetName)
+  if err != nil {
+    return "", err
   }
-  decoder := charset.NewDecoder()
 
   // Unpack quoted-printable or base64 first
   var textBytes []byte
-  var err error
   switch strings.ToLower(encoding) {
   case "b":
     // Base64 encoded
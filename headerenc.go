@@ -0,0 +1,268 @@
+package enmime
+
+import (
+	"encoding/base64"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// maxEncodedWord is the longest encoded-word RFC 2047 allows
+const maxEncodedWord = 75
+
+// EncodeHeader encodes an unstructured header value, such as a Subject, per RFC 2047.
+// Words holding non-ASCII or control characters are replaced by UTF-8 encoded-words,
+// neighbouring ones sharing the same encoded-words.  Each run of encoded-words uses Q or B
+// encoding, whichever is shorter, and is split into encoded-words of at most 75
+// characters, without splitting a character, that are folded onto separate lines.
+func EncodeHeader(value string) string {
+	return encodeWords(value, false)
+}
+
+// EncodePhrase encodes a phrase, such as the display name of an address, per RFC 2047.
+// Unlike EncodeHeader, words that are not atoms are quoted and encoded-words only use the
+// characters RFC 2047 allows in phrases.
+func EncodePhrase(phrase string) string {
+	return encodeWords(phrase, true)
+}
+
+// EncodeAddress formats an address for an address header, encoding the display name as a
+// phrase.  The addr-spec is never encoded, its local part is quoted if required.
+func EncodeAddress(a *mail.Address) string {
+	// Line breaks would end the header field
+	addr := strings.NewReplacer("\r", "", "\n", "").Replace(a.Address)
+	at := strings.LastIndex(addr, "@")
+	if at >= 0 && !isDotAtom(addr[:at]) {
+		addr = quoteString(addr[:at]) + addr[at:]
+	}
+	if a.Name == "" {
+		return addr
+	}
+	return EncodePhrase(a.Name) + " <" + addr + ">"
+}
+
+// EncodeAddressList formats addresses for an address header, see EncodeAddress
+func EncodeAddressList(addrs []*mail.Address) string {
+	s := make([]string, len(addrs))
+	for i, a := range addrs {
+		s[i] = EncodeAddress(a)
+	}
+	return strings.Join(s, ", ")
+}
+
+// EncodeHeaderField encodes the value of the named header field.  The addresses of address
+// fields are parsed with ParseAddressList and formatted with EncodeAddressList, fields that
+// cannot hold encoded-words, such as Date, Message-ID or Content-Type, are returned
+// without their control characters, which would otherwise end the field, and other fields
+// are encoded with EncodeHeader.
+func EncodeHeaderField(name, value string) string {
+	name = textproto.CanonicalMIMEHeaderKey(name)
+	switch {
+	case addressFields[strings.TrimPrefix(name, "Resent-")]:
+		addrs, bad := ParseAddressList(value)
+		if len(bad) == 0 {
+			return EncodeAddressList(addrs)
+		}
+	case structuredFields[strings.TrimPrefix(name, "Resent-")],
+		strings.HasPrefix(name, "Content-") && name != "Content-Description":
+		return strings.Map(func(r rune) rune {
+			if r < ' ' && r != '\t' || r == 0x7f {
+				return -1
+			}
+			return r
+		}, value)
+	}
+	return EncodeHeader(value)
+}
+
+// addressFields lists the header fields holding address lists, Resent- variants included
+var addressFields = map[string]bool{
+	"From": true, "Sender": true, "Reply-To": true, "To": true, "Cc": true, "Bcc": true,
+	"Disposition-Notification-To": true,
+}
+
+// structuredFields lists the header fields that may not contain encoded-words
+var structuredFields = map[string]bool{
+	"Date": true, "Message-Id": true, "In-Reply-To": true, "References": true,
+	"Mime-Version": true, "Received": true, "Return-Path": true,
+}
+
+// encodeWords encodes the words of value that require it, phrase selects the rules for
+// phrases over those for unstructured text
+func encodeWords(value string, phrase bool) string {
+	// Alternating runs of blanks and words, words first
+	var tokens []string
+	for s := value; s != ""; {
+		end := strings.IndexAny(s, " \t")
+		if end < 0 {
+			end = len(s)
+		}
+		blanks := end
+		for blanks < len(s) && (s[blanks] == ' ' || s[blanks] == '\t') {
+			blanks++
+		}
+		tokens = append(tokens, s[:end], s[end:blanks])
+		s = s[blanks:]
+	}
+
+	var out []string
+	for i := 0; i < len(tokens); i += 2 {
+		encode := needsEncoding(tokens[i])
+		// Group the following words of the same kind
+		j := i + 2
+		for j < len(tokens) && tokens[j] != "" && needsEncoding(tokens[j]) == encode {
+			j += 2
+		}
+		run := strings.Join(tokens[i:j-1], "")
+		switch {
+		case encode:
+			out = append(out, encodeWord(run, phrase))
+		case phrase && !isAtomPhrase(run):
+			out = append(out, quoteString(run))
+		default:
+			out = append(out, run)
+		}
+		out = append(out, tokens[j-1])
+		i = j - 2
+	}
+	return strings.Join(out, "")
+}
+
+// needsEncoding returns true if word cannot appear as is in a header value
+func needsEncoding(word string) bool {
+	if strings.Contains(word, "=?") && strings.Contains(word, "?=") {
+		// Would be mistaken for an encoded-word
+		return true
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 0x20 || word[i] >= 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeWord encodes s as one or more UTF-8 encoded-words, folded onto separate lines
+func encodeWord(s string, phrase bool) string {
+	q := qEncodedLen(s, phrase)
+	b := base64.StdEncoding.EncodedLen(len(s))
+	var words []string
+	var cur []byte
+	prefix := "=?utf-8?q?"
+	if b < q {
+		prefix = "=?utf-8?b?"
+	}
+	flush := func() {
+		if b < q {
+			words = append(words, prefix+base64.StdEncoding.EncodeToString(cur)+"?=")
+		} else {
+			words = append(words, prefix+qEncode(cur, phrase)+"?=")
+		}
+		cur = cur[:0]
+	}
+	for _, r := range s {
+		// Invalid UTF-8 is encoded as U+FFFD
+		next := append(cur, string(r)...)
+		length := base64.StdEncoding.EncodedLen(len(next))
+		if b >= q {
+			length = qEncodedLen(string(next), phrase)
+		}
+		if len(cur) > 0 && len(prefix)+length+2 > maxEncodedWord {
+			flush()
+			next = append(cur, string(r)...)
+		}
+		cur = next
+	}
+	flush()
+	return strings.Join(words, "\r\n ")
+}
+
+// qEncodedLen returns the length of s in Q encoding
+func qEncodedLen(s string, phrase bool) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || qSafe(s[i], phrase) {
+			n++
+		} else {
+			n += 3
+		}
+	}
+	return n
+}
+
+// qEncode returns b in Q encoding
+func qEncode(b []byte, phrase bool) string {
+	const hex = "0123456789ABCDEF"
+	out := make([]byte, 0, len(b)*3)
+	for _, c := range b {
+		switch {
+		case c == ' ':
+			out = append(out, '_')
+		case qSafe(c, phrase):
+			out = append(out, c)
+		default:
+			out = append(out, '=', hex[c>>4], hex[c&0xf])
+		}
+	}
+	return string(out)
+}
+
+// qSafe returns true if c may appear unencoded in a Q encoded-word
+func qSafe(c byte, phrase bool) bool {
+	if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+		return true
+	}
+	if phrase {
+		return strings.IndexByte("!*+-/", c) >= 0
+	}
+	return '!' <= c && c <= '~' && c != '=' && c != '?' && c != '_'
+}
+
+// isAtext returns true if c is an RFC 5322 atext character; non-ASCII bytes are accepted as
+// RFC 6532 allows
+func isAtext(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c >= 0x80 || strings.IndexByte("!#$%&'*+-/=?^_`{|}~", c) >= 0
+}
+
+// isAtomPhrase returns true if s is a sequence of atoms separated by blanks
+func isAtomPhrase(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isAtext(s[i]) && s[i] != ' ' && s[i] != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// isDotAtom returns true if s is an RFC 5322 dot-atom
+func isDotAtom(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, atom := range strings.Split(s, ".") {
+		if atom == "" {
+			return false
+		}
+		for i := 0; i < len(atom); i++ {
+			if !isAtext(atom[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// quoteString returns s as an RFC 5322 quoted-string
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package enmime
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeHeader(t *testing.T) {
+	assert.Equal(t, "Plain (ASCII) subject", EncodeHeader("Plain (ASCII) subject"))
+	assert.Equal(t, "=?utf-8?q?M=C3=BCnchen?= Marathon", EncodeHeader("München Marathon"))
+	// Neighbouring words share encoded-words, the blank between them is encoded
+	assert.Equal(t, "Re: =?utf-8?q?Z=C3=BCrich_M=C3=BCnchen?= trip",
+		EncodeHeader("Re: Zürich München trip"))
+	// B is shorter for mostly non-ASCII words
+	assert.Equal(t, "=?utf-8?b?Q2Fmw6k=?= menu", EncodeHeader("Café menu"))
+	assert.Equal(t, "=?utf-8?b?0J/RgNC40LLQtdGC?=", EncodeHeader("Привет"))
+	// Text looking like an encoded-word, line breaks
+	assert.Equal(t, "=?utf-8?b?PT94P3E/eT89?=", EncodeHeader("=?x?q?y?="))
+	assert.NotContains(t, EncodeHeader("Hi\r\nBcc: evil@example.com"), "\r\nBcc")
+
+	for _, s := range []string{
+		"Привет",
+		strings.Repeat("日本語のテキスト", 20),
+		strings.Repeat("Grüße ", 40),
+		"Mixed 😀 emoji " + strings.Repeat("😀", 30) + " and text",
+	} {
+		encoded := EncodeHeader(s)
+		for _, line := range strings.Split(encoded, "\r\n") {
+			for _, word := range strings.Fields(line) {
+				if strings.HasPrefix(word, "=?") {
+					assert.True(t, len(word) <= 75, "encoded-word too long: %v", word)
+					// Each encoded-word holds whole characters
+					assert.True(t, utf8.ValidString(decodeHeader(word)), word)
+				}
+			}
+		}
+		// Unfold like a header reader would
+		assert.Equal(t, s, decodeHeader(strings.Replace(encoded, "\r\n", "", -1)))
+	}
+}
+
+func TestEncodePhrase(t *testing.T) {
+	assert.Equal(t, "Joe Sender", EncodePhrase("Joe Sender"))
+	assert.Equal(t, `"Sender, Joe"`, EncodePhrase("Sender, Joe"))
+	assert.Equal(t, `"Joe \"JJ\" Sender"`, EncodePhrase(`Joe "JJ" Sender`))
+	// The characters allowed in a phrase are a subset of those of unstructured text
+	assert.Equal(t, "=?utf-8?q?Sch=C3=B6nbrunner=28Wien=29?=", EncodePhrase("Schönbrunner(Wien)"))
+	assert.Equal(t, "=?utf-8?q?Sch=C3=B6nbrunner(Wien)?=", EncodeHeader("Schönbrunner(Wien)"))
+	assert.Equal(t, `=?utf-8?q?J=C3=B6e?= "S. Sender"`, EncodePhrase("Jöe S. Sender"))
+}
+
+func TestEncodeAddress(t *testing.T) {
+	assert.Equal(t, "jane@example.org", EncodeAddress(&mail.Address{Address: "jane@example.org"}))
+	assert.Equal(t, `"jane doe"@example.org`,
+		EncodeAddress(&mail.Address{Address: "jane doe@example.org"}))
+	assert.Equal(t, "=?utf-8?q?J=C3=B6e?= Sender <jöe@exämple.net>",
+		EncodeAddress(&mail.Address{Name: "Jöe Sender", Address: "jöe@exämple.net"}))
+
+	addrs := []*mail.Address{
+		{Name: "Jöe Sender", Address: "joe@example.net"},
+		{Name: "Last, First", Address: "first.last@example.org"},
+		{Address: "bare@example.org"},
+	}
+	value := EncodeAddressList(addrs)
+	parsed, bad := ParseAddressList(value)
+	assert.Equal(t, 0, len(bad))
+	assert.Equal(t, addrs, parsed)
+}
+
+func TestEncodeHeaderField(t *testing.T) {
+	assert.Equal(t, "=?utf-8?q?J=C3=B6e?= <joe@example.net>, jane@example.org",
+		EncodeHeaderField("to", "Jöe <joe@example.net>, jane@example.org"))
+	assert.Equal(t, "=?utf-8?q?J=C3=B6e?= <joe@example.net>",
+		EncodeHeaderField("Resent-From", "Jöe <joe@example.net>"))
+	assert.Equal(t, "<ä@example.net>", EncodeHeaderField("Message-ID", "<ä@example.net>"))
+	assert.Equal(t, "attachment; filename=\"ä.txt\"",
+		EncodeHeaderField("Content-Disposition", "attachment; filename=\"ä.txt\""))
+	assert.Equal(t, "=?utf-8?q?B=C3=ABtaversion?=", EncodeHeaderField("X-Label", "Bëtaversion"))
+	assert.Equal(t, "=?utf-8?q?B=C3=A9taversion?=",
+		EncodeHeaderField("Content-Description", "Bétaversion"))
+
+	// Line breaks cannot start new fields
+	assert.Equal(t, "<x@y>Bcc: evil@example.org",
+		EncodeHeaderField("References", "<x@y>\r\nBcc: evil@example.org"))
+	assert.Equal(t, "text/plainX-Evil: 1", EncodeHeaderField("Content-Type", "text/plain\nX-Evil: 1"))
+	assert.Equal(t, "<a@b>\t<c@d>", EncodeHeaderField("In-Reply-To", "<a@b>\r\n\t<c@d>\x00"))
+	assert.NotContains(t, EncodeHeaderField("X-Note", "one\r\nBcc: evil@example.org"), "\r\nBcc")
+}
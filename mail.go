@@ -1,22 +1,35 @@
 package enmime
 
 import (
+  "bytes"
   "crypto/sha256"
   "encoding/hex"
   "fmt"
+  "io"
+  "io/ioutil"
   "mime"
   "net/mail"
+  "net/textproto"
   "strings"
 )
 
 // MIMEBody is the outer wrapper for MIME messages.
 type MIMEBody struct {
-  Text        string      // The plain text portion of the message
-  Html        string      // The HTML portion of the message
-  Root        MIMEPart    // The top-level MIMEPart
-  Attachments []MIMEPart  // All parts having a Content-Disposition of attachment
-  Inlines     []MIMEPart  // All parts having a Content-Disposition of inline
-  header      mail.Header // Header from original message
+  Text         string        // The plain text portion of the message
+  Html         string        // The HTML portion of the message
+  Root         MIMEPart      // The top-level MIMEPart
+  Attachments  []MIMEPart    // All parts having a Content-Disposition of attachment
+  Inlines      []MIMEPart    // All parts having a Content-Disposition of inline
+  header       mail.Header   // Header from original message
+  raw          []byte        // Original message, if read by ReadMIMEBody
+  alternatives []string      // Preferred multipart/alternative media types
+  body         []byte        // Decoded body of a non-multipart message
+  digests      *Digests      // Digests of body, see PartDigests
+  opts         *ParseOptions // Options the message was parsed with, may be nil
+
+  // ContentMD5Errors lists the parts whose Content-MD5 header did not match their content
+  // when the message was parsed
+  ContentMD5Errors []*ContentMD5Error
 }
 
 // IsMultipartMessage returns true if the message has a recognized multipart Content-Type
@@ -27,34 +40,98 @@ func IsMultipart(mediatype string) bool {
   case "multipart/alternative",
     "multipart/mixed",
     "multipart/related",
-    "multipart/signed":
+    "multipart/signed",
+    "multipart/encrypted":
     return true
   }
 
   return false
 }
 
+// ParseOptions controls how ParseMIMEBodyOptions locates the bodies of a message and the
+// digests it computes.
+type ParseOptions struct {
+  // Alternatives lists the media types acceptable as the body of a multipart/alternative,
+  // most preferred first.  Text and Html are each taken from the most preferred
+  // alternative able to provide them, and types not listed are never used.  Parts outside
+  // of a multipart/alternative are not affected.  If empty, DefaultAlternatives is used.
+  Alternatives []string
+
+  // MD5 and SHA1 request these digests of the content of each part in addition to
+  // SHA-256, see PartDigests.
+  MD5, SHA1 bool
+}
+
 // ParseMIMEBody parses the body of the message object into a  tree of MIMEPart objects,
 // each of which is aware of its content type, filename and headers.  If the part was
 // encoded in quoted-printable or base64, it is decoded before being stored in the
-// MIMEPart object.
+// MIMEPart object.  The header of a multipart message is
+// also the header of Root: changing one changes the other.
 func ParseMIMEBody(mailMsg *mail.Message) (*MIMEBody, error) {
-  mimeMsg := &MIMEBody{header: mailMsg.Header}
+  return ParseMIMEBodyOptions(mailMsg, nil)
+}
+
+// ReadMIMEBody reads an entire message from r and parses it like ParseMIMEBody.  The raw
+// message is retained, which features that depend on the exact bytes that were sent,
+// such as VerifyDKIM, require.
+func ReadMIMEBody(r io.Reader) (*MIMEBody, error) {
+  return ReadMIMEBodyOptions(r, nil)
+}
+
+// ReadMIMEBodyOptions is like ReadMIMEBody, but accepts ParseOptions.
+func ReadMIMEBodyOptions(r io.Reader, opts *ParseOptions) (*MIMEBody, error) {
+  raw, err := ioutil.ReadAll(r)
+  if err != nil {
+    return nil, fmt.Errorf("Error reading message: %v", err)
+  }
+  mailMsg, err := mail.ReadMessage(bytes.NewReader(raw))
+  if err != nil {
+    return nil, fmt.Errorf("Error reading message header: %v", err)
+  }
+  return parseMIMEBody(mailMsg, opts, raw)
+}
+
+// ParseMIMEBodyOptions is like ParseMIMEBody, but allows the caller to control body
+// selection with opts, which may be nil.
+func ParseMIMEBodyOptions(mailMsg *mail.Message, opts *ParseOptions) (*MIMEBody, error) {
+  return parseMIMEBody(mailMsg, opts, nil)
+}
+
+// parseMIMEBody parses mailMsg, which was read from raw if raw is not nil.  The bytes of
+// the message and of its parts are then retained.
+func parseMIMEBody(mailMsg *mail.Message, opts *ParseOptions, raw []byte) (*MIMEBody, error) {
+  prefs := DefaultAlternatives
+  if opts != nil && len(opts.Alternatives) > 0 {
+    prefs = opts.Alternatives
+  }
+
+  mimeMsg := &MIMEBody{header: mailMsg.Header, raw: raw, alternatives: prefs, opts: opts}
   ctype := mailMsg.Header.Get("Content-Type")
   mediatype, _, _ := mime.ParseMediaType(ctype)
 
   if !IsMultipart(mediatype) {
     // Mono part
-    bodyBytes, err := decodeSection(mailMsg.Header.Get("Content-Transfer-Encoding"),
-      ctype, mediatype, mailMsg.Body)
+    d := newDigester(opts, textproto.MIMEHeader(mailMsg.Header), mediatype)
+    bodyBytes, err := decodeSectionTo(mailMsg.Header.Get("Content-Transfer-Encoding"),
+      ctype, mediatype, mailMsg.Body, d)
     if err != nil {
       return nil, fmt.Errorf("Error decoding text-only message: %v", err)
     }
+    mimeMsg.body = bodyBytes
+    mimeMsg.digests = d.sum()
+    if mimeMsg.digests.ContentMD5Mismatch {
+      mimeMsg.ContentMD5Errors = []*ContentMD5Error{{Header: mailMsg.Header.Get("Content-MD5")}}
+    }
 
     // Check for HTML at top-level, eat errors quietly
-    if mediatype == "text/html" {
+    switch {
+    case mediatype == "text/html":
       mimeMsg.Html = string(bodyBytes)
-    } else {
+    case rendersHtml(mediatype):
+      // Converted formats provide both bodies
+      mimeMsg.Text = renderText(mediatype, bodyBytes)
+      mimeMsg.Html = renderHtml(mediatype, bodyBytes)
+    default:
       mimeMsg.Text = string(bodyBytes)
     }
   } else {
@@ -74,55 +151,95 @@ func ParseMIMEBody(mailMsg *mail.Message) (*MIMEBody, error) {
 
     // Root Node of our tree
     root := NewMIMEPart(nil, mediatype)
+    // Root shares the header of the message, so SetHeader on Root edits the fields
+    // returned by GetHeader and written by Encode
+    root.header = textproto.MIMEHeader(mailMsg.Header)
     mimeMsg.Root = root
-    err = parseParts(root, mailMsg.Body, boundary)
+    var body []byte
+    if raw != nil {
+      root.raw = raw
+      root.rawHeader = raw[:rawHeaderLength(raw)]
+      body = raw[len(root.rawHeader):]
+    }
+    err = parseParts(root, mailMsg.Body, body, boundary, opts)
     if err != nil {
       return nil, err
     }
+    for _, p := range DepthMatchAll(root, func(p MIMEPart) bool {
+      mp, ok := p.(*memMIMEPart)
+      return ok && mp.digests != nil && mp.digests.ContentMD5Mismatch
+    }) {
+      mimeMsg.ContentMD5Errors = append(mimeMsg.ContentMD5Errors,
+        &ContentMD5Error{Part: p, Header: p.Header().Get("Content-MD5")})
+    }
 
-    // Locate text body
-    if mediatype == "multipart/altern" {
-      match := BreadthMatchFirst(root, func(p MIMEPart) bool {
-        return p.ContentType() == "text/plain" && p.Disposition() != "attachment"
-      })
-      if match != nil {
-        mimeMsg.Text = string(match.Content())
-      }
-    } else {
-      // multipart is of a mixed type
-      match := DepthMatchAll(root, func(p MIMEPart) bool {
-        return p.ContentType() == "text/plain" && p.Disposition() != "attachment"
-      })
-      for i, m := range match {
-        if i > 0 {
-          mimeMsg.Text += "\n--\n"
-        }
-        mimeMsg.Text += string(m.Content())
-      }
+    mimeMsg.locateParts()
+  }
+
+  return mimeMsg, nil
+}
+
+// Update sets Text, Html, Attachments and Inlines again after the tree under Root was
+// modified, e.g. with AppendChild, RemovePart or SetContent.
+func (m *MIMEBody) Update() {
+  if m.Root != nil {
+    m.locateParts()
+  }
+}
+
+// locateParts sets the Text, Html, Attachments and Inlines of a multipart message from
+// the tree under Root
+func (m *MIMEBody) locateParts() {
+  m.Text, m.Html = "", ""
+
+  // Locate text body, concatenating the parts of a mixed message but only following
+  // the preferred branch of each multipart/alternative
+  bodies := DepthMatchAll(m.Root, func(p MIMEPart) bool {
+    return rendersText(p.ContentType()) && p.Disposition() != "attachment" &&
+      onSelectedBranch(p, m.alternatives, rendersText)
+  })
+  for i, b := range bodies {
+    if i > 0 {
+      m.Text += "\n--\n"
     }
+    m.Text += renderText(b.ContentType(), b.Content())
+  }
 
-    // Locate HTML body
-    match := BreadthMatchFirst(root, func(p MIMEPart) bool {
-      return p.ContentType() == "text/html" && p.Disposition() != "attachment"
-    })
-    if match != nil {
-      mimeMsg.Html = string(match.Content())
+  // Locate HTML body, preferring genuine HTML over converted formats
+  htmlMatcher := func(native bool) MIMEPartMatcher {
+    return func(p MIMEPart) bool {
+      return rendersHtml(p.ContentType()) && (p.ContentType() == "text/html") == native &&
+        p.Disposition() != "attachment" && onSelectedBranch(p, m.alternatives, rendersHtml)
     }
+  }
+  match := BreadthMatchFirst(m.Root, htmlMatcher(true))
+  if match == nil {
+    match = BreadthMatchFirst(m.Root, htmlMatcher(false))
+  }
+  if match != nil {
+    m.Html = renderHtml(match.ContentType(), match.Content())
+    bodies = append(bodies, match)
+  }
 
-    // Locate attachments
-    mimeMsg.Attachments = BreadthMatchAll(root, func(p MIMEPart) bool {
-      // Do not include the parts if they are already present as text or html
-      return p.Disposition() == "attachment" && string(p.Content()) != mimeMsg.Html && string(p.Content()) != mimeMsg.Text
-    })
-
-    // Locate inlines
-    mimeMsg.Inlines = BreadthMatchAll(root, func(p MIMEPart) bool {
-      // Do not include the parts if they are already present as text or html
-      return p.Disposition() == "inline" && string(p.Content()) != mimeMsg.Html && string(p.Content()) != mimeMsg.Text
-    })
+  // isBody returns true if the part is already present as text or html
+  isBody := func(p MIMEPart) bool {
+    for _, b := range bodies {
+      if b == p {
+        return true
+      }
+    }
+    return string(p.Content()) == m.Html || string(p.Content()) == m.Text
   }
 
-  return mimeMsg, nil
+  // Locate attachments
+  m.Attachments = BreadthMatchAll(m.Root, func(p MIMEPart) bool {
+    return p.Disposition() == "attachment" && !isBody(p)
+  })
+
+  // Locate inlines
+  m.Inlines = BreadthMatchAll(m.Root, func(p MIMEPart) bool {
+    return p.Disposition() == "inline" && !isBody(p)
+  })
 }
 
 // Process the specified header for RFC 2047 encoded words and return the result
@@ -43,12 +43,22 @@ type memMIMEPart struct {
   disposition string
   fileName    string
   content     []byte
+  raw         []byte   // Header and body exactly as found in the message, if known
+  rawHeader   []byte   // Header as found, kept when the part is modified
+  preamble    []byte   // Multipart preamble as found
+  epilogue    []byte   // Multipart epilogue as found
+  digests     *Digests // Digests computed while parsing, see PartDigests
 }
 
-// NewMIMEPart creates a new memMIMEPart object.  It does not update the parents FirstChild
-// attribute.
+// NewMIMEPart creates a new memMIMEPart object with a Content-Type header holding
+// contentType.  The part is not in a tree: parent is ignored, use AppendChild or
+// InsertBefore to add the part to one.
 func NewMIMEPart(parent MIMEPart, contentType string) *memMIMEPart {
-  return &memMIMEPart{parent: parent, contentType: contentType}
+  p := &memMIMEPart{contentType: contentType, header: make(textproto.MIMEHeader)}
+  if contentType != "" {
+    p.header.Set("Content-Type", contentType)
+  }
+  return p
 }
 
 // Parent of this part (can be nil)
@@ -91,6 +101,208 @@ func (p *memMIMEPart) Content() []byte {
   return p.content
 }
 
+// AppendChild adds child as the last child of parent, which must be a multipart.  child
+// must not already be part of a tree.
+func AppendChild(parent, child MIMEPart) error {
+  return InsertBefore(parent, child, nil)
+}
+
+// InsertBefore adds child to parent before ref, which must be a child of parent, or as the
+// last child if ref is nil.  child must not already be part of a tree.
+func InsertBefore(parent, child, ref MIMEPart) error {
+  pp, err := editablePart(parent)
+  if err != nil {
+    return err
+  }
+  c, err := editablePart(child)
+  if err != nil {
+    return err
+  }
+  if !strings.HasPrefix(pp.contentType, "multipart/") {
+    return fmt.Errorf("Cannot add a child to a %v part", pp.contentType)
+  }
+  if c.parent != nil || c.nextSibling != nil {
+    return fmt.Errorf("Part is already in a tree")
+  }
+  for a := parent; a != nil; a = a.Parent() {
+    if a == child {
+      return fmt.Errorf("Cannot add a part to its own descendant")
+    }
+  }
+  if ref != nil && ref.Parent() != parent {
+    return fmt.Errorf("Reference part is not a child of the parent")
+  }
+
+  c.parent, c.nextSibling = pp, ref
+  if pp.firstChild == ref {
+    pp.firstChild = c
+  } else {
+    for s := pp.firstChild; s != nil; s = s.NextSibling() {
+      if s.NextSibling() == ref {
+        s.(*memMIMEPart).nextSibling = c
+        break
+      }
+    }
+  }
+  pp.modified()
+  return nil
+}
+
+// RemovePart removes p and its children from the tree it belongs to
+func RemovePart(p MIMEPart) error {
+  o, err := editablePart(p)
+  if err != nil {
+    return err
+  }
+  if o.parent == nil {
+    return fmt.Errorf("Cannot remove a part without parent")
+  }
+  parent, err := editablePart(o.parent)
+  if err != nil {
+    return err
+  }
+  if parent.firstChild == p {
+    parent.firstChild = o.nextSibling
+  } else {
+    for c := parent.firstChild; c != nil; c = c.NextSibling() {
+      if c.NextSibling() == p {
+        c.(*memMIMEPart).nextSibling = o.nextSibling
+        break
+      }
+    }
+  }
+  o.parent, o.nextSibling = nil, nil
+  parent.modified()
+  return nil
+}
+
+// ReplacePart puts repl in the place of old in its tree.  repl must not already be part of
+// a tree; old is removed from the tree, keeping its children.  If old is a root, there is
+// nothing to update and repl becomes a root of its own, e.g. the new MIMEBody.Root.
+func ReplacePart(old, repl MIMEPart) error {
+  o, err := editablePart(old)
+  if err != nil {
+    return err
+  }
+  r, err := editablePart(repl)
+  if err != nil {
+    return err
+  }
+  if r.parent != nil || r.nextSibling != nil {
+    return fmt.Errorf("Part is already in a tree")
+  }
+  if o.parent == nil {
+    return nil
+  }
+  parent, err := editablePart(o.parent)
+  if err != nil {
+    return err
+  }
+  if err := InsertBefore(parent, r, old); err != nil {
+    return err
+  }
+  return RemovePart(old)
+}
+
+// SetHeader sets the named header field of p to value, replacing its previous values, or
+// removes the field if value is empty.  The value is folded when the part is written, so it
+// may not contain line breaks.  The content type, disposition and file name of p follow
+// changes to the Content-Type and Content-Disposition fields; without a Content-Type, p is
+// text/plain.
+func SetHeader(p MIMEPart, name, value string) error {
+  o, err := editablePart(p)
+  if err != nil {
+    return err
+  }
+  if !validHeaderName(name) {
+    return fmt.Errorf("Invalid header name %q", name)
+  }
+  if strings.ContainsAny(value, "\r\n") {
+    return fmt.Errorf("Invalid value %q for header %v", value, name)
+  }
+  name = textproto.CanonicalMIMEHeaderKey(name)
+  if name == "Content-Type" && value == "" && o.firstChild != nil {
+    return fmt.Errorf("Cannot remove the Content-Type of a part with children")
+  } else if name == "Content-Type" && value != "" {
+    mediatype, _, err := mime.ParseMediaType(value)
+    if err != nil {
+      return fmt.Errorf("Invalid Content-Type: %v", err)
+    }
+    if o.firstChild != nil && !strings.HasPrefix(mediatype, "multipart/") {
+      return fmt.Errorf("Cannot make a part with children a %v part", mediatype)
+    }
+  }
+
+  if o.header == nil {
+    o.header = make(textproto.MIMEHeader)
+  }
+  if value == "" {
+    o.header.Del(name)
+  } else {
+    o.header.Set(name, value)
+  }
+  o.setTypeFields()
+  o.modified()
+  return nil
+}
+
+// SetContent replaces the decoded content of p, which must not be a multipart.  It is
+// encoded again when the part is written, see EncodePart.
+func SetContent(p MIMEPart, content []byte) error {
+  o, err := editablePart(p)
+  if err != nil {
+    return err
+  }
+  if strings.HasPrefix(o.contentType, "multipart/") {
+    return fmt.Errorf("Cannot set the content of a %v part", o.contentType)
+  }
+  o.content = content
+  o.digests = nil
+  o.modified()
+  return nil
+}
+
+// editablePart returns p if the tree API can modify it
+func editablePart(p MIMEPart) (*memMIMEPart, error) {
+  mp, ok := p.(*memMIMEPart)
+  if !ok || mp == nil {
+    return nil, fmt.Errorf("Cannot modify a part of type %T", p)
+  }
+  return mp, nil
+}
+
+// modified forgets the original bytes of p and its ancestors, which no longer match them
+func (p *memMIMEPart) modified() {
+  for a := p; a != nil; {
+    a.raw = nil
+    a, _ = a.parent.(*memMIMEPart)
+  }
+}
+
+// setTypeFields sets the content type, disposition and file name of p from its header
+func (p *memMIMEPart) setTypeFields() {
+  mediatype, mparams := "text/plain", map[string]string{}
+  if ctype := p.header.Get("Content-Type"); ctype != "" {
+    var err error
+    mediatype, mparams, err = mime.ParseMediaType(ctype)
+    if err != nil {
+      return
+    }
+  }
+  p.contentType = mediatype
+  p.fileName = mparams["name"]
+  p.disposition = ""
+
+  disposition, dparams, err := mime.ParseMediaType(p.header.Get("Content-Disposition"))
+  if err == nil {
+    // Disposition is optional
+    p.disposition = disposition
+    if p.fileName == "" && dparams["filename"] != "" {
+      p.fileName = dparams["filename"]
+    }
+  }
+}
+
 // ParseMIME reads a MIME document from the provided reader and parses it into
 // tree of MIMEPart objects.
 func ParseMIME(reader *bufio.Reader) (MIMEPart, error) {
@@ -108,29 +320,41 @@ func ParseMIME(reader *bufio.Reader) (MIMEPart, error) {
 
   if strings.HasPrefix(mediatype, "multipart/") {
     boundary := params["boundary"]
-    err = parseParts(root, reader, boundary)
+    err = parseParts(root, reader, nil, boundary, nil)
     if err != nil {
       return nil, err
     }
   } else {
     // Content is text or data, decode it
-    content, err := decodeSection(header.Get("Content-Transfer-Encoding"), ctype, mediatype, reader)
+    d := newDigester(nil, header, mediatype)
+    content, err := decodeSectionTo(header.Get("Content-Transfer-Encoding"), ctype, mediatype, reader, d)
     if err != nil {
       return nil, err
     }
     root.content = content
+    root.digests = d.sum()
   }
 
   return root, nil
 }
 
-// parseParts recursively parses a mime multipart document.
-func parseParts(parent *memMIMEPart, reader io.Reader, boundary string) error {
+// parseParts recursively parses a mime multipart document.  If body is not nil, it holds
+// the multipart, which is then read from it instead of reader, and parts retain their
+// original bytes as slices of body.  opts may be nil.
+func parseParts(parent *memMIMEPart, reader io.Reader, body []byte, boundary string, opts *ParseOptions) error {
   var prevSibling *memMIMEPart
 
+  var raws [][]byte
+  if body != nil {
+    // Parts keep their original bytes, which signatures are computed over
+    raws, parent.preamble, parent.epilogue = splitMultipart(body, boundary)
+    reader = bytes.NewReader(body)
+  }
+
   // Loop over MIME parts
   mr := multipart.NewReader(reader, boundary)
-  for {
+  index := 0
+  for ; ; index++ {
     // mrp is golang's built in mime-part
     mrp, err := mr.NextPart()
     if err != nil {
@@ -165,8 +389,12 @@ func parseParts(parent *memMIMEPart, reader io.Reader, boundary string) error {
     }
 
     // Insert ourselves into tree, p is enmime's mime-part
-    p := NewMIMEPart(parent, mediatype)
+    p := &memMIMEPart{parent: parent, contentType: mediatype}
     p.header = mrp.Header
+    if index < len(raws) {
+      p.raw = raws[index]
+      p.rawHeader = p.raw[:rawHeaderLength(p.raw)]
+    }
     if prevSibling != nil {
       prevSibling.nextSibling = p
     } else {
@@ -175,45 +403,121 @@ func parseParts(parent *memMIMEPart, reader io.Reader, boundary string) error {
     prevSibling = p
 
     // Figure out our disposition, filename
-
-    if mparams["name"] != "" {
-      p.fileName = mparams["name"]
-    }
-
-    disposition, dparams, err := mime.ParseMediaType(mrp.Header.Get("Content-Disposition"))
-    if err == nil {
-      // Disposition is optional
-      p.disposition = disposition
-      if p.fileName == "" && dparams["filename"] != "" {
-        p.fileName = dparams["filename"]
-      }
-    }
-
+    p.setTypeFields()
 
     boundary := mparams["boundary"]
     if boundary != "" {
       // Content is another multipart
-      err = parseParts(p, mrp, boundary)
+      var nested []byte
+      if p.raw != nil {
+        nested = p.raw[len(p.rawHeader):]
+      }
+      err = parseParts(p, mrp, nested, boundary, opts)
       if err != nil {
         return err
       }
     } else {
       // Content is text or data, decode it
-      data, err := decodeSection(mrp.Header.Get("Content-Transfer-Encoding"), ctype, mediatype, mrp)
+      d := newDigester(opts, mrp.Header, mediatype)
+      data, err := decodeSectionTo(mrp.Header.Get("Content-Transfer-Encoding"), ctype, mediatype, mrp, d)
       if err != nil {
         return err
       }
       p.content = data
+      p.digests = d.sum()
     }
   }
 
+  if body != nil && index != len(raws) {
+    // splitMultipart did not find the parts multipart.Reader found, so their bytes are
+    // not known
+    parent.preamble, parent.epilogue = nil, nil
+    for c := parent.firstChild; c != nil; c = c.NextSibling() {
+      for _, p := range DepthMatchAll(c, func(MIMEPart) bool { return true }) {
+        if mp, ok := p.(*memMIMEPart); ok {
+          mp.raw, mp.rawHeader, mp.preamble, mp.epilogue = nil, nil, nil, nil
+        }
+      }
+    }
+  }
   return nil
 }
 
+// rawHeaderLength returns the length of the header at the start of raw, including the
+// blank line that ends it
+func rawHeaderLength(raw []byte) int {
+  for pos := 0; pos < len(raw); {
+    end := bytes.IndexByte(raw[pos:], '\n')
+    if end < 0 {
+      break
+    }
+    end += pos + 1
+    if end-pos == 1 || end-pos == 2 && raw[pos] == '\r' {
+      return end
+    }
+    pos = end
+  }
+  return len(raw)
+}
+
+// splitMultipart returns the raw parts of a multipart body, without the line breaks that
+// belong to the boundary delimiters, in the order multipart.Reader finds them in.  The
+// preamble is what precedes the first delimiter line, the epilogue what follows the line
+// of the closing delimiter; both are slices of data.
+func splitMultipart(data []byte, boundary string) (parts [][]byte, preamble, epilogue []byte) {
+  delimiter := []byte("--" + boundary)
+  parts = make([][]byte, 0, 4)
+  start := -1
+  for pos := 0; pos < len(data); {
+    end := bytes.IndexByte(data[pos:], '\n')
+    if end < 0 {
+      end = len(data)
+    } else {
+      end += pos + 1
+    }
+    line := data[pos:end]
+
+    if bytes.HasPrefix(line, delimiter) {
+      rest := bytes.TrimRight(line[len(delimiter):], " \t\r\n")
+      closing := bytes.Equal(rest, []byte("--"))
+      if len(rest) == 0 || closing {
+        if start >= 0 {
+          // The line break before the delimiter is part of it
+          part := data[start:pos]
+          if bytes.HasSuffix(part, []byte("\r\n")) {
+            part = part[:len(part)-2]
+          } else if bytes.HasSuffix(part, []byte("\n")) {
+            part = part[:len(part)-1]
+          }
+          parts = append(parts, part)
+        } else {
+          preamble = data[:pos]
+        }
+        if closing {
+          return parts, preamble, data[end:]
+        }
+        start = end
+      }
+    }
+    pos = end
+  }
+  if start >= 0 && start < len(data) {
+    // Missing closing delimiter
+    parts = append(parts, data[start:])
+  }
+  return parts, preamble, nil
+}
+
 // decodeSection attempts to decode the data from reader using the algorithm listed in
 // the Content-Transfer-Encoding header, returning the raw data if it does not known
 // the encoding type.
 func decodeSection(transfer_encoding string, content_type string, mediatype string, reader io.Reader) ([]byte, error) {
+  return decodeSectionTo(transfer_encoding, content_type, mediatype, reader, nil)
+}
+
+// decodeSectionTo is like decodeSection, but also feeds d, if not nil, with the data after
+// transfer decoding for the Content-MD5 check, and with the returned data for the digests.
+func decodeSectionTo(transfer_encoding string, content_type string, mediatype string, reader io.Reader, d *digester) ([]byte, error) {
   // Default is to just read input into bytes
   decoder := reader
 
@@ -224,29 +528,31 @@ func decodeSection(transfer_encoding string, content_type string, mediatype stri
     cleaner := NewBase64Cleaner(reader)
     decoder = base64.NewDecoder(base64.StdEncoding, cleaner)
   }
+  if d != nil {
+    decoder = io.TeeReader(decoder, d)
+  }
 
   if len(mediatype) > 4 && mediatype[0:5] == "text/" {
     // Decode text to utf-8
     readerInUTF8, err := charset.NewReader(decoder, content_type)
-    if err != nil {
-      return nil, err
+    if err == io.EOF {
+      // Empty section
+      return []byte{}, nil
     }
-    buf := new(bytes.Buffer)
-    _, err = buf.ReadFrom(readerInUTF8)
     if err != nil {
       return nil, err
     }
-    return buf.Bytes(), nil
-
-  } else {
-    // Pass raw data
-    buf := new(bytes.Buffer)
-    _, err := buf.ReadFrom(decoder)
-    if err != nil {
-      return nil, err
-    }
-    return buf.Bytes(), nil
-
+    decoder = readerInUTF8
   }
+  if d != nil {
+    decoder = io.TeeReader(decoder, d.content)
+  }
+
   // Read bytes into buffer
+  buf := new(bytes.Buffer)
+  _, err := buf.ReadFrom(decoder)
+  if err != nil {
+    return nil, err
+  }
+  return buf.Bytes(), nil
 }
@@ -2,9 +2,12 @@ package enmime
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"net/mail"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -226,6 +229,164 @@ func TestBadBoundaryTerm(t *testing.T) {
 	assert.Nil(t, p.NextSibling(), "Second child should not have a sibling")
 }
 
+func TestSplitMultipart(t *testing.T) {
+	data := []byte("preamble\r\n--xx\r\nContent-Type: text/plain\r\n\r\nOne\r\n\r\n--xx \r\n\r\nTwo\n--xx--\r\nepilogue")
+	parts, preamble, epilogue := splitMultipart(data, "xx")
+	if assert.Equal(t, 2, len(parts)) {
+		assert.Equal(t, "Content-Type: text/plain\r\n\r\nOne\r\n", string(parts[0]))
+		assert.Equal(t, "\r\nTwo", string(parts[1]))
+	}
+	assert.Equal(t, "preamble\r\n", string(preamble))
+	assert.Equal(t, "epilogue", string(epilogue))
+
+	// Missing closing delimiter
+	parts, preamble, epilogue = splitMultipart([]byte("--xx\nA\n--xxy\nB\n"), "xx")
+	if assert.Equal(t, 1, len(parts)) {
+		assert.Equal(t, "A\n--xxy\nB\n", string(parts[0]))
+	}
+	assert.Equal(t, 0, len(preamble))
+	assert.Nil(t, epilogue)
+}
+
+func TestRawRetention(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=\"xx\"\r\n\r\n" +
+		"--xx\r\nContent-Type: multipart/alternative; boundary=\"yy\"\r\n\r\n" +
+		"--yy\r\nContent-Type: text/plain\r\n\r\nNested\r\n--yy--\r\n" +
+		"--xx--\r\n"
+	mime, err := ReadMIMEBody(strings.NewReader(raw))
+	if !assert.NoError(t, err) {
+		return
+	}
+	nested := mime.Root.FirstChild().FirstChild()
+	assert.Equal(t, "Content-Type: text/plain\r\n\r\nNested", string(rawContent(nested)))
+
+	// Only kept when the message is read
+	msg, _ := mail.ReadMessage(strings.NewReader(raw))
+	mime, err = ParseMIMEBody(msg)
+	if assert.NoError(t, err) {
+		assert.Nil(t, rawContent(mime.Root.FirstChild()))
+		assert.Equal(t, "Nested", string(mime.Root.FirstChild().FirstChild().Content()))
+	}
+
+	// multipart.Reader stops at the part without header, splitMultipart does not
+	raw = "Content-Type: multipart/mixed; boundary=\"xx\"\r\n\r\n" +
+		"--xx\r\nContent-Type: text/plain\r\n\r\nOne\r\n--xx\r\n\r\nTwo\r\n--xx--\r\n"
+	mime, err = ReadMIMEBody(strings.NewReader(raw))
+	if assert.NoError(t, err) && assert.NotNil(t, mime.Root.FirstChild()) {
+		assert.Nil(t, rawContent(mime.Root.FirstChild()))
+	}
+}
+
+func TestEmptyTextSection(t *testing.T) {
+	content, err := decodeSection("7bit", "text/plain; charset=utf-8", "text/plain", strings.NewReader(""))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(content))
+}
+
+func TestEditTree(t *testing.T) {
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("mime-mixed.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	root := mime.Root
+	one := root.FirstChild()
+	two := one.NextSibling()
+
+	// newText returns a part that is not in any tree
+	newText := func(text string) MIMEPart {
+		p := NewMIMEPart(nil, "text/plain")
+		assert.NoError(t, SetHeader(p, "Content-Type", "text/plain; charset=utf-8"))
+		assert.NoError(t, SetContent(p, []byte(text)))
+		return p
+	}
+	zero, three := newText("Section zero"), newText("Section three")
+	assert.NoError(t, InsertBefore(root, zero, one))
+	assert.NoError(t, AppendChild(root, three))
+	assert.NoError(t, RemovePart(two))
+	assert.Nil(t, two.Parent())
+	assert.Nil(t, two.NextSibling())
+	attachment := newText("a,b\n")
+	assert.NoError(t, SetHeader(attachment, "content-type", "text/csv; name=\"data.csv\""))
+	assert.NoError(t, SetHeader(attachment, "Content-Disposition", "attachment"))
+	assert.NoError(t, ReplacePart(one, attachment))
+	assert.Equal(t, "text/csv", attachment.ContentType())
+	assert.Equal(t, "attachment", attachment.Disposition())
+	assert.Equal(t, "data.csv", attachment.FileName())
+
+	var order []string
+	for c := root.FirstChild(); c != nil; c = c.NextSibling() {
+		assert.Equal(t, root, c.Parent())
+		order = append(order, strings.TrimSpace(string(c.Content())))
+	}
+	assert.Equal(t, []string{"Section zero", "a,b", "Section three"}, order)
+
+	mime.Update()
+	assert.Equal(t, "Section zero\n--\nSection three", mime.Text)
+	assert.Equal(t, 1, len(mime.Attachments))
+
+	// The modified message can be written and read again
+	var buf bytes.Buffer
+	if assert.NoError(t, mime.Encode(&buf, &EncodeOptions{PreserveRaw: true})) {
+		out, err := ReadMIMEBody(&buf)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "Section zero\n--\nSection three", out.Text)
+		}
+	}
+
+	// Invalid edits
+	assert.Error(t, AppendChild(zero, newText("x")), "not a multipart")
+	assert.Error(t, AppendChild(root, zero), "already in a tree")
+	assert.Error(t, InsertBefore(root, newText("x"), two), "ref is not a child")
+	assert.Error(t, RemovePart(root), "root has no parent")
+	assert.Error(t, SetContent(root, []byte("x")), "multipart content")
+	assert.Error(t, SetHeader(root, "Content-Type", "text/plain"), "part has children")
+	assert.Error(t, SetHeader(zero, "Content-Type", "text/plain; =bad"), "invalid type")
+	assert.Error(t, SetHeader(zero, "X-Note", "a\r\nBcc: evil@example.org"), "line break")
+	assert.Error(t, SetHeader(zero, "X-Note\r\nBcc", "x"), "invalid name")
+	assert.Error(t, SetHeader(zero, "", "x"), "empty name")
+	assert.Error(t, SetHeader(root, "Content-Type", ""), "part has children")
+	sub := NewMIMEPart(nil, "multipart/mixed")
+	assert.NoError(t, AppendChild(root, sub))
+	assert.Error(t, AppendChild(sub, root), "cycle")
+
+	// Removing the Content-Type makes a part text/plain
+	assert.NoError(t, SetHeader(attachment, "Content-Type", ""))
+	assert.Equal(t, "text/plain", attachment.ContentType())
+	assert.Equal(t, "", attachment.FileName())
+
+	// Constructed parts have their type in their header and are not in a tree
+	img := NewMIMEPart(root, "image/png")
+	assert.Equal(t, "image/png", img.Header().Get("Content-Type"))
+	assert.Nil(t, img.Parent())
+	assert.NoError(t, AppendChild(root, img))
+	assert.Equal(t, root, img.Parent())
+}
+
+func TestEditInvalidatesRaw(t *testing.T) {
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("smime-signed.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	signed := mime.Root.FirstChild()
+	signature := signed.NextSibling()
+	assert.NotNil(t, rawContent(signed))
+
+	assert.NoError(t, SetContent(signed, []byte("Tampered")))
+	assert.Nil(t, rawContent(signed))
+	assert.NotNil(t, rawContent(signature))
+
+	// The edited part is encoded, so the signature no longer matches
+	var buf bytes.Buffer
+	assert.NoError(t, mime.Encode(&buf, &EncodeOptions{PreserveRaw: true}))
+	out, err := ReadMIMEBody(&buf)
+	if assert.NoError(t, err) {
+		sigs, err := out.VerifySMIME(testSMIMERoots())
+		if assert.NoError(t, err) && assert.Equal(t, 1, len(sigs)) {
+			assert.False(t, sigs[0].Valid)
+		}
+	}
+}
+
 // openPart is a test utility function to open a part as a reader
 func openPart(filename string) *bufio.Reader {
 	// Open test part for parsing
@@ -0,0 +1,181 @@
+package enmime
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"strings"
+	"time"
+
+	// x/crypto/openpgp is frozen, but it comes from golang.org/x like the charset support
+	// in part.go and PGP/MIME only uses its stable core.  Its maintained fork
+	// github.com/ProtonMail/go-crypto/openpgp has the same API and can be switched to by
+	// changing the imports here and in pgpinline.go.
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// PGPSignature is an OpenPGP signature over a MIME entity, either a PGP/MIME (RFC 3156)
+// multipart/signed signature or a signature inside an encrypted message
+type PGPSignature struct {
+	Part         MIMEPart        // The multipart/signed part, or the decrypted root part
+	Content      []byte          // The signed MIME entity, with CRLF line breaks
+	KeyID        uint64          // ID of the key that made the signature; zero if unknown
+	CreationTime time.Time       // Zero if unknown
+	Signer       *openpgp.Entity // Owner of the key; nil if it is not in the keyring
+	Valid        bool
+	Err          error // Why the signature did not verify; nil if Valid
+}
+
+// PGPDecryption describes a PGP/MIME multipart/encrypted part decrypted by DecryptPGP
+type PGPDecryption struct {
+	EncryptedToKeyIDs []uint64      // IDs of the keys the message was encrypted to
+	Signature         *PGPSignature // Nil if the encrypted data was not signed
+}
+
+// hasProtocol returns true if the Content-Type of p has the protocol parameter protocol
+func hasProtocol(p MIMEPart, protocol string) bool {
+	_, params, err := mime.ParseMediaType(p.Header().Get("Content-Type"))
+	return err == nil && strings.EqualFold(params["protocol"], protocol)
+}
+
+// VerifyPGP verifies the PGP/MIME signatures of the message with the public keys in
+// keyring.  The signed part is verified with CRLF line breaks as RFC 3156 requires.
+// Signatures that do not verify, including those made by keys missing from keyring, are
+// returned with Valid false; an error is returned for malformed signed parts.
+func (m *MIMEBody) VerifyPGP(keyring openpgp.KeyRing) ([]PGPSignature, error) {
+	signatures := make([]PGPSignature, 0, 1)
+	if m.Root == nil {
+		return signatures, nil
+	}
+
+	parts := BreadthMatchAll(m.Root, func(p MIMEPart) bool {
+		return p.ContentType() == "multipart/signed" && hasProtocol(p, "application/pgp-signature")
+	})
+	for _, p := range parts {
+		signed := p.FirstChild()
+		if signed == nil || signed.NextSibling() == nil {
+			return nil, fmt.Errorf("multipart/signed part does not have two parts")
+		}
+		content := rawContent(signed)
+		if content == nil {
+			return nil, fmt.Errorf("Original bytes of the signed part are not available")
+		}
+
+		s := PGPSignature{Part: p, Content: toCRLF(content)}
+		sig, err := readPGPSignature(signed.NextSibling().Content())
+		if err != nil {
+			return nil, err
+		}
+		if sig.IssuerKeyId != nil {
+			s.KeyID = *sig.IssuerKeyId
+		}
+		s.CreationTime = sig.CreationTime
+		s.Signer, s.Err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(s.Content),
+			pgpReader(signed.NextSibling().Content()))
+		s.Valid = s.Err == nil
+		signatures = append(signatures, s)
+	}
+
+	return signatures, nil
+}
+
+// DecryptPGP decrypts the first PGP/MIME multipart/encrypted part of the message with the
+// private keys in keyring, calling prompt, which may be nil, if they are protected by a
+// passphrase.  Like DecryptSMIME, it leaves m as it is and returns the decrypted entity
+// parsed into a new MIMEBody.  Signatures inside the encrypted data are verified with the
+// public keys in keyring.
+func (m *MIMEBody) DecryptPGP(keyring openpgp.KeyRing, prompt openpgp.PromptFunction) (*MIMEBody,
+	*PGPDecryption, error) {
+	var p MIMEPart
+	if m.Root != nil {
+		p = BreadthMatchFirst(m.Root, func(p MIMEPart) bool {
+			return p.ContentType() == "multipart/encrypted" && hasProtocol(p, "application/pgp-encrypted")
+		})
+	}
+	if p == nil {
+		return nil, nil, fmt.Errorf("Message is not PGP/MIME encrypted")
+	}
+	control := p.FirstChild()
+	if control == nil || control.NextSibling() == nil {
+		return nil, nil, fmt.Errorf("multipart/encrypted part does not have two parts")
+	}
+	if control.ContentType() != "application/pgp-encrypted" {
+		return nil, nil, fmt.Errorf("Unexpected %v control part in multipart/encrypted part",
+			control.ContentType())
+	}
+
+	d := &PGPDecryption{}
+	content, encrypted, err := readPGPMessage(control.NextSibling().Content(), keyring, prompt, d)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !encrypted {
+		return nil, nil, fmt.Errorf("PGP/MIME encrypted part is not encrypted")
+	}
+	clear, err := m.decryptedBody(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.Signature != nil {
+		d.Signature.Part = clear.Root
+		d.Signature.Content = content
+	}
+	return clear, d, nil
+}
+
+// readPGPMessage decrypts an armored or binary OpenPGP message, recording the keys it was
+// encrypted to and its signature in d, and returns the cleartext with CRLF line breaks and
+// whether the message was encrypted
+func readPGPMessage(data []byte, keyring openpgp.KeyRing, prompt openpgp.PromptFunction,
+	d *PGPDecryption) ([]byte, bool, error) {
+	md, err := openpgp.ReadMessage(pgpReader(data), keyring, prompt, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error reading PGP message: %v", err)
+	}
+	d.EncryptedToKeyIDs = md.EncryptedToKeyIds
+	content, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		// Includes modification detection failures
+		return nil, false, fmt.Errorf("Error reading PGP message: %v", err)
+	}
+
+	if md.IsSigned {
+		s := &PGPSignature{KeyID: md.SignedByKeyId, Err: md.SignatureError}
+		if md.SignedBy != nil {
+			s.Signer = md.SignedBy.Entity
+		} else if s.Err == nil {
+			s.Err = fmt.Errorf("Unknown signer key %016X", md.SignedByKeyId)
+		}
+		if md.Signature != nil {
+			s.CreationTime = md.Signature.CreationTime
+		}
+		s.Valid = s.Err == nil
+		d.Signature = s
+	}
+	return toCRLF(content), md.IsEncrypted, nil
+}
+
+// pgpReader returns a reader of the OpenPGP packets in data, which may be ASCII armored
+func pgpReader(data []byte) io.Reader {
+	if block, err := armor.Decode(bytes.NewReader(data)); err == nil {
+		return block.Body
+	}
+	return bytes.NewReader(data)
+}
+
+// readPGPSignature reads the first signature packet of an armored or binary signature
+func readPGPSignature(data []byte) (*packet.Signature, error) {
+	p, err := packet.Read(pgpReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Malformed PGP signature: %v", err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		return nil, fmt.Errorf("PGP signature part does not hold a signature")
+	}
+	return sig, nil
+}
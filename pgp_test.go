@@ -0,0 +1,128 @@
+package enmime
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+)
+
+const (
+	testPGPJoeKeyID  = 0x0C2C9696DC08075A
+	testPGPJaneKeyID = 0xDB4900BB01D7DAC0
+)
+
+// readKeyRing reads an armored key ring from test-data/pgp
+func readKeyRing(filename string) openpgp.EntityList {
+	f, err := os.Open(filepath.Join("test-data", "pgp", filename))
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	keyring, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		panic(err)
+	}
+	return keyring
+}
+
+func TestVerifyPGP(t *testing.T) {
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("pgp-signed.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	assert.Contains(t, mime.Text, "Thursday – same room")
+
+	sigs, err := mime.VerifyPGP(readKeyRing("pubring.asc"))
+	if !assert.NoError(t, err) || !assert.Equal(t, 1, len(sigs)) {
+		return
+	}
+	s := sigs[0]
+	assert.True(t, s.Valid, "%v", s.Err)
+	assert.Equal(t, mime.Root, s.Part)
+	assert.Equal(t, uint64(testPGPJoeKeyID), s.KeyID)
+	assert.False(t, s.CreationTime.IsZero())
+	if assert.NotNil(t, s.Signer) {
+		assert.Contains(t, s.Signer.Identities, "Joe Sender <joe@example.net>")
+	}
+}
+
+func TestVerifyPGPFailures(t *testing.T) {
+	// Unknown key
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("pgp-signed.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	sigs, err := mime.VerifyPGP(openpgp.EntityList{})
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(sigs)) {
+		assert.False(t, sigs[0].Valid)
+		assert.Equal(t, uint64(testPGPJoeKeyID), sigs[0].KeyID)
+		assert.Nil(t, sigs[0].Signer)
+		assert.Error(t, sigs[0].Err)
+	}
+
+	// Tampered content
+	raw := bytes.Replace(readRawMessage("pgp-signed.raw"), []byte("Thursday"), []byte("Saturday"), 1)
+	mime, err = ReadMIMEBody(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	sigs, err = mime.VerifyPGP(readKeyRing("pubring.asc"))
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(sigs)) {
+		assert.False(t, sigs[0].Valid)
+		assert.Error(t, sigs[0].Err)
+	}
+}
+
+func TestDecryptPGP(t *testing.T) {
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("pgp-encrypted.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	assert.Equal(t, "multipart/encrypted", mime.Root.ContentType())
+
+	keyring := append(readKeyRing("jane-secret.asc"), readKeyRing("pubring.asc")...)
+	clear, d, err := mime.DecryptPGP(keyring, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []uint64{testPGPJaneKeyID}, d.EncryptedToKeyIDs)
+	if assert.NotNil(t, d.Signature) {
+		assert.True(t, d.Signature.Valid, "%v", d.Signature.Err)
+		assert.Equal(t, uint64(testPGPJoeKeyID), d.Signature.KeyID)
+		assert.NotNil(t, d.Signature.Signer)
+		assert.Equal(t, clear.Root, d.Signature.Part)
+	}
+
+	// The cleartext is a new message and the encrypted one is left alone
+	assert.Equal(t, "multipart/encrypted", mime.Root.ContentType())
+	assert.Equal(t, "multipart/mixed", clear.Root.ContentType())
+	assert.Contains(t, clear.Text, "Keep it under wraps – thanks.")
+	if assert.Equal(t, 1, len(clear.Attachments)) {
+		assert.Equal(t, "budget.csv", clear.Attachments[0].FileName())
+		assert.Equal(t, "item,amount\ntravel,1200\n", string(clear.Attachments[0].Content()))
+	}
+	assert.Equal(t, "Budget", clear.GetHeader("Subject"))
+}
+
+func TestDecryptPGPFailures(t *testing.T) {
+	// Not encrypted
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("pgp-signed.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	_, _, err = mime.DecryptPGP(readKeyRing("jane-secret.asc"), nil)
+	assert.Error(t, err)
+
+	// No secret key, the message is left alone
+	mime, err = ReadMIMEBody(bytes.NewReader(readRawMessage("pgp-encrypted.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	_, _, err = mime.DecryptPGP(readKeyRing("pubring.asc"), nil)
+	assert.Error(t, err)
+	assert.Equal(t, "multipart/encrypted", mime.Root.ContentType())
+}
@@ -0,0 +1,192 @@
+package enmime
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// PGPBlockType is the kind of an ASCII armored OpenPGP block, as given by its BEGIN line
+type PGPBlockType int
+
+const (
+	PGPBlockSignedMessage PGPBlockType = iota // Cleartext signed message
+	PGPBlockMessage                           // Encrypted or signed message
+	PGPBlockPublicKey                         // Public key block
+	PGPBlockSignature                         // Detached signature
+)
+
+// pgpBlockLabels are the armor labels of the block types
+var pgpBlockLabels = map[PGPBlockType]string{
+	PGPBlockSignedMessage: "PGP SIGNED MESSAGE",
+	PGPBlockMessage:       "PGP MESSAGE",
+	PGPBlockPublicKey:     "PGP PUBLIC KEY BLOCK",
+	PGPBlockSignature:     "PGP SIGNATURE",
+}
+
+// String returns the armor label of the block type
+func (t PGPBlockType) String() string {
+	return pgpBlockLabels[t]
+}
+
+// PGPBlock is an ASCII armored OpenPGP block found inline in a text body
+type PGPBlock struct {
+	Type    PGPBlockType
+	Start   int    // Byte offset of the BEGIN line in the text
+	End     int    // Byte offset just past the END line, excluding its line break
+	Armored string // The block as found in the text
+
+	// Cleartext is the text of a signed message without the armor and dash escaping, or
+	// the content of a message once read with a keyring.  It is empty for other blocks, and
+	// for messages that could not be read.
+	Cleartext string
+
+	Decrypted         bool          // True if the message was encrypted and has been decrypted
+	EncryptedToKeyIDs []uint64      // IDs of the keys the message was encrypted to
+	Signature         *PGPSignature // Result of verifying the signature, if it was checked
+	Err               error         // Why the message could not be decrypted
+}
+
+// FindPGPBlocks returns the ASCII armored OpenPGP blocks in text, in order.  A block must
+// start at the beginning of a line, so quoted blocks are ignored, and blocks without an
+// END line are skipped.  The Cleartext of signed messages is filled in.
+func FindPGPBlocks(text string) []PGPBlock {
+	var blocks []PGPBlock
+	var current *PGPBlock
+	signatureStarted := false
+
+	for pos := 0; pos < len(text); {
+		end := strings.IndexByte(text[pos:], '\n')
+		next := len(text)
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += pos
+			next = end + 1
+		}
+		line := strings.TrimRight(text[pos:end], " \t\r")
+
+		if current == nil {
+			for t := PGPBlockSignedMessage; t <= PGPBlockSignature; t++ {
+				if line == "-----BEGIN "+t.String()+"-----" {
+					current = &PGPBlock{Type: t, Start: pos}
+					signatureStarted = t != PGPBlockSignedMessage
+				}
+			}
+		} else {
+			endLabel := current.Type
+			if endLabel == PGPBlockSignedMessage {
+				// The cleartext is followed by a signature block
+				endLabel = PGPBlockSignature
+				if line == "-----BEGIN PGP SIGNATURE-----" {
+					signatureStarted = true
+				}
+			}
+			if signatureStarted && line == "-----END "+endLabel.String()+"-----" {
+				current.End = pos + len(line)
+				current.Armored = text[current.Start:current.End]
+				if current.Type == PGPBlockSignedMessage {
+					if b, _ := clearsign.Decode([]byte(current.Armored)); b != nil {
+						current.Cleartext = current.lineBreaks(string(b.Plaintext))
+					}
+				}
+				blocks = append(blocks, *current)
+				current = nil
+			} else if strings.HasPrefix(line, "-----BEGIN PGP ") && current.Type != PGPBlockSignedMessage {
+				// A new block starts before this one ended, abandon it
+				current = nil
+				continue
+			}
+		}
+		pos = next
+	}
+
+	return blocks
+}
+
+// PGPBlocks returns the ASCII armored OpenPGP blocks in the Text of the message, see
+// FindPGPBlocks.  If keyring is not nil, signatures are verified with its public keys, and
+// messages are decrypted with its private keys, calling prompt, which may be nil, if they
+// are protected by a passphrase.  Failures are recorded in the blocks.
+func (m *MIMEBody) PGPBlocks(keyring openpgp.KeyRing, prompt openpgp.PromptFunction) []PGPBlock {
+	blocks := FindPGPBlocks(m.Text)
+	if keyring == nil {
+		return blocks
+	}
+	for i := range blocks {
+		b := &blocks[i]
+		switch b.Type {
+		case PGPBlockSignedMessage:
+			b.verify(keyring)
+		case PGPBlockMessage:
+			b.decrypt(keyring, prompt)
+		}
+	}
+	return blocks
+}
+
+// verify checks the signature of a cleartext signed message
+func (b *PGPBlock) verify(keyring openpgp.KeyRing) {
+	cb, _ := clearsign.Decode([]byte(b.Armored))
+	if cb == nil {
+		return
+	}
+	s := &PGPSignature{Content: cb.Bytes}
+	if sig, err := readPGPSignature([]byte(b.Armored[strings.Index(b.Armored,
+		"-----BEGIN PGP SIGNATURE-----"):])); err == nil {
+		if sig.IssuerKeyId != nil {
+			s.KeyID = *sig.IssuerKeyId
+		}
+		s.CreationTime = sig.CreationTime
+	}
+	s.Signer, s.Err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(cb.Bytes),
+		cb.ArmoredSignature.Body)
+	s.Valid = s.Err == nil
+	b.Signature = s
+}
+
+// lineBreaks removes the final line break of text, which has LF line breaks, and converts
+// the others to CRLF if the block uses them
+func (b *PGPBlock) lineBreaks(text string) string {
+	text = strings.TrimSuffix(text, "\n")
+	if strings.Contains(b.Armored, "\r\n") {
+		text = strings.Replace(text, "\n", "\r\n", -1)
+	}
+	return text
+}
+
+// decrypt decrypts an armored message, which may also be only signed
+func (b *PGPBlock) decrypt(keyring openpgp.KeyRing, prompt openpgp.PromptFunction) {
+	d := &PGPDecryption{}
+	content, encrypted, err := readPGPMessage([]byte(b.Armored), keyring, prompt, d)
+	b.EncryptedToKeyIDs = d.EncryptedToKeyIDs
+	if err != nil {
+		b.Err = err
+		return
+	}
+	b.Decrypted = encrypted
+	b.Cleartext = b.lineBreaks(strings.Replace(string(content), "\r\n", "\n", -1))
+	if d.Signature != nil {
+		d.Signature.Content = content
+		b.Signature = d.Signature
+	}
+}
+
+// PGPCleartext returns text with the armor of the blocks found in it removed: each block
+// with a Cleartext is replaced by it, other blocks are left as they are
+func PGPCleartext(text string, blocks []PGPBlock) string {
+	var buf bytes.Buffer
+	pos := 0
+	for _, b := range blocks {
+		if b.Start < pos || b.End > len(text) || b.Cleartext == "" {
+			continue
+		}
+		buf.WriteString(text[pos:b.Start])
+		buf.WriteString(b.Cleartext)
+		pos = b.End
+	}
+	buf.WriteString(text[pos:])
+	return buf.String()
+}
@@ -0,0 +1,100 @@
+package enmime
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindPGPBlocks(t *testing.T) {
+	text := "Intro\n" +
+		"-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nmQENBGrUyc\n-----END PGP PUBLIC KEY BLOCK-----\n" +
+		"> -----BEGIN PGP MESSAGE-----\n> quoted\n> -----END PGP MESSAGE-----\n" +
+		"-----BEGIN PGP MESSAGE-----\nunterminated\n" +
+		"-----BEGIN PGP SIGNATURE-----\n\niQFE\n-----END PGP SIGNATURE-----"
+
+	blocks := FindPGPBlocks(text)
+	if !assert.Equal(t, 2, len(blocks)) {
+		return
+	}
+	assert.Equal(t, PGPBlockPublicKey, blocks[0].Type)
+	assert.Equal(t, 6, blocks[0].Start)
+	assert.True(t, strings.HasPrefix(text[blocks[0].End:], "\n> "))
+	assert.Equal(t, "", blocks[0].Cleartext)
+	assert.Equal(t, PGPBlockSignature, blocks[1].Type)
+	assert.Equal(t, len(text), blocks[1].End)
+	assert.Equal(t, "PGP SIGNATURE", blocks[1].Type.String())
+
+	assert.Equal(t, 0, len(FindPGPBlocks("No armor here\n")))
+}
+
+func TestPGPBlocks(t *testing.T) {
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("pgp-inline.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+
+	// Detection only
+	blocks := mime.PGPBlocks(nil, nil)
+	if !assert.Equal(t, 2, len(blocks)) {
+		return
+	}
+	signed, message := blocks[0], blocks[1]
+	assert.Equal(t, PGPBlockSignedMessage, signed.Type)
+	assert.Equal(t, signed.Armored, mime.Text[signed.Start:signed.End])
+	assert.True(t, strings.HasSuffix(signed.Armored, "-----END PGP SIGNATURE-----"))
+	// Dash escaping is removed
+	assert.Equal(t, "Jane,\r\n\r\n- The invoice number is 4711.\r\nPlease pay by Friday.\r\n\r\nJoe",
+		signed.Cleartext)
+	assert.Nil(t, signed.Signature)
+	assert.Equal(t, PGPBlockMessage, message.Type)
+	assert.Equal(t, "", message.Cleartext)
+	assert.False(t, message.Decrypted)
+
+	// Verify and decrypt
+	keyring := append(readKeyRing("jane-secret.asc"), readKeyRing("pubring.asc")...)
+	blocks = mime.PGPBlocks(keyring, nil)
+	signed, message = blocks[0], blocks[1]
+	if assert.NotNil(t, signed.Signature) {
+		assert.True(t, signed.Signature.Valid, "%v", signed.Signature.Err)
+		assert.Equal(t, uint64(testPGPJoeKeyID), signed.Signature.KeyID)
+	}
+	assert.NoError(t, message.Err)
+	assert.True(t, message.Decrypted)
+	assert.Equal(t, []uint64{testPGPJaneKeyID}, message.EncryptedToKeyIDs)
+	assert.Equal(t, "The account number is 12345678.", message.Cleartext)
+	if assert.NotNil(t, message.Signature) {
+		assert.True(t, message.Signature.Valid, "%v", message.Signature.Err)
+	}
+
+	clear := PGPCleartext(mime.Text, blocks)
+	assert.NotContains(t, clear, "-----BEGIN")
+	assert.Contains(t, clear, "Here is the signed notice:\r\n\r\nJane,\r\n")
+	assert.Contains(t, clear, "encrypted:\r\n\r\nThe account number is 12345678.\r\n\r\nRegards")
+}
+
+func TestPGPBlocksFailures(t *testing.T) {
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("pgp-inline.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	mime.Text = strings.Replace(mime.Text, "Please pay by Friday", "Please pay by Monday", 1)
+
+	// Public keys only: the signature fails, the message cannot be decrypted
+	blocks := mime.PGPBlocks(readKeyRing("pubring.asc"), nil)
+	if !assert.Equal(t, 2, len(blocks)) {
+		return
+	}
+	if assert.NotNil(t, blocks[0].Signature) {
+		assert.False(t, blocks[0].Signature.Valid)
+	}
+	assert.Error(t, blocks[1].Err)
+	assert.False(t, blocks[1].Decrypted)
+
+	// The undecrypted message keeps its armor
+	clear := PGPCleartext(mime.Text, blocks)
+	assert.NotContains(t, clear, "-----BEGIN PGP SIGNED MESSAGE-----")
+	assert.Contains(t, clear, "-----BEGIN PGP MESSAGE-----")
+}
@@ -0,0 +1,628 @@
+package enmime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"time"
+
+	// Register the hash functions S/MIME signatures use
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// This file implements the subset of the Cryptographic Message Syntax (RFC 5652) needed to
+// verify and decrypt S/MIME (RFC 8551) messages.
+
+var (
+	oidData               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidAuthEnvelopedData  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 23}
+	oidAttrMessageDigest  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningTime    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidDigestSHA1         = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidDigestSHA256       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidDigestSHA384       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidDigestSHA512       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidEncryptionRSA      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidEncryptionRSAOAEP  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidSignatureSHA1RSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSignatureSHA256RSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSignatureSHA384RSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSignatureSHA512RSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidPublicKeyECDSA     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSignatureECDSA     = asn1.ObjectIdentifier{1, 2, 840, 10045, 4}
+	oidAES128CBC          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidAES128GCM          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 6}
+	oidAES192GCM          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 26}
+	oidAES256GCM          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 46}
+)
+
+// pkcs7ContentInfo is the outer structure of every CMS object
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// pkcs7SignedData is the SignedData content type
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo pkcs7ContentInfo
+	Certificates     asn1.RawValue     `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue     `asn1:"optional,tag:1"`
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+// pkcs7SignerInfo describes a single signer of a SignedData
+type pkcs7SignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// pkcs7IssuerAndSerial identifies a certificate by its issuer and serial number
+type pkcs7IssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+// pkcs7Attribute is a signed or unsigned attribute of a SignerInfo
+type pkcs7Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// signedData is a parsed SignedData
+type signedData struct {
+	certificates []*x509.Certificate
+	content      []byte // Encapsulated content; nil if the signature is detached
+	signers      []pkcs7SignerInfo
+}
+
+// parseContentInfo parses a BER or DER encoded ContentInfo
+func parseContentInfo(data []byte) (*pkcs7ContentInfo, error) {
+	der, err := berToDER(data)
+	if err != nil {
+		return nil, fmt.Errorf("Malformed PKCS #7 data: %v", err)
+	}
+	info := &pkcs7ContentInfo{}
+	if rest, err := asn1.Unmarshal(der, info); err != nil {
+		return nil, fmt.Errorf("Malformed PKCS #7 data: %v", err)
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("Trailing data after PKCS #7 content")
+	}
+	return info, nil
+}
+
+// parseSignedData parses a ContentInfo holding SignedData
+func parseSignedData(data []byte) (*signedData, error) {
+	info, err := parseContentInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	if !info.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("PKCS #7 content is not signed data: %v", info.ContentType)
+	}
+	var sd pkcs7SignedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("Malformed PKCS #7 signed data: %v", err)
+	}
+
+	result := &signedData{signers: sd.SignerInfos}
+	if len(sd.Certificates.Bytes) > 0 {
+		certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("Malformed certificate in PKCS #7 signed data: %v", err)
+		}
+		result.certificates = certs
+	}
+	if len(sd.EncapContentInfo.Content.Bytes) > 0 {
+		var content []byte
+		if _, err := asn1.Unmarshal(sd.EncapContentInfo.Content.Bytes, &content); err != nil {
+			return nil, fmt.Errorf("Malformed PKCS #7 encapsulated content: %v", err)
+		}
+		result.content = content
+	}
+	return result, nil
+}
+
+// findCertificate returns the certificate identified by sid, or nil
+func findCertificate(certs []*x509.Certificate, sid asn1.RawValue) *x509.Certificate {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		// subjectKeyIdentifier
+		for _, c := range certs {
+			if bytes.Equal(c.SubjectKeyId, sid.Bytes) {
+				return c
+			}
+		}
+		return nil
+	}
+	var ias pkcs7IssuerAndSerial
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+		return nil
+	}
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) && c.SerialNumber.Cmp(ias.Serial) == 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+// verifySigner checks the signature of si over content, returning the signer certificate
+// and signing time.  The certificate chain is not verified.
+func (sd *signedData) verifySigner(si pkcs7SignerInfo, content []byte) (*x509.Certificate, time.Time,
+	error) {
+	var signingTime time.Time
+	cert := findCertificate(sd.certificates, si.SID)
+	if cert == nil {
+		return nil, signingTime, fmt.Errorf("Signer certificate not included in the signature")
+	}
+	hash, err := pkcs7Hash(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return cert, signingTime, err
+	}
+	h := hash.New()
+	h.Write(content)
+	digest := h.Sum(nil)
+
+	signed := content
+	if len(si.SignedAttrs.FullBytes) > 0 {
+		// The signature covers the DER encoding of the attributes as a SET OF, rather
+		// than with the implicit tag they are sent with
+		signed = append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+		var attrs []pkcs7Attribute
+		if _, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+			return cert, signingTime, fmt.Errorf("Malformed signed attributes: %v", err)
+		}
+		var messageDigest []byte
+		for _, a := range attrs {
+			switch {
+			case a.Type.Equal(oidAttrMessageDigest):
+				asn1.Unmarshal(a.Values.Bytes, &messageDigest)
+			case a.Type.Equal(oidAttrSigningTime):
+				asn1.Unmarshal(a.Values.Bytes, &signingTime)
+			}
+		}
+		if !bytes.Equal(messageDigest, digest) {
+			return cert, signingTime, fmt.Errorf("Message digest does not match the content")
+		}
+		h = hash.New()
+		h.Write(signed)
+		digest = h.Sum(nil)
+	}
+
+	if err := pkcs7VerifyDigest(cert.PublicKey, si.SignatureAlgorithm.Algorithm, hash, digest,
+		si.Signature); err != nil {
+		return cert, signingTime, err
+	}
+	return cert, signingTime, nil
+}
+
+// pkcs7Hash returns the hash function identified by a digest algorithm
+func pkcs7Hash(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidDigestSHA1):
+		return crypto.SHA1, nil
+	case oid.Equal(oidDigestSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidDigestSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidDigestSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("Unsupported digest algorithm %v", oid)
+}
+
+// pkcs7VerifyDigest checks a signature made with the signature algorithm oid
+func pkcs7VerifyDigest(pub crypto.PublicKey, oid asn1.ObjectIdentifier, hash crypto.Hash, digest,
+	sig []byte) error {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		switch {
+		case oid.Equal(oidEncryptionRSA), oid.Equal(oidSignatureSHA1RSA), oid.Equal(oidSignatureSHA256RSA),
+			oid.Equal(oidSignatureSHA384RSA), oid.Equal(oidSignatureSHA512RSA):
+		default:
+			return fmt.Errorf("Unsupported signature algorithm %v", oid)
+		}
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, sig); err != nil {
+			return fmt.Errorf("Signature did not verify")
+		}
+	case *ecdsa.PublicKey:
+		if !oid.Equal(oidPublicKeyECDSA) && !(len(oid) > len(oidSignatureECDSA) &&
+			oid[:len(oidSignatureECDSA)].Equal(oidSignatureECDSA)) {
+			return fmt.Errorf("Unsupported signature algorithm %v", oid)
+		}
+		if !ecdsa.VerifyASN1(key, digest, sig) {
+			return fmt.Errorf("Signature did not verify")
+		}
+	default:
+		return fmt.Errorf("Unsupported public key type %T", pub)
+	}
+	return nil
+}
+
+// pkcs7EnvelopedData is the EnvelopedData content type
+type pkcs7EnvelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo pkcs7EncryptedContentInfo
+}
+
+// pkcs7AuthEnvelopedData is the AuthEnvelopedData content type (RFC 5083)
+type pkcs7AuthEnvelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo pkcs7EncryptedContentInfo
+	AuthAttrs            asn1.RawValue `asn1:"optional,tag:1"`
+	MAC                  []byte
+}
+
+// pkcs7EncryptedContentInfo holds the encrypted content and how it was encrypted
+type pkcs7EncryptedContentInfo struct {
+	ContentType      asn1.ObjectIdentifier
+	Algorithm        pkix.AlgorithmIdentifier
+	EncryptedContent asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// pkcs7KeyTransRecipient is a KeyTransRecipientInfo, the recipient type used with RSA keys
+type pkcs7KeyTransRecipient struct {
+	Version      int
+	RID          asn1.RawValue
+	Algorithm    pkix.AlgorithmIdentifier
+	EncryptedKey []byte
+}
+
+// pkcs7OAEPParams are the RSAES-OAEP parameters (RFC 8017); only the hash is used, the
+// mask generation function is assumed to be MGF1 with the same hash
+type pkcs7OAEPParams struct {
+	Hash pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:0"`
+}
+
+// pkcs7GCMParams are the AES-GCM parameters (RFC 5084)
+type pkcs7GCMParams struct {
+	Nonce  []byte
+	ICVLen int `asn1:"default:12,optional"`
+}
+
+// decryptEnveloped decrypts a ContentInfo holding EnvelopedData or AuthEnvelopedData for
+// the recipient identified by cert, returning the content
+func decryptEnveloped(data []byte, cert *x509.Certificate, key crypto.Decrypter) ([]byte, error) {
+	info, err := parseContentInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	var recipients []asn1.RawValue
+	var eci pkcs7EncryptedContentInfo
+	var mac, aad []byte
+	authenticated := false
+	switch {
+	case info.ContentType.Equal(oidEnvelopedData):
+		var ed pkcs7EnvelopedData
+		if _, err := asn1.Unmarshal(info.Content.Bytes, &ed); err != nil {
+			return nil, fmt.Errorf("Malformed PKCS #7 enveloped data: %v", err)
+		}
+		recipients, eci = ed.RecipientInfos, ed.EncryptedContentInfo
+	case info.ContentType.Equal(oidAuthEnvelopedData):
+		var ed pkcs7AuthEnvelopedData
+		if _, err := asn1.Unmarshal(info.Content.Bytes, &ed); err != nil {
+			return nil, fmt.Errorf("Malformed PKCS #7 authenticated enveloped data: %v", err)
+		}
+		recipients, eci, mac = ed.RecipientInfos, ed.EncryptedContentInfo, ed.MAC
+		authenticated = true
+		if len(ed.AuthAttrs.FullBytes) > 0 {
+			// Authenticated as a SET OF, like signed attributes
+			aad = append([]byte{0x31}, ed.AuthAttrs.FullBytes[1:]...)
+		}
+	default:
+		return nil, fmt.Errorf("PKCS #7 content is not enveloped data: %v", info.ContentType)
+	}
+
+	// Content encryption algorithm
+	alg := eci.Algorithm.Algorithm
+	var keyLen int
+	var gcm bool
+	switch {
+	case alg.Equal(oidAES128CBC), alg.Equal(oidAES128GCM):
+		keyLen = 16
+	case alg.Equal(oidAES192CBC), alg.Equal(oidAES192GCM):
+		keyLen = 24
+	case alg.Equal(oidAES256CBC), alg.Equal(oidAES256GCM):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("Unsupported content encryption algorithm %v", alg)
+	}
+	gcm = alg.Equal(oidAES128GCM) || alg.Equal(oidAES192GCM) || alg.Equal(oidAES256GCM)
+	if gcm != authenticated {
+		return nil, fmt.Errorf("Content encryption algorithm %v not allowed for %v", alg, info.ContentType)
+	}
+
+	ktri, err := findRecipient(recipients, cert)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := decryptContentKey(ktri, key, keyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext := eci.EncryptedContent.Bytes
+	if eci.EncryptedContent.IsCompound {
+		// Constructed OCTET STRING with an implicit tag, which berToDER leaves alone
+		ciphertext = nil
+		for rest := eci.EncryptedContent.Bytes; len(rest) > 0; {
+			var segment asn1.RawValue
+			if rest, err = asn1.Unmarshal(rest, &segment); err != nil {
+				return nil, fmt.Errorf("Malformed encrypted content: %v", err)
+			}
+			ciphertext = append(ciphertext, segment.Bytes...)
+		}
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	if gcm {
+		var params pkcs7GCMParams
+		if _, err := asn1.Unmarshal(eci.Algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("Malformed AES-GCM parameters: %v", err)
+		}
+		if params.ICVLen != len(mac) {
+			return nil, fmt.Errorf("Authentication tag length %v does not match %v", len(mac), params.ICVLen)
+		}
+		var aead cipher.AEAD
+		switch {
+		case len(params.Nonce) == 12:
+			aead, err = cipher.NewGCMWithTagSize(block, params.ICVLen)
+		case params.ICVLen == 16:
+			aead, err = cipher.NewGCMWithNonceSize(block, len(params.Nonce))
+		default:
+			err = fmt.Errorf("Unsupported combination of nonce and tag sizes")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid AES-GCM parameters: %v", err)
+		}
+		content, err := aead.Open(nil, params.Nonce, append(ciphertext, mac...), aad)
+		if err != nil {
+			return nil, fmt.Errorf("Decryption failed: %v", err)
+		}
+		return content, nil
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(eci.Algorithm.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("Malformed AES-CBC parameters")
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("Encrypted content is not a multiple of the block size")
+	}
+	content := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(content, ciphertext)
+	pad := int(content[len(content)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return nil, fmt.Errorf("Decryption failed: invalid padding")
+	}
+	for _, b := range content[len(content)-pad:] {
+		if int(b) != pad {
+			return nil, fmt.Errorf("Decryption failed: invalid padding")
+		}
+	}
+	return content[:len(content)-pad], nil
+}
+
+// findRecipient returns the key transport recipient matching cert
+func findRecipient(recipients []asn1.RawValue, cert *x509.Certificate) (*pkcs7KeyTransRecipient, error) {
+	for _, r := range recipients {
+		if r.Class != asn1.ClassUniversal || r.Tag != asn1.TagSequence {
+			// Key agreement, key encryption key and password recipients are tagged
+			continue
+		}
+		var ktri pkcs7KeyTransRecipient
+		if _, err := asn1.Unmarshal(r.FullBytes, &ktri); err != nil {
+			return nil, fmt.Errorf("Malformed PKCS #7 recipient: %v", err)
+		}
+		if findCertificate([]*x509.Certificate{cert}, ktri.RID) != nil {
+			return &ktri, nil
+		}
+	}
+	return nil, fmt.Errorf("Message is not encrypted for certificate %v", cert.Subject)
+}
+
+// decryptContentKey recovers the content encryption key of ktri, which must be keyLen bytes
+func decryptContentKey(ktri *pkcs7KeyTransRecipient, key crypto.Decrypter, keyLen int) ([]byte, error) {
+	var opts crypto.DecrypterOpts
+	switch alg := ktri.Algorithm.Algorithm; {
+	case alg.Equal(oidEncryptionRSA):
+		// A random key is returned for invalid padding, so that padding errors cannot
+		// be told apart from decryption errors (RFC 3218)
+		opts = &rsa.PKCS1v15DecryptOptions{SessionKeyLen: keyLen}
+	case alg.Equal(oidEncryptionRSAOAEP):
+		hash := crypto.SHA1
+		if len(ktri.Algorithm.Parameters.FullBytes) > 0 {
+			var params pkcs7OAEPParams
+			if _, err := asn1.Unmarshal(ktri.Algorithm.Parameters.FullBytes, &params); err != nil {
+				return nil, fmt.Errorf("Malformed RSAES-OAEP parameters: %v", err)
+			}
+			if len(params.Hash.Algorithm) > 0 {
+				h, err := pkcs7Hash(params.Hash.Algorithm)
+				if err != nil {
+					return nil, err
+				}
+				hash = h
+			}
+		}
+		opts = &rsa.OAEPOptions{Hash: hash}
+	default:
+		return nil, fmt.Errorf("Unsupported key encryption algorithm %v", alg)
+	}
+
+	cek, err := key.Decrypt(rand.Reader, ktri.EncryptedKey, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Decryption of the content key failed: %v", err)
+	}
+	if len(cek) != keyLen {
+		return nil, fmt.Errorf("Content key has the wrong length")
+	}
+	return cek, nil
+}
+
+// berToDER converts BER encoded data, which S/MIME implementations commonly produce when
+// streaming, into DER that encoding/asn1 accepts: indefinite lengths are replaced by
+// definite ones, and constructed OCTET STRINGs are flattened into primitive ones.
+func berToDER(data []byte) ([]byte, error) {
+	out, rest, err := berElement(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("Trailing data after BER element")
+	}
+	return out, nil
+}
+
+// berMaxDepth limits the nesting of BER elements
+const berMaxDepth = 64
+
+// berElement converts the first element of data, returning it and the remaining data
+func berElement(data []byte, depth int) ([]byte, []byte, error) {
+	if depth > berMaxDepth {
+		return nil, nil, fmt.Errorf("BER nesting too deep")
+	}
+	if len(data) < 2 {
+		return nil, nil, fmt.Errorf("Truncated BER element")
+	}
+
+	// Identifier, possibly in the high tag number form
+	idLen := 1
+	if data[0]&0x1f == 0x1f {
+		for idLen < len(data) && data[idLen]&0x80 != 0 {
+			idLen++
+		}
+		idLen++
+		if idLen >= len(data) {
+			return nil, nil, fmt.Errorf("Truncated BER tag")
+		}
+	}
+	id := data[:idLen]
+	constructed := id[0]&0x20 != 0
+
+	// Length
+	pos := idLen
+	l := int(data[pos])
+	pos++
+	indefinite := false
+	switch {
+	case l == 0x80:
+		if !constructed {
+			return nil, nil, fmt.Errorf("Indefinite length on primitive BER element")
+		}
+		indefinite = true
+	case l > 0x80:
+		n := l & 0x7f
+		if n > 4 || pos+n > len(data) {
+			return nil, nil, fmt.Errorf("Invalid BER length")
+		}
+		l = 0
+		for _, b := range data[pos : pos+n] {
+			l = l<<8 | int(b)
+		}
+		pos += n
+	}
+	if !indefinite && (l < 0 || pos+l > len(data)) {
+		return nil, nil, fmt.Errorf("Truncated BER element")
+	}
+
+	if !constructed {
+		return derElement(id, data[pos:pos+l]), data[pos+l:], nil
+	}
+
+	// Convert the children
+	var content, rest []byte
+	if indefinite {
+		rest = data[pos:]
+	} else {
+		content, rest = data[pos:pos+l], data[pos+l:]
+	}
+	children := make([]byte, 0, l)
+	flatten := len(id) == 1 && id[0] == 0x24
+	var flat []byte
+	for {
+		var remaining []byte
+		if indefinite {
+			if len(rest) >= 2 && rest[0] == 0 && rest[1] == 0 {
+				rest = rest[2:]
+				break
+			}
+			remaining = rest
+		} else {
+			if len(content) == 0 {
+				break
+			}
+			remaining = content
+		}
+		child, after, err := berElement(remaining, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if indefinite {
+			rest = after
+		} else {
+			content = after
+		}
+		if flatten {
+			// Concatenate the segments of a constructed OCTET STRING
+			var segment asn1.RawValue
+			if _, err := asn1.Unmarshal(child, &segment); err != nil {
+				return nil, nil, err
+			}
+			flat = append(flat, segment.Bytes...)
+			continue
+		}
+		children = append(children, child...)
+	}
+
+	if flatten {
+		return derElement([]byte{0x04}, flat), rest, nil
+	}
+	return derElement(id, children), rest, nil
+}
+
+// derElement encodes an element with a definite length
+func derElement(id, content []byte) []byte {
+	out := make([]byte, 0, len(id)+5+len(content))
+	out = append(out, id...)
+	switch l := len(content); {
+	case l < 0x80:
+		out = append(out, byte(l))
+	case l < 0x100:
+		out = append(out, 0x81, byte(l))
+	case l < 0x10000:
+		out = append(out, 0x82, byte(l>>8), byte(l))
+	case l < 0x1000000:
+		out = append(out, 0x83, byte(l>>16), byte(l>>8), byte(l))
+	default:
+		out = append(out, 0x84, byte(l>>24), byte(l>>16), byte(l>>8), byte(l))
+	}
+	return append(out, content...)
+}
@@ -0,0 +1,113 @@
+package enmime
+
+import (
+	"bytes"
+	"io"
+)
+
+// QuotedPrintableEncoder writes quoted-printable encoded data as described in RFC 2045, in
+// lines of at most 76 characters ended by CRLF.  Text line breaks, whether CRLF, LF or CR,
+// are written as CRLF; in binary mode every byte is preserved, CR and LF are encoded.
+// Close must be called to write trailing whitespace.
+type QuotedPrintableEncoder struct {
+	w      io.Writer
+	binary bool
+	out    bytes.Buffer
+	col    int  // Length of the current output line
+	ws     byte // Space or tab not yet written, it must be encoded if a line break follows
+	cr     bool // A CR was seen in text mode, it may start a CRLF
+}
+
+// NewQuotedPrintableEncoder returns a QuotedPrintableEncoder writing to w, binary selects
+// binary mode.  QuotedPrintableEncoder implements the io.WriteCloser interface.
+func NewQuotedPrintableEncoder(w io.Writer, binary bool) *QuotedPrintableEncoder {
+	return &QuotedPrintableEncoder{w: w, binary: binary}
+}
+
+// Write method for io.Writer interface.
+func (e *QuotedPrintableEncoder) Write(p []byte) (int, error) {
+	for _, b := range p {
+		e.encode(b)
+	}
+	if _, err := e.out.WriteTo(e.w); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes pending whitespace and line breaks; it does not close the underlying
+// writer.
+func (e *QuotedPrintableEncoder) Close() error {
+	if e.cr {
+		e.cr = false
+		e.lineBreak()
+	}
+	e.flushSpace(true)
+	_, err := e.out.WriteTo(e.w)
+	return err
+}
+
+// encode adds the encoding of b to the output
+func (e *QuotedPrintableEncoder) encode(b byte) {
+	if !e.binary {
+		if e.cr {
+			e.cr = false
+			e.lineBreak()
+			if b == '\n' {
+				return
+			}
+		}
+		switch b {
+		case '\r':
+			e.cr = true
+			return
+		case '\n':
+			e.lineBreak()
+			return
+		}
+	}
+
+	e.flushSpace(false)
+	switch {
+	case b == ' ' || b == '\t':
+		e.ws = b
+	case b == '=' || b < ' ' || b > '~':
+		e.emit('=', upperhex[b>>4], upperhex[b&0x0f])
+	default:
+		e.emit(b)
+	}
+}
+
+// lineBreak ends the current line with a hard line break
+func (e *QuotedPrintableEncoder) lineBreak() {
+	e.flushSpace(true)
+	e.out.WriteString("\r\n")
+	e.col = 0
+}
+
+// flushSpace writes the pending whitespace, encoded if it ends a line
+func (e *QuotedPrintableEncoder) flushSpace(encoded bool) {
+	if e.ws == 0 {
+		return
+	}
+	b := e.ws
+	e.ws = 0
+	if encoded {
+		e.emit('=', upperhex[b>>4], upperhex[b&0x0f])
+	} else {
+		e.emit(b)
+	}
+}
+
+// emit writes the characters encoding one byte, inserting a soft line break if the line
+// would become too long
+func (e *QuotedPrintableEncoder) emit(c ...byte) {
+	if e.col+len(c) > 75 {
+		e.out.WriteString("=\r\n")
+		e.col = 0
+	}
+	e.out.Write(c)
+	e.col += len(c)
+}
+
+const upperhex = "0123456789ABCDEF"
@@ -0,0 +1,48 @@
+package enmime
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeQP encodes s in one call, or a byte at a time if split is true
+func encodeQP(s string, binary, split bool) string {
+	var buf bytes.Buffer
+	enc := NewQuotedPrintableEncoder(&buf, binary)
+	if split {
+		for i := 0; i < len(s); i++ {
+			enc.Write([]byte{s[i]})
+		}
+	} else {
+		enc.Write([]byte(s))
+	}
+	enc.Close()
+	return buf.String()
+}
+
+func TestQuotedPrintableEncoder(t *testing.T) {
+	for _, split := range []bool{false, true} {
+		assert.Equal(t, "a=3Db caf=C3=A9", encodeQP("a=b café", false, split))
+		// Whitespace ending a line is encoded
+		assert.Equal(t, "line=20\r\n\tnext=09", encodeQP("line \n\tnext\t", false, split))
+		// Line breaks are CRLF in text mode, encoded in binary mode
+		assert.Equal(t, "a\r\nb\r\nc\r\nd\r\n", encodeQP("a\r\nb\rc\nd\r", false, split))
+		assert.Equal(t, "a=0D=0Ab=0A", encodeQP("a\r\nb\n", true, split))
+	}
+
+	text := strings.Repeat("x", 74) + "= " + strings.Repeat("Grüße ", 30) + "\n" +
+		strings.Repeat("y", 200)
+	encoded := encodeQP(text, false, false)
+	for _, line := range strings.Split(encoded, "\r\n") {
+		assert.True(t, len(line) <= 76, "line too long: %q", line)
+	}
+	decoded, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(encoded)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, strings.Replace(text, "\n", "\r\n", -1), string(decoded))
+	}
+}
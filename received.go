@@ -0,0 +1,203 @@
+package enmime
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// ReceivedHop is a single Received header (RFC 5321 section 4.4) describing one step of the
+// delivery path of a message.  Fields that are absent from the header are left empty.
+type ReceivedHop struct {
+	From     string        // Name the sending host announced in HELO/EHLO
+	FromHost string        // Reverse DNS name of the sending host, as recorded by the receiver
+	FromIP   string        // Address of the sending host
+	By       string        // Host that received the message
+	Via      string        // Link type, such as UUCP
+	With     string        // Protocol, such as SMTP, ESMTPS or LMTP
+	ID       string        // Queue ID assigned by the receiver
+	For      string        // Envelope recipient, without angle brackets
+	Time     time.Time     // Time the message was received; zero if missing or unparseable
+	Delay    time.Duration // Time spent since the previous hop; zero for the first hop
+	Raw      string        // Header value as found in the message
+}
+
+// ReceivedChain parses the Received headers of the message.  Hops are returned in the order
+// the headers appear, so the first hop is the final delivery and the last one the origin.
+// Delay is computed between each hop and the one below it, whenever both have a time.
+func (m *MIMEBody) ReceivedChain() []ReceivedHop {
+	values := m.header["Received"]
+	hops := make([]ReceivedHop, len(values))
+	for i, value := range values {
+		hops[i] = ParseReceived(value)
+	}
+	for i := 0; i < len(hops)-1; i++ {
+		if !hops[i].Time.IsZero() && !hops[i+1].Time.IsZero() {
+			hops[i].Delay = hops[i].Time.Sub(hops[i+1].Time)
+		}
+	}
+	return hops
+}
+
+// ParseReceived parses a single Received header value.  Besides the RFC 5321 clauses it
+// understands the comments Postfix, Sendmail, Exim, qmail and Exchange use to record the
+// sending host, such as "(host.example.com [192.0.2.1])" or "([192.0.2.1] helo=host)".
+func ParseReceived(value string) ReceivedHop {
+	hop := ReceivedHop{Raw: value}
+
+	clauses := value
+	if semi := strings.LastIndex(value, ";"); semi >= 0 {
+		clauses = value[:semi]
+		if t, err := ParseDate(value[semi+1:]); err == nil {
+			hop.Time = t
+		}
+	}
+
+	keyword := ""
+	for _, token := range receivedTokens(clauses) {
+		lower := strings.ToLower(token)
+		switch lower {
+		case "from", "by", "via", "with", "id", "for":
+			keyword = lower
+			continue
+		}
+		if keyword == "" {
+			continue
+		}
+
+		if token[0] == '(' {
+			switch keyword {
+			case "from":
+				parseReceivedComment(&hop, token[1:len(token)-1])
+			case "with":
+				// A comment ends the protocol, words after it are not part of it
+				keyword = ""
+			}
+			continue
+		}
+		word := strings.TrimRight(token, ",")
+		switch keyword {
+		case "from":
+			if hop.From == "" {
+				if ip := receivedIP(word); ip != "" {
+					hop.FromIP = ip
+				} else {
+					hop.From = word
+				}
+			} else if hop.FromIP == "" {
+				hop.FromIP = receivedIP(word)
+			}
+		case "by":
+			if hop.By == "" {
+				hop.By = word
+			}
+		case "via":
+			if hop.Via == "" {
+				hop.Via = word
+			}
+		case "with":
+			// Usually a single word, but Exchange writes "with Microsoft SMTP Server"; the
+			// clause ends at the next keyword or comment
+			if hop.With != "" {
+				hop.With += " "
+			}
+			hop.With += word
+		case "id":
+			if hop.ID == "" {
+				hop.ID = strings.Trim(word, "<>")
+			}
+		case "for":
+			if hop.For == "" {
+				hop.For = strings.Trim(word, "<>")
+			}
+		}
+	}
+
+	return hop
+}
+
+// parseReceivedComment extracts the host name and address from the comment following the
+// from clause
+func parseReceivedComment(hop *ReceivedHop, comment string) {
+	words := strings.Fields(comment)
+	for i, word := range words {
+		lower := strings.ToLower(word)
+		switch {
+		case strings.HasPrefix(lower, "helo="):
+			// Exim
+			if hop.From == "" || hop.From == "unknown" {
+				hop.From = word[len("helo="):]
+			}
+		case lower == "helo" && i+1 < len(words):
+			// qmail
+			if hop.From == "" || hop.From == "unknown" {
+				hop.From = words[i+1]
+			}
+		case i > 0 && strings.ToLower(words[i-1]) == "helo":
+			// Already taken as the HELO name
+		case hop.FromIP == "" && receivedIP(word) != "":
+			hop.FromIP = receivedIP(word)
+		case hop.FromHost == "" && hop.FromIP == "" && strings.Contains(word, ".") &&
+			!strings.ContainsAny(word, "=:@[]()<>"):
+			hop.FromHost = strings.TrimRight(word, ".,")
+		}
+	}
+}
+
+// receivedIP returns the address in word, which may be enclosed in brackets and carry an
+// IPv6: prefix, or "" if word is not an address
+func receivedIP(word string) string {
+	word = strings.TrimRight(word, ",")
+	word = strings.TrimSuffix(strings.TrimPrefix(word, "["), "]")
+	if len(word) > 5 && strings.EqualFold(word[:5], "IPv6:") {
+		word = word[5:]
+	}
+	if ip := net.ParseIP(word); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// receivedTokens splits the clauses of a Received header into words, keeping (possibly
+// nested) comments as single tokens
+func receivedTokens(value string) []string {
+	tokens := make([]string, 0, 16)
+	for i := 0; i < len(value); {
+		switch c := value[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(':
+			depth, j := 0, i
+			for ; j < len(value); j++ {
+				if value[j] == '\\' {
+					j++
+				} else if value[j] == '(' {
+					depth++
+				} else if value[j] == ')' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if j >= len(value) {
+				j = len(value) - 1
+				tokens = append(tokens, value[i:]+")")
+			} else {
+				tokens = append(tokens, value[i:j+1])
+			}
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(value); j++ {
+				if value[j] == ' ' || value[j] == '\t' || value[j] == '\r' || value[j] == '\n' ||
+					value[j] == '(' {
+					break
+				}
+			}
+			tokens = append(tokens, value[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
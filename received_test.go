@@ -0,0 +1,140 @@
+package enmime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReceived(t *testing.T) {
+	var testTable = []struct {
+		input  string
+		expect ReceivedHop
+	}{
+		{
+			// Postfix
+			input: "from relay4-d.mail.gandi.net (relay4-d.mail.gandi.net [IPv6:2001:4b98:c:538::196]) " +
+				"by spool.mail.gandi.net (Postfix) with ESMTPS id 2BEDC142563 " +
+				"for <james@hillyerd.com>; Fri,  4 Jul 2014 10:57:12 +0200 (CEST)",
+			expect: ReceivedHop{
+				From:     "relay4-d.mail.gandi.net",
+				FromHost: "relay4-d.mail.gandi.net",
+				FromIP:   "2001:4b98:c:538::196",
+				By:       "spool.mail.gandi.net",
+				With:     "ESMTPS",
+				ID:       "2BEDC142563",
+				For:      "james@hillyerd.com",
+			},
+		},
+		{
+			// Postfix without reverse DNS, authenticated sender comment
+			input: "from laptop (unknown [192.0.2.10]) (Authenticated sender: joe@example.com) " +
+				"by mx.example.com (Postfix) with ESMTPSA id 0535F17207C; Fri, 4 Jul 2014 10:57:09 +0200",
+			expect: ReceivedHop{
+				From:   "laptop",
+				FromIP: "192.0.2.10",
+				By:     "mx.example.com",
+				With:   "ESMTPSA",
+				ID:     "0535F17207C",
+			},
+		},
+		{
+			// Exim
+			input: "from [192.0.2.20] (helo=client.example.net) by mx.example.com with esmtp " +
+				"(Exim 4.80) (envelope-from <joe@example.net>) id 1UjRxO-0001cV-Ek; " +
+				"Mon, 03 Jun 2013 10:00:00 +0200",
+			expect: ReceivedHop{
+				From:   "client.example.net",
+				FromIP: "192.0.2.20",
+				By:     "mx.example.com",
+				With:   "esmtp",
+				ID:     "1UjRxO-0001cV-Ek",
+			},
+		},
+		{
+			// qmail
+			input: "from unknown (HELO client.example.net) (192.0.2.30) by mx.example.com " +
+				"with SMTP; 3 Jun 2013 08:00:00 -0000",
+			expect: ReceivedHop{
+				From:   "client.example.net",
+				FromIP: "192.0.2.30",
+				By:     "mx.example.com",
+				With:   "SMTP",
+			},
+		},
+		{
+			// Exchange
+			input: "from AM0PR01MB1234.eurprd01.prod.exchangelabs.com (2603:10a6:208:e4::41) " +
+				"by AM0PR01MB5678.eurprd01.prod.exchangelabs.com (2603:10a6:208:e4::42) " +
+				"with Microsoft SMTP Server (version=TLS1_2, cipher=TLS_ECDHE_RSA) id 15.20.1234.5; " +
+				"Mon, 3 Jun 2013 08:00:00 +0000",
+			expect: ReceivedHop{
+				From:   "AM0PR01MB1234.eurprd01.prod.exchangelabs.com",
+				FromIP: "2603:10a6:208:e4::41",
+				By:     "AM0PR01MB5678.eurprd01.prod.exchangelabs.com",
+				With:   "Microsoft SMTP Server",
+				ID:     "15.20.1234.5",
+			},
+		},
+		{
+			// Words after the comment ending the with clause
+			input: "from client.example.net (client.example.net [192.0.2.40]) by mx.example.com " +
+				"with ESMTPS (TLS1.3) tls TLS_AES_256_GCM_SHA384 ID abc123 via relay " +
+				"for <jane@example.org>; Mon, 3 Jun 2013 08:00:00 +0000",
+			expect: ReceivedHop{
+				From:     "client.example.net",
+				FromHost: "client.example.net",
+				FromIP:   "192.0.2.40",
+				By:       "mx.example.com",
+				With:     "ESMTPS",
+				ID:       "abc123",
+				Via:      "relay",
+				For:      "jane@example.org",
+			},
+		},
+		{
+			// Local injection, no from clause and no date
+			input:  "by mx.example.com (Postfix, from userid 1000) id 4F1C31B14B2",
+			expect: ReceivedHop{By: "mx.example.com", ID: "4F1C31B14B2"},
+		},
+	}
+
+	for _, tt := range testTable {
+		hop := ParseReceived(tt.input)
+		hop.Raw = ""
+		hop.Time = time.Time{}
+		assert.Equal(t, tt.expect, hop, "Wrong hop for input %q", tt.input)
+	}
+
+	hop := ParseReceived("from a by b; Mon, 3 Jun 2013 10:00:00 +0200 (CEST)")
+	assert.True(t, hop.Time.Equal(time.Date(2013, time.June, 3, 8, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "from a by b; Mon, 3 Jun 2013 10:00:00 +0200 (CEST)", hop.Raw)
+}
+
+func TestMIMEBodyReceivedChain(t *testing.T) {
+	msg := readMessage("02-inline_pictures.eml")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	hops := mime.ReceivedChain()
+	if !assert.Equal(t, 7, len(hops)) {
+		return
+	}
+	assert.Equal(t, "nmboxes4-d.mgt.gandi.net", hops[0].By)
+	assert.Equal(t, "7748C1B14B3", hops[0].ID)
+	assert.Equal(t, "10.0.21.135", hops[0].FromIP)
+
+	last := hops[len(hops)-1]
+	assert.Equal(t, "jamess-mac-mini.hillyerd.com", last.From)
+	assert.Equal(t, "217-90.203-62.cust.bluewin.ch", last.FromHost)
+	assert.Equal(t, "62.203.90.217", last.FromIP)
+	assert.Equal(t, "ESMTPSA", last.With)
+	assert.Equal(t, time.Duration(0), last.Delay)
+
+	// Relay at 10:57:09, content filter at 10:57:10
+	assert.Equal(t, time.Second, hops[len(hops)-2].Delay)
+	assert.Equal(t, time.Duration(0), hops[0].Delay)
+}
@@ -0,0 +1,281 @@
+package enmime
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ReplySegmentKind identifies what a ReplySegment contains
+type ReplySegmentKind int
+
+const (
+	ReplyContent   ReplySegmentKind = iota // New content written by the sender
+	ReplyQuote                             // Quoted history of earlier messages
+	ReplySignature                         // Signature block following a "-- " delimiter
+)
+
+// String returns a human readable name for the segment kind
+func (k ReplySegmentKind) String() string {
+	switch k {
+	case ReplyContent:
+		return "content"
+	case ReplyQuote:
+		return "quote"
+	case ReplySignature:
+		return "signature"
+	}
+	return "unknown"
+}
+
+// ReplySegment is a contiguous run of a text or HTML body.  Start and End are byte offsets
+// into the body the segment was split from, such that Text == body[Start:End].
+type ReplySegment struct {
+	Kind  ReplySegmentKind
+	Start int
+	End   int
+	Text  string
+}
+
+// ReplySegments is an ordered list of segments covering an entire body
+type ReplySegments []ReplySegment
+
+// Content returns the concatenated text of all ReplyContent segments, with surrounding
+// whitespace trimmed.
+func (s ReplySegments) Content() string {
+	content := ""
+	for _, seg := range s {
+		if seg.Kind == ReplyContent {
+			content += seg.Text
+		}
+	}
+	return strings.TrimSpace(content)
+}
+
+// TextSegments splits the plain text body into new content, quoted history and signature
+func (m *MIMEBody) TextSegments() ReplySegments {
+	return SplitTextReply(m.Text)
+}
+
+// HtmlSegments splits the HTML body into new content, quoted history and signature
+func (m *MIMEBody) HtmlSegments() ReplySegments {
+	return SplitHtmlReply(m.Html)
+}
+
+var (
+	// "On Mon, 3 Jun 2013 at 10:00, Someone <someone@example.com> wrote:"
+	attributionRegexp = regexp.MustCompile(`(?i)^\s*On\s.*\bwrote:\s*$`)
+	// Outlook style "-----Original Message-----" separator
+	originalRegexp = regexp.MustCompile(`(?i)^\s*-{2,}\s*Original\s+Message\s*-{2,}\s*$`)
+	// Outlook 2010+ draws an underscore rule above the quoted From: block
+	ruleRegexp = regexp.MustCompile(`^\s*_{10,}\s*$`)
+)
+
+// textLine is a single line of a text body, end includes the line terminator
+type textLine struct {
+	start, end int
+	text       string // Line content without terminator
+}
+
+// splitLines breaks text into lines, keeping track of their offsets
+func splitLines(text string) []textLine {
+	lines := make([]textLine, 0, strings.Count(text, "\n")+1)
+	start := 0
+	for start < len(text) {
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start + 1
+		}
+		lines = append(lines, textLine{
+			start: start,
+			end:   end,
+			text:  strings.TrimRight(text[start:end], "\r\n"),
+		})
+		start = end
+	}
+	return lines
+}
+
+func isQuotedLine(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " \t"), ">")
+}
+
+func isBlankLine(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// nextNonBlank returns the index of the next non-blank line at or after i, or -1
+func nextNonBlank(lines []textLine, i int) int {
+	for ; i < len(lines); i++ {
+		if !isBlankLine(lines[i].text) {
+			return i
+		}
+	}
+	return -1
+}
+
+// attributionLength returns the number of lines (1 or 2) making up an "On ... wrote:"
+// attribution starting at line i, or 0 if there is none.  Attributions are only
+// recognized when followed by quoted lines, as the phrase is common in prose.
+func attributionLength(lines []textLine, i int) int {
+	n := 0
+	switch {
+	case isBlankLine(lines[i].text):
+		return 0
+	case attributionRegexp.MatchString(lines[i].text):
+		n = 1
+	case i+1 < len(lines) && attributionRegexp.MatchString(lines[i].text+" "+lines[i+1].text):
+		// Long attributions are often wrapped by the sending client
+		n = 2
+	default:
+		return 0
+	}
+	if next := nextNonBlank(lines, i+n); next >= 0 && isQuotedLine(lines[next].text) {
+		return n
+	}
+	return 0
+}
+
+// isOriginalMessage returns true if line i starts an unprefixed, Outlook style quote
+func isOriginalMessage(lines []textLine, i int) bool {
+	if originalRegexp.MatchString(lines[i].text) {
+		return true
+	}
+	if ruleRegexp.MatchString(lines[i].text) {
+		next := nextNonBlank(lines, i+1)
+		return next >= 0 && strings.HasPrefix(strings.TrimSpace(lines[next].text), "From:")
+	}
+	return false
+}
+
+// SplitTextReply splits a plain text body into segments of new content, quoted history
+// and signature.  Quoted history is recognized by lines starting with ">", "On ... wrote:"
+// attributions preceding them and Outlook "-----Original Message-----" blocks, the latter
+// extending to the end of the body.  The signature begins at a "-- " delimiter line and
+// extends until the next quote.  Blank lines belong to the segment preceding them.
+func SplitTextReply(text string) ReplySegments {
+	lines := splitLines(text)
+	kinds := make([]ReplySegmentKind, len(lines))
+
+	state := ReplyContent
+	for i := 0; i < len(lines); i++ {
+		line := lines[i].text
+		switch {
+		case isOriginalMessage(lines, i):
+			// Everything from here on is history
+			for ; i < len(lines); i++ {
+				kinds[i] = ReplyQuote
+			}
+			continue
+		case isQuotedLine(line):
+			state = ReplyQuote
+		case attributionLength(lines, i) > 0:
+			n := attributionLength(lines, i)
+			for j := 0; j < n; j++ {
+				kinds[i+j] = ReplyQuote
+			}
+			i += n - 1
+			state = ReplyQuote
+			continue
+		case line == "-- ":
+			// The RFC 3676 signature delimiter, note the trailing space; a bare "--" is
+			// too common as a separator (ParseMIMEBody itself joins text parts with it)
+			state = ReplySignature
+		case isBlankLine(line):
+			// Keep the current state
+		case state == ReplyQuote:
+			// Unquoted text following a quote is an interleaved reply
+			state = ReplyContent
+		}
+		kinds[i] = state
+	}
+
+	// Merge lines into segments, leading blank lines of the body belong to the first one
+	segs := make(ReplySegments, 0, 4)
+	for i, line := range lines {
+		kind := kinds[i]
+		if len(segs) == 0 && isBlankLine(line.text) {
+			if next := nextNonBlank(lines, i); next >= 0 {
+				kind = kinds[next]
+			}
+		}
+		if n := len(segs); n > 0 && segs[n-1].Kind == kind {
+			segs[n-1].End = line.end
+		} else {
+			segs = append(segs, ReplySegment{Kind: kind, Start: line.start, End: line.end})
+		}
+	}
+	for i := range segs {
+		segs[i].Text = text[segs[i].Start:segs[i].End]
+	}
+	return segs
+}
+
+// Markers used by popular clients to introduce quoted history in HTML bodies
+var htmlQuoteMarkers = []string{
+	`<blockquote`,
+	`class="gmail_quote"`,
+	`class="moz-cite-prefix"`,
+	`class="yahoo_quoted"`,
+	`id="divRplyFwdMsg"`,
+	`id="appendonsend"`,
+	`-----original message-----`,
+}
+
+// Markers used by popular clients to introduce a signature in HTML bodies
+var htmlSignatureMarkers = []string{
+	`class="gmail_signature"`,
+	`class="moz-signature"`,
+	`id="signature"`,
+	`-- <br`,
+}
+
+// findHtmlMarker returns the offset of the earliest marker in html, or -1.  Markers found
+// inside a tag are moved back to the start of that tag.
+func findHtmlMarker(html string, markers []string) int {
+	lower := strings.ToLower(html)
+	first := -1
+	for _, marker := range markers {
+		pos := strings.Index(lower, strings.ToLower(marker))
+		if pos < 0 {
+			continue
+		}
+		if open := strings.LastIndex(lower[:pos], "<"); open >= 0 &&
+			strings.LastIndex(lower[:pos], ">") < open {
+			pos = open
+		}
+		if first < 0 || pos < first {
+			first = pos
+		}
+	}
+	return first
+}
+
+// SplitHtmlReply splits an HTML body into segments of new content, quoted history and
+// signature.  Quotes and signatures are located using the markup of popular clients
+// (blockquote elements, Gmail, Thunderbird, Outlook and Yahoo classes); the quote extends
+// from the first quote marker to the end of the body, and a signature is only recognized
+// ahead of the quote.
+func SplitHtmlReply(html string) ReplySegments {
+	segs := make(ReplySegments, 0, 3)
+	add := func(kind ReplySegmentKind, start, end int) {
+		if end > start {
+			segs = append(segs, ReplySegment{Kind: kind, Start: start, End: end, Text: html[start:end]})
+		}
+	}
+
+	quote := findHtmlMarker(html, htmlQuoteMarkers)
+	if quote < 0 {
+		quote = len(html)
+	}
+	sig := findHtmlMarker(html[:quote], htmlSignatureMarkers)
+	if sig < 0 {
+		sig = quote
+	}
+
+	add(ReplyContent, 0, sig)
+	add(ReplySignature, sig, quote)
+	add(ReplyQuote, quote, len(html))
+	return segs
+}
@@ -0,0 +1,117 @@
+package enmime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitTextReplyQuoteAndSignature(t *testing.T) {
+	text := "Thanks, that works.\r\n\r\n-- \r\nJohn Doe\r\nACME Inc.\r\n\r\n" +
+		"On Mon, 3 Jun 2013 at 10:00, Jane <jane@example.com> wrote:\r\n" +
+		"> Did you try turning it off and on again?\r\n" +
+		">\r\n" +
+		"> Jane\r\n"
+
+	segs := SplitTextReply(text)
+	if !assert.Equal(t, 3, len(segs), "Expected content, signature and quote") {
+		t.FailNow()
+	}
+	assert.Equal(t, ReplyContent, segs[0].Kind)
+	assert.Equal(t, "Thanks, that works.\r\n\r\n", segs[0].Text)
+	assert.Equal(t, ReplySignature, segs[1].Kind)
+	assert.Equal(t, "-- \r\nJohn Doe\r\nACME Inc.\r\n\r\n", segs[1].Text)
+	assert.Equal(t, ReplyQuote, segs[2].Kind)
+	assert.Equal(t, len(text), segs[2].End, "Quote should extend to end of text")
+
+	// Offsets should be contiguous and match the text
+	for i, seg := range segs {
+		assert.Equal(t, text[seg.Start:seg.End], seg.Text)
+		if i > 0 {
+			assert.Equal(t, segs[i-1].End, seg.Start)
+		}
+	}
+	assert.Equal(t, "Thanks, that works.", segs.Content())
+}
+
+func TestSplitTextReplyWrappedAttribution(t *testing.T) {
+	text := "Sounds good\n\nOn Tue, Jun 4, 2013 at 9:15 AM, Someone With A Long Name\n" +
+		"<someone@example.com> wrote:\n\n> Lunch at noon?\n"
+
+	segs := SplitTextReply(text)
+	if !assert.Equal(t, 2, len(segs)) {
+		t.FailNow()
+	}
+	assert.Equal(t, ReplyContent, segs[0].Kind)
+	assert.Equal(t, "Sounds good\n\n", segs[0].Text)
+	assert.Equal(t, ReplyQuote, segs[1].Kind)
+}
+
+func TestSplitTextReplyInterleaved(t *testing.T) {
+	text := "> First question?\nFirst answer.\n> Second question?\nSecond answer.\n"
+
+	segs := SplitTextReply(text)
+	kinds := make([]ReplySegmentKind, len(segs))
+	for i, seg := range segs {
+		kinds[i] = seg.Kind
+	}
+	assert.Equal(t, []ReplySegmentKind{ReplyQuote, ReplyContent, ReplyQuote, ReplyContent}, kinds)
+	assert.Equal(t, "First answer.\nSecond answer.", segs.Content())
+}
+
+func TestSplitTextReplyOriginalMessage(t *testing.T) {
+	text := "See below.\r\n\r\n-----Original Message-----\r\nFrom: Jane\r\nSent: Monday\r\n\r\n" +
+		"Unprefixed history\r\n-- \r\nNot a signature of the reply\r\n"
+
+	segs := SplitTextReply(text)
+	if !assert.Equal(t, 2, len(segs)) {
+		t.FailNow()
+	}
+	assert.Equal(t, ReplyContent, segs[0].Kind)
+	assert.Equal(t, ReplyQuote, segs[1].Kind)
+	assert.Contains(t, segs[1].Text, "Not a signature")
+}
+
+func TestSplitTextReplyProse(t *testing.T) {
+	// Neither an attribution without quoted lines nor a bare "--" separator should split
+	text := "On Monday my colleague wrote:\nthe report is done.\n--\nSection two\n"
+
+	segs := SplitTextReply(text)
+	if !assert.Equal(t, 1, len(segs)) {
+		t.FailNow()
+	}
+	assert.Equal(t, ReplyContent, segs[0].Kind)
+	assert.Equal(t, text, segs[0].Text)
+	assert.Equal(t, 0, len(SplitTextReply("")), "Empty text should have no segments")
+}
+
+func TestSplitHtmlReply(t *testing.T) {
+	html := `<div>New content</div><div class="gmail_signature">John</div>` +
+		`<div class="gmail_quote">On Mon, Jane wrote:<blockquote>Old</blockquote></div>`
+
+	segs := SplitHtmlReply(html)
+	if !assert.Equal(t, 3, len(segs)) {
+		t.FailNow()
+	}
+	assert.Equal(t, ReplyContent, segs[0].Kind)
+	assert.Equal(t, "<div>New content</div>", segs[0].Text)
+	assert.Equal(t, ReplySignature, segs[1].Kind)
+	assert.Equal(t, `<div class="gmail_signature">John</div>`, segs[1].Text)
+	assert.Equal(t, ReplyQuote, segs[2].Kind)
+	assert.Equal(t, len(html), segs[2].End)
+
+	segs = SplitHtmlReply("<p>No history</p>")
+	assert.Equal(t, 1, len(segs))
+	assert.Equal(t, ReplyContent, segs[0].Kind)
+}
+
+func TestMIMEBodySegments(t *testing.T) {
+	msg := readMessage("html-mime-inline.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Equal(t, "Test of text section", mime.TextSegments().Content())
+	assert.Contains(t, mime.HtmlSegments().Content(), "Test of HTML section")
+}
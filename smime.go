@@ -0,0 +1,229 @@
+package enmime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// SMIMESigner is a signer of an S/MIME signature
+type SMIMESigner struct {
+	Certificate *x509.Certificate     // Signer certificate; nil if not included in the signature
+	SigningTime time.Time             // Signing time attribute; zero if absent
+	Chains      [][]*x509.Certificate // Certificate chains leading to the trusted roots
+	Err         error                 // Why the signature or certificate did not verify; nil if both did
+}
+
+// SMIMESignature is an S/MIME (RFC 8551) signature found in a message, either a detached
+// multipart/signed signature or an opaque application/pkcs7-mime signed-data object
+type SMIMESignature struct {
+	Part         MIMEPart            // The multipart/signed or pkcs7-mime part; nil if it is the message itself
+	Detached     bool                // True for multipart/signed
+	Content      []byte              // The signed MIME entity, with CRLF line breaks
+	Certificates []*x509.Certificate // Certificates included in the signature
+	Signers      []SMIMESigner
+	Valid        bool // True if there is at least one signer and every one verified
+}
+
+// isSMIMESignature returns true for the media type of a detached signature
+func isSMIMESignature(mediatype string) bool {
+	return mediatype == "application/pkcs7-signature" || mediatype == "application/x-pkcs7-signature"
+}
+
+// isSMIMEObject returns true for the media type of an opaque S/MIME object
+func isSMIMEObject(mediatype string) bool {
+	return mediatype == "application/pkcs7-mime" || mediatype == "application/x-pkcs7-mime"
+}
+
+// smimeType returns the lower case smime-type parameter of a Content-Type header
+func smimeType(ctype string) string {
+	_, params, _ := mime.ParseMediaType(ctype)
+	return strings.ToLower(params["smime-type"])
+}
+
+// rawContent returns the original bytes of a part, or nil if they are not known
+func rawContent(p MIMEPart) []byte {
+	if mp, ok := p.(*memMIMEPart); ok {
+		return mp.raw
+	}
+	return nil
+}
+
+// VerifySMIME verifies the S/MIME signatures of the message.  Signer certificates must chain
+// to roots, using the other certificates found in the signature as intermediates; the
+// signing time, if present, is used as the time of verification.  Signatures that do not
+// verify are returned with Valid false; an error is returned for malformed signatures.
+func (m *MIMEBody) VerifySMIME(roots *x509.CertPool) ([]SMIMESignature, error) {
+	signatures := make([]SMIMESignature, 0, 1)
+
+	if m.Root == nil {
+		ctype := m.header.Get("Content-Type")
+		mediatype, _, _ := mime.ParseMediaType(ctype)
+		if isSMIMEObject(mediatype) && smimeType(ctype) == "signed-data" {
+			s, err := verifyOpaque(nil, []byte(m.Text), roots)
+			if err != nil {
+				return nil, err
+			}
+			signatures = append(signatures, *s)
+		}
+		return signatures, nil
+	}
+
+	parts := BreadthMatchAll(m.Root, func(p MIMEPart) bool {
+		switch {
+		case p.ContentType() == "multipart/signed":
+			return true
+		case isSMIMEObject(p.ContentType()):
+			return smimeType(p.Header().Get("Content-Type")) == "signed-data"
+		}
+		return false
+	})
+	for _, p := range parts {
+		var s *SMIMESignature
+		var err error
+		if p.ContentType() == "multipart/signed" {
+			s, err = verifyDetached(p, roots)
+		} else {
+			s, err = verifyOpaque(p, p.Content(), roots)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			signatures = append(signatures, *s)
+		}
+	}
+
+	return signatures, nil
+}
+
+// verifyDetached verifies a multipart/signed part, returning nil if the signature is not
+// an S/MIME one
+func verifyDetached(p MIMEPart, roots *x509.CertPool) (*SMIMESignature, error) {
+	signed := p.FirstChild()
+	if signed == nil || signed.NextSibling() == nil {
+		return nil, fmt.Errorf("multipart/signed part does not have two parts")
+	}
+	sigPart := signed.NextSibling()
+	if !isSMIMESignature(sigPart.ContentType()) {
+		// Probably PGP/MIME
+		return nil, nil
+	}
+	content := rawContent(signed)
+	if content == nil {
+		return nil, fmt.Errorf("Original bytes of the signed part are not available")
+	}
+
+	sd, err := parseSignedData(sigPart.Content())
+	if err != nil {
+		return nil, err
+	}
+	s := &SMIMESignature{Part: p, Detached: true, Content: toCRLF(content)}
+	s.verify(sd, roots)
+	return s, nil
+}
+
+// verifyOpaque verifies signed-data, part may be nil for the message itself
+func verifyOpaque(p MIMEPart, data []byte, roots *x509.CertPool) (*SMIMESignature, error) {
+	sd, err := parseSignedData(data)
+	if err != nil {
+		return nil, err
+	}
+	if sd.content == nil {
+		return nil, fmt.Errorf("Opaque S/MIME signature does not contain the signed content")
+	}
+	s := &SMIMESignature{Part: p, Content: sd.content}
+	s.verify(sd, roots)
+	return s, nil
+}
+
+// verify checks every signer of sd against the content of s
+func (s *SMIMESignature) verify(sd *signedData, roots *x509.CertPool) {
+	s.Certificates = sd.certificates
+	intermediates := x509.NewCertPool()
+	for _, c := range sd.certificates {
+		intermediates.AddCert(c)
+	}
+
+	s.Valid = len(sd.signers) > 0
+	for _, si := range sd.signers {
+		var signer SMIMESigner
+		signer.Certificate, signer.SigningTime, signer.Err = sd.verifySigner(si, s.Content)
+		if signer.Err == nil {
+			opts := x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: intermediates,
+				CurrentTime:   signer.SigningTime,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+			}
+			signer.Chains, signer.Err = signer.Certificate.Verify(opts)
+		}
+		s.Valid = s.Valid && signer.Err == nil
+		s.Signers = append(s.Signers, signer)
+	}
+}
+
+// isEnveloped returns true if the Content-Type header ctype is that of S/MIME encrypted data
+func isEnveloped(ctype string) bool {
+	mediatype, _, _ := mime.ParseMediaType(ctype)
+	t := smimeType(ctype)
+	return isSMIMEObject(mediatype) && (t == "enveloped-data" || t == "authenveloped-data")
+}
+
+// DecryptSMIME decrypts an S/MIME encrypted message for the recipient with certificate cert
+// and private key key, usually an *rsa.PrivateKey.  Enveloped data (AES-CBC) and
+// authenticated enveloped data (AES-GCM, RFC 5083) are supported, with the content key
+// transported by RSA PKCS #1 v1.5 or RSAES-OAEP.  The decrypted entity is parsed with the
+// ParseOptions m was parsed with into a new MIMEBody, whose header is the header of the
+// entity completed with the fields of the original message such as From and Subject; m is
+// left as it is.  The bytes of the entity are retained, so if it is signed, VerifySMIME may
+// be called on the result.
+func (m *MIMEBody) DecryptSMIME(cert *x509.Certificate, key crypto.Decrypter) (*MIMEBody, error) {
+	var data []byte
+	if m.Root == nil {
+		if isEnveloped(m.header.Get("Content-Type")) {
+			data = m.body
+		}
+	} else {
+		p := BreadthMatchFirst(m.Root, func(p MIMEPart) bool {
+			return isEnveloped(p.Header().Get("Content-Type"))
+		})
+		if p != nil {
+			data = p.Content()
+		}
+	}
+	if data == nil {
+		return nil, fmt.Errorf("Message is not S/MIME encrypted")
+	}
+
+	content, err := decryptEnveloped(data, cert, key)
+	if err != nil {
+		return nil, err
+	}
+	return m.decryptedBody(content)
+}
+
+// decryptedBody parses content, a decrypted MIME entity, into a new MIMEBody whose header is
+// completed with the fields of the header of m other than the Content fields
+func (m *MIMEBody) decryptedBody(content []byte) (*MIMEBody, error) {
+	raw := toCRLF(content)
+	inner, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("Error reading decrypted entity: %v", err)
+	}
+	for name, values := range m.header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "content-") || lower == "mime-version" {
+			continue
+		}
+		if _, ok := inner.Header[name]; !ok {
+			inner.Header[name] = values
+		}
+	}
+	return parseMIMEBody(inner, m.opts, raw)
+}
@@ -0,0 +1,204 @@
+package enmime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testSMIMERoots returns a pool holding the CA that issued the test certificates
+func testSMIMERoots() *x509.CertPool {
+	pem, err := ioutil.ReadFile(filepath.Join("test-data", "smime", "ca.pem"))
+	if err != nil {
+		panic(err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		panic("No certificate in ca.pem")
+	}
+	return pool
+}
+
+// testSMIMERecipient returns the certificate and key of the recipient of the encrypted
+// test messages
+func testSMIMERecipient() (*x509.Certificate, crypto.Decrypter) {
+	pair, err := tls.LoadX509KeyPair(filepath.Join("test-data", "smime", "jane.pem"),
+		filepath.Join("test-data", "smime", "jane.key"))
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		panic(err)
+	}
+	return cert, pair.PrivateKey.(crypto.Decrypter)
+}
+
+func TestVerifySMIMEDetached(t *testing.T) {
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("smime-signed.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	assert.Contains(t, mime.Text, "Café")
+
+	sigs, err := mime.VerifySMIME(testSMIMERoots())
+	if !assert.NoError(t, err) || !assert.Equal(t, 1, len(sigs)) {
+		return
+	}
+	s := sigs[0]
+	assert.True(t, s.Detached)
+	assert.Equal(t, mime.Root, s.Part)
+	assert.True(t, bytes.HasPrefix(s.Content, []byte("Content-Type: text/plain; charset=utf-8\r\n")))
+	assert.True(t, s.Valid)
+	if assert.Equal(t, 1, len(s.Signers)) {
+		signer := s.Signers[0]
+		assert.NoError(t, signer.Err)
+		assert.Equal(t, []string{"joe@example.net"}, signer.Certificate.EmailAddresses)
+		assert.False(t, signer.SigningTime.IsZero())
+		assert.True(t, signer.SigningTime.Before(time.Now()))
+		if assert.Equal(t, 1, len(signer.Chains)) {
+			assert.Equal(t, "Enmime Test CA", signer.Chains[0][1].Subject.CommonName)
+		}
+	}
+}
+
+func TestVerifySMIMEOpaque(t *testing.T) {
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("smime-opaque.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+
+	sigs, err := mime.VerifySMIME(testSMIMERoots())
+	if !assert.NoError(t, err) || !assert.Equal(t, 1, len(sigs)) {
+		return
+	}
+	s := sigs[0]
+	assert.False(t, s.Detached)
+	assert.Nil(t, s.Part)
+	assert.Contains(t, string(s.Content), "Caf=C3=A9")
+	assert.True(t, s.Valid)
+	if assert.Equal(t, 1, len(s.Signers)) {
+		assert.NoError(t, s.Signers[0].Err)
+		assert.Equal(t, "joe@example.net", s.Signers[0].Certificate.EmailAddresses[0])
+	}
+}
+
+func TestVerifySMIMETampered(t *testing.T) {
+	raw := bytes.Replace(readRawMessage("smime-signed.raw"), []byte("Hi Jane"), []byte("Hi John"), 1)
+	mime, err := ReadMIMEBody(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+
+	sigs, err := mime.VerifySMIME(testSMIMERoots())
+	if !assert.NoError(t, err) || !assert.Equal(t, 1, len(sigs)) {
+		return
+	}
+	assert.False(t, sigs[0].Valid)
+	assert.Error(t, sigs[0].Signers[0].Err)
+}
+
+func TestVerifySMIMEUntrusted(t *testing.T) {
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("smime-signed.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+
+	sigs, err := mime.VerifySMIME(x509.NewCertPool())
+	if !assert.NoError(t, err) || !assert.Equal(t, 1, len(sigs)) {
+		return
+	}
+	s := sigs[0]
+	assert.False(t, s.Valid)
+	if assert.Equal(t, 1, len(s.Signers)) {
+		// The signature itself is sound, but the certificate is not trusted
+		assert.NotNil(t, s.Signers[0].Certificate)
+		_, ok := s.Signers[0].Err.(x509.UnknownAuthorityError)
+		assert.True(t, ok, "%v", s.Signers[0].Err)
+	}
+}
+
+func TestVerifySMIMEUnsigned(t *testing.T) {
+	msg := readMessage("html-mime-inline.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	sigs, err := mime.VerifySMIME(testSMIMERoots())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(sigs))
+}
+
+func TestDecryptSMIME(t *testing.T) {
+	cert, key := testSMIMERecipient()
+	// AES-256-CBC in streamed BER, and AES-128-GCM with the key transported by RSAES-OAEP
+	for _, name := range []string{"smime-enveloped.raw", "smime-authenveloped.raw"} {
+		mime, err := ReadMIMEBodyOptions(bytes.NewReader(readRawMessage(name)), &ParseOptions{SHA1: true})
+		if err != nil {
+			t.Fatalf("Failed to read %v: %v", name, err)
+		}
+		assert.Equal(t, 0, len(mime.Attachments), name)
+
+		clear, err := mime.DecryptSMIME(cert, key)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		assert.Equal(t, "Draft settlement", clear.GetHeader("Subject"), name)
+		assert.Equal(t, "Joe <joe@example.net>", clear.GetHeader("From"), name)
+		assert.Contains(t, clear.Text, "Confidential \u2013 do not forward.", name)
+		if assert.Equal(t, 1, len(clear.Attachments), name) {
+			assert.Equal(t, "settlement.txt", clear.Attachments[0].FileName(), name)
+			assert.Equal(t, "The parties agree to settle.\n", string(clear.Attachments[0].Content()), name)
+			assert.NotNil(t, PartDigests(clear.Attachments[0]).SHA1, "Parse options are kept")
+		}
+	}
+}
+
+func TestDecryptSMIMEErrors(t *testing.T) {
+	cert, key := testSMIMERecipient()
+
+	// Not encrypted
+	signed, err := ReadMIMEBody(bytes.NewReader(readRawMessage("smime-signed.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	_, err = signed.DecryptSMIME(cert, key)
+	assert.Error(t, err)
+
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("smime-authenveloped.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	// Encrypted for someone else
+	sigs, err := signed.VerifySMIME(testSMIMERoots())
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(sigs)) {
+		_, err = mime.DecryptSMIME(sigs[0].Signers[0].Certificate, key)
+		assert.Error(t, err)
+	}
+
+	// Tampered ciphertext fails authentication; the last 18 bytes are the tag
+	data := []byte(mime.Text)
+	data[len(data)-30] ^= 1
+	_, err = decryptEnveloped(data, cert, key)
+	assert.Error(t, err)
+}
+
+func TestBERToDER(t *testing.T) {
+	// Constructed, indefinite length OCTET STRING in two segments
+	ber := []byte{0x24, 0x80, 0x04, 0x02, 'a', 'b', 0x04, 0x01, 'c', 0x00, 0x00}
+	der, err := berToDER(ber)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []byte{0x04, 0x03, 'a', 'b', 'c'}, der)
+	}
+
+	_, err = berToDER([]byte{0x30, 0x80, 0x04, 0x01})
+	assert.Error(t, err)
+}
@@ -0,0 +1,314 @@
+package enmime
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// TypeCheck compares the declared type of a part with the type of its content
+type TypeCheck struct {
+	Declared      string // Content-Type without parameters
+	Extension     string // Lower case extension of the file name, with its dot
+	ExtensionType string // Media type of the extension, empty if unknown
+	Detected      string // Media type detected from the content, see DetectContentType
+	Executable    bool   // The content or the extension is executable
+	Mismatch      bool   // The detected type contradicts the declared or extension type
+}
+
+// CheckContentType detects the type of the content of p and compares it with its declared
+// Content-Type and the extension of its file name.  Generic detected types, such as
+// application/octet-stream and text/plain, contradict nothing.  Types of the same family
+// are not mismatches: a .docx file is detected as such, but may be declared as a zip file,
+// and the other way round.
+func CheckContentType(p MIMEPart) TypeCheck {
+	c := TypeCheck{
+		Declared:  p.ContentType(),
+		Extension: strings.ToLower(filepath.Ext(p.FileName())),
+		Detected:  DetectContentType(p.Content()),
+	}
+	if c.Extension != "" {
+		c.ExtensionType = extensionTypes[c.Extension]
+		if c.ExtensionType == "" {
+			c.ExtensionType, _, _ = mime.ParseMediaType(mime.TypeByExtension(c.Extension))
+		}
+	}
+	c.Executable = executableTypes[c.Detected] || executableTypes[c.ExtensionType] ||
+		executableExtensions[c.Extension]
+
+	if c.Detected != "application/octet-stream" && c.Detected != "text/plain" {
+		detected := typeFamily(c.Detected)
+		for _, t := range []string{c.Declared, c.ExtensionType} {
+			if t != "" && t != "application/octet-stream" && typeFamily(t) != detected {
+				c.Mismatch = true
+			}
+		}
+	}
+	return c
+}
+
+// DetectContentType returns the media type of content, without parameters, from its magic
+// bytes.  It recognizes executables, archives, Office documents and SVG images in addition
+// to the types http.DetectContentType does, which it falls back to;
+// application/octet-stream is returned if the type is unknown.
+func DetectContentType(content []byte) string {
+	for _, s := range signatures {
+		if len(content) >= s.offset+len(s.magic) &&
+			bytes.Equal(content[s.offset:s.offset+len(s.magic)], s.magic) &&
+			(s.valid == nil || s.valid(content)) {
+			if s.mediatype == "application/zip" {
+				return zipType(content)
+			}
+			return s.mediatype
+		}
+	}
+	mediatype, _, err := mime.ParseMediaType(http.DetectContentType(content))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	if (mediatype == "text/xml" || mediatype == "text/plain") && isSVG(content) {
+		return "image/svg+xml"
+	}
+	return mediatype
+}
+
+// isSVG returns true if the root element of the XML document in content is svg, skipping
+// the XML declaration, comments and doctype found before it
+func isSVG(content []byte) bool {
+	if len(content) > 1024 {
+		content = content[:1024]
+	}
+	s := bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	for {
+		s = bytes.TrimLeft(s, " \t\r\n")
+		var end string
+		switch {
+		case bytes.HasPrefix(s, []byte("<?")):
+			end = "?>"
+		case bytes.HasPrefix(s, []byte("<!--")):
+			end = "-->"
+		case bytes.HasPrefix(s, []byte("<!")):
+			end = ">"
+		default:
+			return len(s) > 4 && bytes.HasPrefix(s, []byte("<svg")) &&
+				strings.IndexByte(" \t\r\n/>", s[4]) >= 0
+		}
+		i := bytes.Index(s, []byte(end))
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(end):]
+	}
+}
+
+// signature identifies a file type by the bytes found at an offset, and by valid, if not
+// nil, when these bytes are too common to be conclusive
+type signature struct {
+	offset    int
+	magic     []byte
+	mediatype string
+	valid     func(content []byte) bool
+}
+
+// signatures lists the types DetectContentType recognizes before http.DetectContentType
+var signatures = []signature{
+	{0, []byte("MZ"), "application/vnd.microsoft.portable-executable", isPE},
+	{0, []byte("\x7fELF"), "application/x-executable", nil},
+	{0, []byte("\xfe\xed\xfa\xce"), "application/x-mach-binary", nil},
+	{0, []byte("\xfe\xed\xfa\xcf"), "application/x-mach-binary", nil},
+	{0, []byte("\xce\xfa\xed\xfe"), "application/x-mach-binary", nil},
+	{0, []byte("\xcf\xfa\xed\xfe"), "application/x-mach-binary", nil},
+	{0, []byte("\xca\xfe\xba\xbe"), "application/x-mach-binary", nil},
+	{0, []byte("#!"), "text/x-shellscript", isScript},
+	{0, []byte("L\x00\x00\x00\x01\x14\x02\x00"), "application/x-ms-shortcut", nil},
+	{0, []byte("PK\x03\x04"), "application/zip", nil},
+	{0, []byte("PK\x05\x06"), "application/zip", nil},
+	{0, []byte("Rar!\x1a\x07"), "application/vnd.rar", nil},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), "application/x-7z-compressed", nil},
+	{0, []byte("\x1f\x8b"), "application/gzip", nil},
+	{0, []byte("BZh"), "application/x-bzip2", isBzip2},
+	{0, []byte("\xfd7zXZ\x00"), "application/x-xz", nil},
+	{0, []byte("MSCF\x00\x00\x00\x00"), "application/vnd.ms-cab-compressed", nil},
+	{257, []byte("ustar"), "application/x-tar", nil},
+	{0x8001, []byte("CD001"), "application/x-iso9660-image", nil},
+	{0, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"), "application/x-ole-storage", nil},
+	{0, []byte("{\\rtf"), "application/rtf", nil},
+	{0, []byte("%PDF-"), "application/pdf", nil},
+}
+
+// isPE returns true if the DOS header of content points to the header of a Portable
+// Executable
+func isPE(content []byte) bool {
+	if len(content) < 0x40 {
+		return false
+	}
+	offset := int(binary.LittleEndian.Uint32(content[0x3c:]))
+	return offset >= 0x40 && offset <= len(content)-4 &&
+		bytes.Equal(content[offset:offset+4], []byte("PE\x00\x00"))
+}
+
+// isScript returns true if "#!" is followed by the path of an interpreter
+func isScript(content []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(content[2:], " \t"), []byte("/"))
+}
+
+// isBzip2 returns true if "BZh" is followed by a block size and the magic of a block or of
+// the end of the stream
+func isBzip2(content []byte) bool {
+	if len(content) < 10 || content[3] < '1' || content[3] > '9' {
+		return false
+	}
+	magic := string(content[4:10])
+	return magic == "1AY&SY" || magic == "\x17rE8P\x90"
+}
+
+// zipType returns the type of a zip based format from the files it contains
+func zipType(content []byte) string {
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "application/zip"
+	}
+	for _, f := range r.File {
+		switch {
+		case f.Name == "mimetype" && f.Method == zip.Store:
+			// OpenDocument and EPUB name their type in their first file
+			if rc, err := f.Open(); err == nil {
+				buf := make([]byte, 100)
+				n, _ := rc.Read(buf)
+				rc.Close()
+				if mediatype, _, err := mime.ParseMediaType(string(buf[:n])); err == nil {
+					return mediatype
+				}
+			}
+		case strings.HasPrefix(f.Name, "word/"):
+			return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+		case strings.HasPrefix(f.Name, "xl/"):
+			return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+		case strings.HasPrefix(f.Name, "ppt/"):
+			return "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+		case f.Name == "AndroidManifest.xml":
+			return "application/vnd.android.package-archive"
+		case f.Name == "META-INF/MANIFEST.MF":
+			return "application/java-archive"
+		}
+	}
+	return "application/zip"
+}
+
+// typeFamily returns the type standing for all the types compatible with mediatype
+func typeFamily(mediatype string) string {
+	mediatype = strings.ToLower(mediatype)
+	if f, ok := typeFamilies[mediatype]; ok {
+		return f
+	}
+	if strings.HasPrefix(mediatype, "application/vnd.oasis.opendocument.") ||
+		strings.HasPrefix(mediatype, "application/vnd.openxmlformats-officedocument.") {
+		return "application/zip"
+	}
+	return mediatype
+}
+
+// typeFamilies maps aliases and specializations to the type of their family
+var typeFamilies = map[string]string{
+	"application/x-zip-compressed":                     "application/zip",
+	"application/x-zip":                                "application/zip",
+	"application/epub+zip":                             "application/zip",
+	"application/java-archive":                         "application/zip",
+	"application/vnd.android.package-archive":          "application/zip",
+	"application/x-pdf":                                "application/pdf",
+	"image/jpg":                                        "image/jpeg",
+	"image/pjpeg":                                      "image/jpeg",
+	"application/x-gzip":                               "application/gzip",
+	"application/x-rar-compressed":                     "application/vnd.rar",
+	"application/x-rar":                                "application/vnd.rar",
+	"application/x-msdownload":                         "application/vnd.microsoft.portable-executable",
+	"application/x-dosexec":                            "application/vnd.microsoft.portable-executable",
+	"application/x-msdos-program":                      "application/vnd.microsoft.portable-executable",
+	"application/msword":                               "application/x-ole-storage",
+	"application/vnd.ms-excel":                         "application/x-ole-storage",
+	"application/vnd.ms-powerpoint":                    "application/x-ole-storage",
+	"application/vnd.ms-outlook":                       "application/x-ole-storage",
+	"application/x-msi":                                "application/x-ole-storage",
+	"text/rtf":                                         "application/rtf",
+	"application/x-sh":                                 "text/x-shellscript",
+	"text/x-sh":                                        "text/x-shellscript",
+	"application/x-sharedlib":                          "application/x-executable",
+	"application/x-mach-o-executable":                  "application/x-mach-binary",
+	"application/x-iso9660":                            "application/x-iso9660-image",
+	"application/x-compressed-tar":                     "application/gzip",
+	"application/x-tgz":                                "application/gzip",
+	"application/vnd.ms-cab":                           "application/vnd.ms-cab-compressed",
+	"application/vnd.ms-word.document.macroenabled.12": "application/zip",
+	"application/vnd.ms-excel.sheet.macroenabled.12":   "application/zip",
+	"text/xml":                                         "application/xml",
+}
+
+// extensionTypes maps file name extensions to their media types, so that checks do not
+// depend on the MIME tables of the system
+var extensionTypes = map[string]string{
+	".exe":  "application/vnd.microsoft.portable-executable",
+	".dll":  "application/vnd.microsoft.portable-executable",
+	".scr":  "application/vnd.microsoft.portable-executable",
+	".sys":  "application/vnd.microsoft.portable-executable",
+	".lnk":  "application/x-ms-shortcut",
+	".sh":   "text/x-shellscript",
+	".zip":  "application/zip",
+	".jar":  "application/java-archive",
+	".apk":  "application/vnd.android.package-archive",
+	".rar":  "application/vnd.rar",
+	".7z":   "application/x-7z-compressed",
+	".gz":   "application/gzip",
+	".tgz":  "application/gzip",
+	".bz2":  "application/x-bzip2",
+	".xz":   "application/x-xz",
+	".tar":  "application/x-tar",
+	".cab":  "application/vnd.ms-cab-compressed",
+	".iso":  "application/x-iso9660-image",
+	".img":  "application/x-iso9660-image",
+	".pdf":  "application/pdf",
+	".rtf":  "application/rtf",
+	".doc":  "application/msword",
+	".xls":  "application/vnd.ms-excel",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".msg":  "application/vnd.ms-outlook",
+	".msi":  "application/x-msi",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".docm": "application/vnd.ms-word.document.macroenabled.12",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".xlsm": "application/vnd.ms-excel.sheet.macroenabled.12",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+	".epub": "application/epub+zip",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".txt":  "text/plain",
+	".htm":  "text/html",
+	".html": "text/html",
+}
+
+// executableTypes lists the media types of content that runs when opened
+var executableTypes = map[string]bool{
+	"application/vnd.microsoft.portable-executable": true,
+	"application/x-executable":                      true,
+	"application/x-mach-binary":                     true,
+	"application/x-ms-shortcut":                     true,
+	"application/x-msi":                             true,
+	"application/java-archive":                      true,
+	"application/vnd.android.package-archive":       true,
+	"text/x-shellscript":                            true,
+}
+
+// executableExtensions lists file name extensions Windows runs when the file is opened
+var executableExtensions = map[string]bool{
+	".exe": true, ".com": true, ".scr": true, ".pif": true, ".bat": true, ".cmd": true,
+	".vbs": true, ".vbe": true, ".js": true, ".jse": true, ".wsf": true, ".wsh": true,
+	".ps1": true, ".hta": true, ".msi": true, ".lnk": true, ".jar": true, ".cpl": true,
+}
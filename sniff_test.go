@@ -0,0 +1,156 @@
+package enmime
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// zipFile returns a zip archive holding empty files with the given names
+func zipFile(t *testing.T, names ...string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		if _, err := w.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// peFile returns the headers of a Portable Executable
+func peFile() []byte {
+	exe := make([]byte, 0x80)
+	copy(exe, "MZ\x90\x00\x03\x00\x00\x00\x04\x00")
+	exe[0x3c] = 0x40
+	copy(exe[0x40:], "PE\x00\x00\x4c\x01")
+	return exe
+}
+
+func TestDetectContentType(t *testing.T) {
+	tar := make([]byte, 512)
+	copy(tar[257:], "ustar")
+
+	tests := []struct {
+		content  []byte
+		expected string
+	}{
+		{peFile(), "application/vnd.microsoft.portable-executable"},
+		{[]byte("\x7fELF\x02\x01\x01"), "application/x-executable"},
+		{[]byte("\xcf\xfa\xed\xfe\x07\x00\x00\x01"), "application/x-mach-binary"},
+		{[]byte("#!/bin/sh\necho hi\n"), "text/x-shellscript"},
+		{[]byte("#! /usr/bin/env python\n"), "text/x-shellscript"},
+		{[]byte("BZh91AY&SY\x00\x01"), "application/x-bzip2"},
+		{[]byte("%PDF-1.4\n"), "application/pdf"},
+		{[]byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1\x00"), "application/x-ole-storage"},
+		{[]byte("Rar!\x1a\x07\x01\x00"), "application/vnd.rar"},
+		{[]byte("7z\xbc\xaf\x27\x1c\x00\x04"), "application/x-7z-compressed"},
+		{tar, "application/x-tar"},
+		{zipFile(t, "readme.txt"), "application/zip"},
+		{zipFile(t, "[Content_Types].xml", "_rels/.rels", "word/document.xml"),
+			"application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{zipFile(t, "[Content_Types].xml", "xl/workbook.xml"),
+			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{zipFile(t, "META-INF/MANIFEST.MF", "Main.class"), "application/java-archive"},
+		{[]byte("PK\x03\x04truncated"), "application/zip"},
+		{[]byte("\x89PNG\r\n\x1a\n"), "image/png"},
+		{[]byte("<html><body>hi</body></html>"), "text/html"},
+		{[]byte("<?xml version=\"1.0\"?>\n<!-- Created with Inkscape -->\n<svg xmlns=\"http://www.w3.org/2000/svg\"/>"),
+			"image/svg+xml"},
+		{[]byte("<svg width=\"10\" height=\"10\"></svg>"), "image/svg+xml"},
+		{[]byte("<?xml version=\"1.0\"?>\n<svgs/>"), "text/xml"},
+		{[]byte("Just some text"), "text/plain"},
+		{[]byte{0x00, 0x01, 0x02, 0xff}, "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, DetectContentType(tt.content), "%q", tt.content)
+	}
+
+	// Text that happens to start with a weak magic
+	for _, text := range []string{"MZ is the code of Mozambique", "MZ" + string(make([]byte, 0x40)),
+		"#!important notes", "BZh, said the bee"} {
+		assert.NotEqual(t, "application/vnd.microsoft.portable-executable", DetectContentType([]byte(text)), text)
+		assert.NotEqual(t, "text/x-shellscript", DetectContentType([]byte(text)), text)
+		assert.NotEqual(t, "application/x-bzip2", DetectContentType([]byte(text)), text)
+	}
+	assert.Equal(t, "text/plain", DetectContentType([]byte("MZ is the code of Mozambique")))
+}
+
+func TestDetectOpenDocument(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("application/vnd.oasis.opendocument.text"))
+	w.Create("content.xml")
+	w.Close()
+	assert.Equal(t, "application/vnd.oasis.opendocument.text", DetectContentType(buf.Bytes()))
+}
+
+func TestCheckContentType(t *testing.T) {
+	exe := peFile()
+	docx := zipFile(t, "[Content_Types].xml", "word/document.xml")
+	b := NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		AddAttachment([]byte("%PDF-1.4\n"), "application/pdf", "report.pdf").
+		AddAttachment(exe, "application/pdf", "invoice.pdf").
+		AddAttachment(docx, "application/zip", "letter.zip").
+		AddAttachment([]byte("Not a PDF at all"), "application/pdf", "notes.pdf").
+		AddAttachment([]byte("\x89PNG\r\n\x1a\n"), "image/jpeg", "photo.jpg").
+		AddAttachment(exe, "application/octet-stream", "setup.exe").
+		AddAttachment(docx, "application/octet-stream", "report.PDF").
+		AddAttachment([]byte("<?xml version=\"1.0\"?>\n<svg xmlns=\"http://www.w3.org/2000/svg\"/>"),
+			"image/svg+xml", "logo.svg")
+	mime, _ := parseBuilt(t, b)
+	if !assert.Equal(t, 8, len(mime.Attachments)) {
+		return
+	}
+
+	c := CheckContentType(mime.Attachments[0])
+	assert.Equal(t, TypeCheck{
+		Declared:      "application/pdf",
+		Extension:     ".pdf",
+		ExtensionType: "application/pdf",
+		Detected:      "application/pdf",
+	}, c)
+
+	c = CheckContentType(mime.Attachments[1])
+	assert.Equal(t, "application/vnd.microsoft.portable-executable", c.Detected)
+	assert.True(t, c.Mismatch)
+	assert.True(t, c.Executable)
+
+	// A .docx is a zip file
+	c = CheckContentType(mime.Attachments[2])
+	assert.Equal(t, "application/vnd.openxmlformats-officedocument.wordprocessingml.document", c.Detected)
+	assert.False(t, c.Mismatch)
+
+	// Text contradicts nothing
+	c = CheckContentType(mime.Attachments[3])
+	assert.Equal(t, "text/plain", c.Detected)
+	assert.False(t, c.Mismatch)
+
+	c = CheckContentType(mime.Attachments[4])
+	assert.Equal(t, "image/png", c.Detected)
+	assert.True(t, c.Mismatch)
+	assert.False(t, c.Executable)
+
+	c = CheckContentType(mime.Attachments[5])
+	assert.False(t, c.Mismatch)
+	assert.True(t, c.Executable)
+
+	// The extension alone can contradict the content
+	c = CheckContentType(mime.Attachments[6])
+	assert.Equal(t, ".pdf", c.Extension)
+	assert.True(t, c.Mismatch)
+
+	// SVG is XML
+	c = CheckContentType(mime.Attachments[7])
+	assert.Equal(t, "image/svg+xml", c.Detected)
+	assert.False(t, c.Mismatch)
+}
@@ -0,0 +1,226 @@
+package enmime
+
+import (
+	"encoding/hex"
+	"fmt"
+	"html"
+	"mime"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+)
+
+// StripOptions selects the attachments StripAttachments removes.  A part is removed if any
+// of the criteria matches it.
+type StripOptions struct {
+	MaxSize      int             // Remove parts with more decoded bytes, 0 for no limit
+	ContentTypes []string        // Remove these media types, "type/*" matches a whole type
+	Extensions   []string        // Remove files with these extensions, e.g. ".exe"
+	Matcher      MIMEPartMatcher // Remove parts it returns true for, may be nil
+}
+
+// StrippedPart describes a part removed by StripAttachments
+type StrippedPart struct {
+	FileName    string // File name of the part, may be empty
+	ContentType string // Content-Type without parameters
+	Size        int    // Length of the decoded content
+	SHA256      string // Hex encoded SHA-256 digest of the decoded content
+}
+
+// StripAttachments removes the attachments and inline parts matching opts from the message
+// and adds a notice listing them to the text and HTML bodies.  If the message has no body,
+// the notice is added as a text part to the top-level multipart/mixed, which is created if
+// required.  Multiparts left empty are removed.  The body of a non-multipart message is
+// replaced by the notice if it is an attachment matching opts.  Text, Html, Attachments and
+// Inlines are updated; the message can then be written with Encode.
+func (m *MIMEBody) StripAttachments(opts StripOptions) ([]StrippedPart, error) {
+	if m.Root == nil {
+		return m.stripBody(opts), nil
+	}
+
+	var stripped []StrippedPart
+	for _, p := range append(append([]MIMEPart(nil), m.Attachments...), m.Inlines...) {
+		if !opts.matches(p) {
+			continue
+		}
+		stripped = append(stripped, describeStripped(p))
+
+		// Remove the part, then the multiparts it leaves empty
+		for p != m.Root {
+			parent := p.Parent()
+			if err := RemovePart(p); err != nil {
+				return nil, err
+			}
+			if parent.FirstChild() != nil {
+				break
+			}
+			p = parent
+		}
+	}
+	if len(stripped) == 0 {
+		return nil, nil
+	}
+
+	// The notice is added to the bodies, so that they remain the ones Update locates
+	text := DepthMatchFirst(m.Root, func(p MIMEPart) bool {
+		return p.ContentType() == "text/plain" && p.Disposition() != "attachment" &&
+			onSelectedBranch(p, m.alternatives, rendersText)
+	})
+	html := BreadthMatchFirst(m.Root, func(p MIMEPart) bool {
+		return p.ContentType() == "text/html" && p.Disposition() != "attachment" &&
+			onSelectedBranch(p, m.alternatives, rendersHtml)
+	})
+	if text != nil {
+		content := string(text.Content())
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if err := SetContent(text, []byte(content+"\n"+strippedText(stripped))); err != nil {
+			return nil, err
+		}
+	}
+	if html != nil {
+		if err := SetContent(html, []byte(insertHtmlNotice(string(html.Content()),
+			strippedHtml(stripped)))); err != nil {
+			return nil, err
+		}
+	}
+	if text == nil && html == nil {
+		if err := m.appendNotice(newTextPart("text/plain", strippedText(stripped))); err != nil {
+			return nil, err
+		}
+	}
+	m.Update()
+
+	return stripped, nil
+}
+
+// stripBody replaces the body of a non-multipart message by the notice if it is an
+// attachment matching opts
+func (m *MIMEBody) stripBody(opts StripOptions) []StrippedPart {
+	h := textproto.MIMEHeader(m.header)
+	mediatype, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if mediatype == "" {
+		mediatype = "text/plain"
+	}
+	p := &memMIMEPart{header: h, contentType: mediatype, content: m.body}
+	p.setTypeFields()
+	if p.disposition != "attachment" && (rendersText(mediatype) || rendersHtml(mediatype)) {
+		return nil
+	}
+	if !opts.matches(p) {
+		return nil
+	}
+
+	stripped := []StrippedPart{describeStripped(p)}
+	m.body = []byte(strippedText(stripped))
+	for name := range m.header {
+		if strings.HasPrefix(name, "Content-") {
+			delete(m.header, name)
+		}
+	}
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	h.Set("Content-Transfer-Encoding", SelectTransferEncoding(m.body, true))
+	m.Text, m.Html = string(m.body), ""
+	m.raw, m.digests, m.ContentMD5Errors = nil, nil, nil
+	return stripped
+}
+
+// describeStripped returns the description of p in the notice
+func describeStripped(p MIMEPart) StrippedPart {
+	return StrippedPart{
+		FileName:    p.FileName(),
+		ContentType: p.ContentType(),
+		Size:        len(p.Content()),
+		SHA256:      hex.EncodeToString(PartDigests(p).SHA256),
+	}
+}
+
+// appendNotice adds notice to the top-level multipart/mixed, wrapping the root in one if
+// required
+func (m *MIMEBody) appendNotice(notice *memMIMEPart) error {
+	if m.Root.ContentType() != "multipart/mixed" {
+		// The root holds the header of the message, its child only needs the Content fields
+		root, err := editablePart(m.Root)
+		if err != nil {
+			return err
+		}
+		h := copyHeader(root.header)
+		for name := range h {
+			if !strings.HasPrefix(name, "Content-") {
+				delete(h, name)
+			}
+		}
+		root.header = h
+		mixed, err := newMultipart("multipart/mixed", nil, root)
+		if err != nil {
+			return err
+		}
+		m.Root = mixed
+	}
+	return AppendChild(m.Root, notice)
+}
+
+// insertHtmlNotice adds notice at the end of the body of the HTML document doc
+func insertHtmlNotice(doc, notice string) string {
+	if end := strings.LastIndex(strings.ToLower(doc), "</body>"); end >= 0 {
+		return doc[:end] + notice + doc[end:]
+	}
+	return doc + notice
+}
+
+// matches returns true if p should be stripped
+func (opts StripOptions) matches(p MIMEPart) bool {
+	if opts.MaxSize > 0 && len(p.Content()) > opts.MaxSize {
+		return true
+	}
+	for _, t := range opts.ContentTypes {
+		t = strings.ToLower(t)
+		if t == p.ContentType() ||
+			strings.HasSuffix(t, "/*") && strings.HasPrefix(p.ContentType(), t[:len(t)-1]) {
+			return true
+		}
+	}
+	ext := filepath.Ext(p.FileName())
+	for _, e := range opts.Extensions {
+		if ext != "" && strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return opts.Matcher != nil && opts.Matcher(p)
+}
+
+// describe returns a line describing s, without its file name
+func (s StrippedPart) describe() string {
+	return fmt.Sprintf("%v, %v bytes, SHA-256 %v", s.ContentType, s.Size, s.SHA256)
+}
+
+// name returns the file name of s, or a placeholder
+func (s StrippedPart) name() string {
+	if s.FileName == "" {
+		return "(unnamed)"
+	}
+	return s.FileName
+}
+
+// strippedText returns the text notice for the stripped parts
+func strippedText(stripped []StrippedPart) string {
+	var b strings.Builder
+	b.WriteString("The following attachments were removed from this message:\n\n")
+	for _, s := range stripped {
+		fmt.Fprintf(&b, "- %v (%v)\n", s.name(), s.describe())
+	}
+	return b.String()
+}
+
+// strippedHtml returns the HTML notice for the stripped parts
+func strippedHtml(stripped []StrippedPart) string {
+	var b strings.Builder
+	b.WriteString("<p>The following attachments were removed from this message:</p>\n<ul>\n")
+	for _, s := range stripped {
+		fmt.Fprintf(&b, "<li>%v (%v)</li>\n", html.EscapeString(s.name()),
+			html.EscapeString(s.describe()))
+	}
+	b.WriteString("</ul>\n")
+	return b.String()
+}
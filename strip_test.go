@@ -0,0 +1,141 @@
+package enmime
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripAttachments(t *testing.T) {
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("17-with-attachments.eml")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	html := mime.Html
+	content := mime.Attachments[0].Content()
+	name := mime.Attachments[0].FileName() // Decomposed accents
+
+	stripped, err := mime.StripAttachments(StripOptions{ContentTypes: []string{"image/*"}})
+	if !assert.NoError(t, err) || !assert.Equal(t, 1, len(stripped)) {
+		return
+	}
+	sum := sha256.Sum256(content)
+	assert.Equal(t, StrippedPart{
+		FileName:    name,
+		ContentType: "image/png",
+		Size:        len(content),
+		SHA256:      hex.EncodeToString(sum[:]),
+	}, stripped[0])
+	assert.Equal(t, 0, len(mime.Attachments))
+	assert.True(t, strings.HasPrefix(mime.Html, html))
+	assert.Contains(t, mime.Html, "<li>"+name+" (image/png, ")
+	assert.Contains(t, mime.Text, "- "+name+" (image/png, ")
+
+	out, raw := reencode(t, mime, nil)
+	assert.Equal(t, 0, len(out.Attachments))
+	assert.Equal(t, "multipart/mixed", out.Root.ContentType())
+	assert.Nil(t, out.Root.FirstChild().NextSibling())
+	assert.Contains(t, out.Html, "<li>"+name+" (image/png, ")
+	assert.NotContains(t, string(raw), "X-Attachment-Id")
+}
+
+func TestStripNoticeInBodies(t *testing.T) {
+	mime, err := ReadMIMEBody(bytes.NewReader(readRawMessage("html-mime-inline.raw")))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+	html := mime.Html
+
+	stripped, err := mime.StripAttachments(StripOptions{MaxSize: 100})
+	if !assert.NoError(t, err) || !assert.Equal(t, 1, len(stripped)) {
+		return
+	}
+	assert.Equal(t, "multipart/alternative", mime.Root.ContentType())
+	assert.Equal(t, 0, len(mime.Inlines))
+	end := strings.LastIndex(strings.ToLower(html), "</body>")
+	assert.True(t, strings.HasPrefix(mime.Html, html[:end]))
+	assert.True(t, strings.HasSuffix(mime.Html, html[end:]))
+	assert.Contains(t, mime.Html, "were removed from this message")
+
+	out, raw := reencode(t, mime, nil)
+	assert.Equal(t, 1, strings.Count(string(raw), "Subject:"))
+	assert.Equal(t, "MIME test 1", out.GetHeader("Subject"))
+	assert.Equal(t, strings.Replace(mime.Html, "\r\n", "\n", -1), strings.Replace(out.Html, "\r\n", "\n", -1))
+	assert.Contains(t, out.Text, "were removed from this message")
+}
+
+func TestStripWrapsRoot(t *testing.T) {
+	// A message without a body gets a notice part
+	raw := "From: a@example.net\r\nContent-Type: application/zip; name=\"a.zip\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\nUEsFBgAAAAAAAAAAAAAAAAAAAAAAAA==\r\n"
+	mime, err := ReadMIMEBody(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read MIME: %v", err)
+	}
+
+	// The body of a non-multipart message is replaced
+	stripped, err := mime.StripAttachments(StripOptions{Extensions: []string{".zip"}})
+	if !assert.NoError(t, err) || !assert.Equal(t, 1, len(stripped)) {
+		return
+	}
+	assert.Equal(t, "a.zip", stripped[0].FileName)
+	assert.Contains(t, mime.Text, "- a.zip (application/zip, 22 bytes")
+	out, _ := reencode(t, mime, &EncodeOptions{PreserveRaw: true})
+	assert.Nil(t, out.Root)
+	assert.Equal(t, mime.Text, strings.Replace(out.Text, "\r\n", "\n", -1))
+	assert.Equal(t, "a@example.net", out.GetHeader("From"))
+
+	// Text bodies are not attachments
+	mime, _ = ReadMIMEBody(strings.NewReader("From: a@example.net\r\n\r\nHello\r\n"))
+	stripped, err = mime.StripAttachments(StripOptions{ContentTypes: []string{"text/*"}})
+	assert.NoError(t, err)
+	assert.Nil(t, stripped)
+	assert.Equal(t, "Hello\r\n", mime.Text)
+
+	// A related root without text is wrapped in a multipart/mixed holding the notice
+	mime, _ = parseBuilt(t, NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		Html("<p>Hi</p>").AddInline([]byte("GIF89a"), "", "dot.gif", "dot"))
+	root, _ := editablePart(mime.Root)
+	html := DepthMatchFirst(root, func(p MIMEPart) bool { return p.ContentType() == "text/html" })
+	assert.NoError(t, RemovePart(html))
+	mime.Update()
+	stripped, err = mime.StripAttachments(StripOptions{Extensions: []string{".gif"}})
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(stripped)) {
+		assert.Equal(t, "multipart/mixed", mime.Root.ContentType())
+		assert.Contains(t, mime.Text, "- dot.gif (image/gif")
+	}
+}
+
+func TestStripRemovesEmptyMultiparts(t *testing.T) {
+	b := NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		AddAttachment([]byte("a,b\n"), "", "data.CSV").
+		AddAttachment([]byte("MZ"), "application/x-msdownload", "tool.exe")
+	mime, _ := parseBuilt(t, b)
+
+	// Nothing matches
+	stripped, err := mime.StripAttachments(StripOptions{Extensions: []string{".zip"}})
+	assert.NoError(t, err)
+	assert.Nil(t, stripped)
+	assert.Equal(t, 2, len(mime.Attachments))
+
+	stripped, err = mime.StripAttachments(StripOptions{
+		Extensions: []string{".csv"},
+		Matcher: func(p MIMEPart) bool {
+			return p.ContentType() == "application/x-msdownload"
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(stripped))
+	assert.Equal(t, 0, len(mime.Attachments))
+	if assert.NotNil(t, mime.Root.FirstChild()) {
+		assert.Equal(t, "text/plain", mime.Root.FirstChild().ContentType())
+		assert.Nil(t, mime.Root.FirstChild().NextSibling())
+	}
+	assert.Contains(t, mime.Text, "- data.CSV (text/csv")
+	assert.Contains(t, mime.Text, "- tool.exe (application/x-msdownload, 2 bytes")
+	reencode(t, mime, nil)
+}
@@ -0,0 +1,167 @@
+package enmime
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// ContactName is the structured name (N property) of a Contact
+type ContactName struct {
+	Family     string
+	Given      string
+	Additional string
+	Prefix     string
+	Suffix     string
+}
+
+// ContactValue is an email address or phone number of a Contact
+type ContactValue struct {
+	Value     string
+	Types     []string // Lower case TYPE parameters such as "work", "home" or "cell"
+	Preferred bool     // True if marked TYPE=pref (vCard 3.0) or PREF=1 (vCard 4.0)
+}
+
+// Contact is a vCard (RFC 2426, RFC 6350) found in a message
+type Contact struct {
+	Version       string
+	FormattedName string
+	Name          ContactName
+	Nicknames     []string
+	Org           []string // Organization name followed by its units
+	Title         string
+	Emails        []ContactValue
+	Phones        []ContactValue
+}
+
+// isVCardPart returns true if the part holds a vCard
+func isVCardPart(p MIMEPart) bool {
+	switch p.ContentType() {
+	case "text/vcard", "text/x-vcard", "text/directory":
+		return true
+	}
+	return strings.HasSuffix(strings.ToLower(p.FileName()), ".vcf")
+}
+
+// Contacts locates the vCard parts and .vcf attachments of the message and returns the
+// contacts they contain.  Parts that cannot be parsed are skipped and returned as errors.
+func (m *MIMEBody) Contacts() ([]Contact, []*PartError) {
+	if m.Root == nil {
+		mediatype, _, _ := mime.ParseMediaType(m.header.Get("Content-Type"))
+		switch mediatype {
+		case "text/vcard", "text/x-vcard", "text/directory":
+			contacts, err := ParseVCard([]byte(m.Text))
+			if err != nil {
+				return nil, []*PartError{{Err: err}}
+			}
+			return contacts, nil
+		}
+		return nil, nil
+	}
+
+	contacts := make([]Contact, 0, 1)
+	var errs []*PartError
+	for _, p := range BreadthMatchAll(m.Root, isVCardPart) {
+		data, err := contentText(p)
+		if err != nil {
+			errs = append(errs, &PartError{Part: p, Err: fmt.Errorf("Error decoding vCard: %v", err)})
+			continue
+		}
+		found, err := ParseVCard(data)
+		if err != nil {
+			errs = append(errs, &PartError{Part: p, Err: err})
+			continue
+		}
+		contacts = append(contacts, found...)
+	}
+
+	return contacts, errs
+}
+
+// ParseVCard parses the VCARD objects in data
+func ParseVCard(data []byte) ([]Contact, error) {
+	components, err := parseContentComponents(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing vCard: %v", err)
+	}
+
+	contacts := make([]Contact, 0, len(components))
+	for _, c := range components {
+		if c.name != "VCARD" {
+			continue
+		}
+		contacts = append(contacts, parseVCardComponent(c))
+	}
+
+	return contacts, nil
+}
+
+// parseVCardComponent converts a VCARD component into a Contact
+func parseVCardComponent(c *contentComponent) Contact {
+	contact := Contact{
+		Version:       strings.TrimSpace(c.propValue("VERSION")),
+		FormattedName: c.propValue("FN"),
+		Title:         c.propValue("TITLE"),
+	}
+
+	if p := c.prop("N"); p != nil {
+		fields := make([]string, 5)
+		for i, f := range splitContentValue(p.value, ';') {
+			if i < len(fields) {
+				fields[i] = unescapeContentText(f)
+			}
+		}
+		contact.Name = ContactName{
+			Family:     fields[0],
+			Given:      fields[1],
+			Additional: fields[2],
+			Prefix:     fields[3],
+			Suffix:     fields[4],
+		}
+	}
+	for _, p := range c.allProps("NICKNAME") {
+		for _, nick := range splitContentValue(p.value, ',') {
+			if nick = strings.TrimSpace(unescapeContentText(nick)); nick != "" {
+				contact.Nicknames = append(contact.Nicknames, nick)
+			}
+		}
+	}
+	if p := c.prop("ORG"); p != nil {
+		for _, unit := range splitContentValue(p.value, ';') {
+			contact.Org = append(contact.Org, unescapeContentText(unit))
+		}
+	}
+	for _, p := range c.allProps("EMAIL") {
+		contact.Emails = append(contact.Emails, parseVCardValue(p, "mailto:"))
+	}
+	for _, p := range c.allProps("TEL") {
+		contact.Phones = append(contact.Phones, parseVCardValue(p, "tel:"))
+	}
+
+	return contact
+}
+
+// parseVCardValue converts an EMAIL or TEL property, stripping the URI scheme vCard 4.0
+// allows in front of the value
+func parseVCardValue(p *contentLine, scheme string) ContactValue {
+	v := ContactValue{Value: strings.TrimSpace(unescapeContentText(p.value))}
+	if strings.HasPrefix(strings.ToLower(v.Value), scheme) {
+		v.Value = v.Value[len(scheme):]
+	}
+	for _, param := range p.params["TYPE"] {
+		for _, t := range strings.Split(param, ",") {
+			t = strings.ToLower(strings.TrimSpace(t))
+			switch t {
+			case "":
+			case "pref":
+				v.Preferred = true
+			default:
+				v.Types = append(v.Types, t)
+			}
+		}
+	}
+	if strings.TrimSpace(p.param("PREF")) == "1" {
+		v.Preferred = true
+	}
+	return v
+}
@@ -0,0 +1,88 @@
+package enmime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContacts(t *testing.T) {
+	msg := readMessage("vcard-attachments.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	contacts, errs := mime.Contacts()
+	if !assert.Nil(t, errs, "Parsing vCards should not have generated an error") {
+		t.FailNow()
+	}
+	if !assert.Equal(t, 2, len(contacts), "Should have two contacts") {
+		t.FailNow()
+	}
+
+	// vCard 3.0 sent as text/x-vcard
+	c := contacts[0]
+	assert.Equal(t, "3.0", c.Version)
+	assert.Equal(t, "James Hillyerd", c.FormattedName)
+	assert.Equal(t, ContactName{Family: "Hillyerd", Given: "James"}, c.Name)
+	assert.Equal(t, []string{"Jim", "Jimmy"}, c.Nicknames)
+	assert.Equal(t, []string{"Inbucket"}, c.Org)
+	if assert.Equal(t, 2, len(c.Emails)) {
+		assert.Equal(t, ContactValue{Value: "jamehi03@jamehi03lx.noa.com",
+			Types: []string{"internet", "work"}, Preferred: true}, c.Emails[0])
+		assert.False(t, c.Emails[1].Preferred)
+	}
+	if assert.Equal(t, 2, len(c.Phones)) {
+		assert.Equal(t, "+1 555 0100", c.Phones[0].Value)
+		assert.Equal(t, []string{"cell"}, c.Phones[0].Types)
+		assert.Equal(t, "+1 555 0199", c.Phones[1].Value)
+	}
+
+	// vCard 4.0 in latin-1, sent as application/octet-stream
+	c = contacts[1]
+	assert.Equal(t, "4.0", c.Version)
+	assert.Equal(t, "Renée Müller", c.FormattedName)
+	assert.Equal(t, ContactName{Family: "Müller", Given: "Renée", Prefix: "Dr."}, c.Name)
+	assert.Equal(t, []string{"ACME Inc.", "Research"}, c.Org)
+	assert.Equal(t, "Chief Scientist", c.Title)
+	if assert.Equal(t, 1, len(c.Emails)) {
+		assert.Equal(t, "renee@acme.example", c.Emails[0].Value)
+		assert.True(t, c.Emails[0].Preferred)
+	}
+	if assert.Equal(t, 1, len(c.Phones)) {
+		assert.Equal(t, ContactValue{Value: "+41-79-555-0100", Types: []string{"voice", "cell"}}, c.Phones[0])
+	}
+}
+
+func TestContactsNone(t *testing.T) {
+	msg := readMessage("non-mime.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse non-MIME: %v", err)
+	}
+
+	contacts, errs := mime.Contacts()
+	assert.Nil(t, errs)
+	assert.Equal(t, 0, len(contacts))
+}
+
+func TestContactsPartErrors(t *testing.T) {
+	mime, _ := parseBuilt(t, NewMailBuilder().From("", "a@example.net").To("", "b@example.net").
+		AddAttachment([]byte("BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Unterminated\r\n"), "text/vcard", "bad.vcf").
+		AddAttachment([]byte("BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Jane\r\nEND:VCARD\r\n"), "text/vcard",
+			"jane.vcf"))
+
+	contacts, errs := mime.Contacts()
+	if assert.Equal(t, 1, len(contacts)) {
+		assert.Equal(t, "Jane", contacts[0].FormattedName)
+	}
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "bad.vcf", errs[0].Part.FileName())
+	}
+}
+
+func TestParseVCardMalformed(t *testing.T) {
+	_, err := ParseVCard([]byte("BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Unterminated\r\n"))
+	assert.NotNil(t, err)
+}